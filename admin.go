@@ -0,0 +1,195 @@
+package walletsdk
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrRenounceNotConfirmed is returned when RenounceOwnership is called
+// without repeating the address of the contract being renounced
+var ErrRenounceNotConfirmed = errors.New("renouncing ownership is irreversible and must be confirmed with the contract address")
+
+// NotOwnerError is returned when an admin operation is attempted by a signer
+// that does not own the contract
+type NotOwnerError struct {
+	Contract string
+	Owner    common.Address
+	Signer   common.Address
+}
+
+func (e *NotOwnerError) Error() string {
+	return fmt.Sprintf("%s is owned by %s, not by signer %s", e.Contract, e.Owner.Hex(), e.Signer.Hex())
+}
+
+// OwnershipTransfer is an OwnershipTransferred event of either contract
+type OwnershipTransfer struct {
+	Contract      string
+	PreviousOwner common.Address
+	NewOwner      common.Address
+	BlockNumber   uint64
+	TxHash        common.Hash
+	LogIndex      uint
+}
+
+// Owner returns the owner of ContractParityToken or ContractStakeWallet
+func (c *Client) Owner(contract string) (common.Address, error) {
+	switch contract {
+	case ContractParityToken:
+		return c.token.Owner(&bind.CallOpts{})
+	case ContractStakeWallet:
+		if c.stakeWallet == nil {
+			return common.Address{}, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.contract.Owner(&bind.CallOpts{})
+	default:
+		return common.Address{}, fmt.Errorf("unknown contract %q", contract)
+	}
+}
+
+// TransferOwnership hands ownership of contract to newOwner. Use
+// RenounceOwnership to leave a contract without an owner.
+func (c *Client) TransferOwnership(contract string, newOwner common.Address) (*types.Transaction, error) {
+	return c.traceTx("TransferOwnership", func(c *Client) (*types.Transaction, error) {
+		if newOwner == (common.Address{}) {
+			return nil, fmt.Errorf("new owner is the zero address, use RenounceOwnership")
+		}
+		opts, err := c.ownerTransactOpts(contract)
+		if err != nil {
+			return nil, err
+		}
+		if contract == ContractParityToken {
+			return c.token.TransferOwnership(opts, newOwner)
+		}
+		return c.stakeWallet.contract.TransferOwnership(opts, newOwner)
+	})
+}
+
+// RenounceOwnership permanently leaves contract without an owner, disabling
+// minting or payment settlement. confirm must be the address of the contract.
+func (c *Client) RenounceOwnership(contract string, confirm common.Address) (*types.Transaction, error) {
+	return c.traceTx("RenounceOwnership", func(c *Client) (*types.Transaction, error) {
+		addr, err := c.contractAddress(contract)
+		if err != nil {
+			return nil, err
+		}
+		if confirm != addr {
+			return nil, ErrRenounceNotConfirmed
+		}
+		opts, err := c.ownerTransactOpts(contract)
+		if err != nil {
+			return nil, err
+		}
+		if contract == ContractParityToken {
+			return c.token.RenounceOwnership(opts)
+		}
+		return c.stakeWallet.contract.RenounceOwnership(opts)
+	})
+}
+
+// RecoverTokens sends tokens held by the stake contract to its owner
+func (c *Client) RecoverTokens(tokenAddress common.Address, amount *big.Int) (*types.Transaction, error) {
+	return c.traceTx("RecoverTokens", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.ownerTransactOpts(ContractStakeWallet)
+		if err != nil {
+			return nil, err
+		}
+		return c.stakeWallet.contract.RecoverTokens(opts, tokenAddress, amount)
+	})
+}
+
+// OwnershipHistory returns the OwnershipTransferred events of both contracts
+// in chain order
+func (c *Client) OwnershipHistory(opts *bind.FilterOpts) ([]OwnershipTransfer, error) {
+	var history []OwnershipTransfer
+
+	tokenEvents, err := c.token.FilterOwnershipTransferred(opts, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter token ownership events: %w", err)
+	}
+	defer tokenEvents.Close()
+	for tokenEvents.Next() {
+		event, err := tokenEvents.Event()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode token ownership event: %w", err)
+		}
+		history = append(history, newOwnershipTransfer(ContractParityToken, event.PreviousOwner, event.NewOwner, event.Raw))
+	}
+	if err := tokenEvents.Error(); err != nil {
+		return nil, fmt.Errorf("failed to read token ownership events: %w", err)
+	}
+
+	if c.stakeWallet != nil {
+		stakeEvents, err := c.stakeWallet.contract.FilterOwnershipTransferred(opts, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter stake wallet ownership events: %w", err)
+		}
+		defer stakeEvents.Close()
+		for stakeEvents.Next() {
+			event, err := stakeEvents.Event()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode stake wallet ownership event: %w", err)
+			}
+			history = append(history, newOwnershipTransfer(ContractStakeWallet, event.PreviousOwner, event.NewOwner, event.Raw))
+		}
+		if err := stakeEvents.Error(); err != nil {
+			return nil, fmt.Errorf("failed to read stake wallet ownership events: %w", err)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].BlockNumber != history[j].BlockNumber {
+			return history[i].BlockNumber < history[j].BlockNumber
+		}
+		return history[i].LogIndex < history[j].LogIndex
+	})
+	return history, nil
+}
+
+func newOwnershipTransfer(contract string, previousOwner, newOwner common.Address, log types.Log) OwnershipTransfer {
+	return OwnershipTransfer{
+		Contract:      contract,
+		PreviousOwner: previousOwner,
+		NewOwner:      newOwner,
+		BlockNumber:   log.BlockNumber,
+		TxHash:        log.TxHash,
+		LogIndex:      log.Index,
+	}
+}
+
+// contractAddress returns the configured address of the named contract
+func (c *Client) contractAddress(contract string) (common.Address, error) {
+	switch contract {
+	case ContractParityToken:
+		return c.tokenAddress, nil
+	case ContractStakeWallet:
+		if c.stakeWallet == nil {
+			return common.Address{}, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.contract.address, nil
+	default:
+		return common.Address{}, fmt.Errorf("unknown contract %q", contract)
+	}
+}
+
+// ownerTransactOpts returns transaction options after checking that the
+// signer owns contract
+func (c *Client) ownerTransactOpts(contract string) (*bind.TransactOpts, error) {
+	owner, err := c.Owner(contract)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s owner: %w", contract, err)
+	}
+	opts, err := c.GetTransactOpts()
+	if err != nil {
+		return nil, err
+	}
+	if opts.From != owner {
+		return nil, &NotOwnerError{Contract: contract, Owner: owner, Signer: opts.From}
+	}
+	return opts, nil
+}
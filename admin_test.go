@@ -0,0 +1,91 @@
+package walletsdk_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestOwnershipAdmin(t *testing.T) {
+	chain := newChain(t)
+	alice := chain.Accounts[0]
+	owner := newClient(t, chain, chain.Owner)
+	client := newClient(t, chain, alice)
+
+	for _, contract := range []string{walletsdk.ContractParityToken, walletsdk.ContractStakeWallet} {
+		got, err := client.Owner(contract)
+		if err != nil {
+			t.Fatalf("Owner(%s): %v", contract, err)
+		}
+		if got != chain.Owner.Address {
+			t.Fatalf("Owner(%s) = %s, want %s", contract, got.Hex(), chain.Owner.Address.Hex())
+		}
+	}
+
+	var notOwner *walletsdk.NotOwnerError
+	if _, err := client.TransferOwnership(walletsdk.ContractParityToken, alice.Address); !errors.As(err, &notOwner) {
+		t.Fatalf("TransferOwnership by non-owner = %v, want NotOwnerError", err)
+	}
+
+	tx, err := owner.TransferOwnership(walletsdk.ContractStakeWallet, alice.Address)
+	mined(t, chain, tx, err)
+
+	if _, err := client.RenounceOwnership(walletsdk.ContractStakeWallet, common.Address{}); !errors.Is(err, walletsdk.ErrRenounceNotConfirmed) {
+		t.Fatalf("unconfirmed RenounceOwnership = %v", err)
+	}
+	tx, err = client.RenounceOwnership(walletsdk.ContractStakeWallet, chain.StakeAddress)
+	mined(t, chain, tx, err)
+
+	history, err := client.OwnershipHistory(&bind.FilterOpts{})
+	if err != nil {
+		t.Fatalf("OwnershipHistory: %v", err)
+	}
+	want := []walletsdk.OwnershipTransfer{
+		{Contract: walletsdk.ContractParityToken, NewOwner: chain.Owner.Address},
+		{Contract: walletsdk.ContractStakeWallet, NewOwner: chain.Owner.Address},
+		{Contract: walletsdk.ContractStakeWallet, PreviousOwner: chain.Owner.Address, NewOwner: alice.Address},
+		{Contract: walletsdk.ContractStakeWallet, PreviousOwner: alice.Address},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("OwnershipHistory returned %d events, want %d", len(history), len(want))
+	}
+	for i, event := range history {
+		if event.Contract != want[i].Contract || event.PreviousOwner != want[i].PreviousOwner || event.NewOwner != want[i].NewOwner {
+			t.Fatalf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+}
+
+func TestRecoverTokens(t *testing.T) {
+	chain := newChain(t)
+	alice := chain.Accounts[0]
+	owner := newClient(t, chain, chain.Owner)
+	client := newClient(t, chain, alice)
+
+	// Tokens sent straight to the contract are not credited to any device
+	tx, err := client.Transfer(chain.StakeAddress, tokens(7))
+	mined(t, chain, tx, err)
+
+	var notOwner *walletsdk.NotOwnerError
+	if _, err := client.RecoverTokens(chain.TokenAddress, tokens(7)); !errors.As(err, &notOwner) {
+		t.Fatalf("RecoverTokens by non-owner = %v, want NotOwnerError", err)
+	}
+
+	before, err := owner.GetBalance(chain.Owner.Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	tx, err = owner.RecoverTokens(chain.TokenAddress, tokens(7))
+	mined(t, chain, tx, err)
+	after, err := owner.GetBalance(chain.Owner.Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if diff := after.Sub(after, before); diff.Cmp(tokens(7)) != 0 {
+		t.Fatalf("owner received %s, want %s", diff, tokens(7))
+	}
+}
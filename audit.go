@@ -0,0 +1,416 @@
+package walletsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Audit events
+const (
+	AuditSign      = "sign"
+	AuditBroadcast = "broadcast"
+)
+
+// Audit outcomes
+const (
+	AuditSigned   = "signed"
+	AuditRejected = "rejected"
+	AuditSent     = "sent"
+	AuditFailed   = "failed"
+)
+
+// AuditEntry is a single hash-chained record of a signing or broadcast
+type AuditEntry struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Event     string            `json:"event"`
+	Outcome   string            `json:"outcome"`
+	Error     string            `json:"error,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	ChainID   *big.Int          `json:"chainId"`
+	From      common.Address    `json:"from"`
+	To        common.Address    `json:"to"`
+	Intent    *CallIntent       `json:"intent,omitempty"`
+	TxHash    common.Hash       `json:"txHash"`
+	Nonce     uint64            `json:"nonce"`
+	Gas       uint64            `json:"gas"`
+	GasPrice  *big.Int          `json:"gasPrice,omitempty"`
+	GasTipCap *big.Int          `json:"maxPriorityFeePerGas,omitempty"`
+	GasFeeCap *big.Int          `json:"maxFeePerGas,omitempty"`
+	PrevHash  common.Hash       `json:"prevHash"`
+	Hash      common.Hash       `json:"hash"`
+}
+
+// ComputeHash returns the chain hash of the entry, covering every field
+// except Hash itself
+func (e *AuditEntry) ComputeHash() (common.Hash, error) {
+	unhashed := *e
+	unhashed.Hash = common.Hash{}
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
+// AuditSink stores audit entries
+type AuditSink interface {
+	// Append durably stores the entry
+	Append(entry *AuditEntry) error
+	// Last returns the most recent entry, or nil if the sink is empty
+	Last() (*AuditEntry, error)
+}
+
+// AuditLog hash-chains entries and writes them to a sink
+type AuditLog struct {
+	// OnError is called with broadcast entries that could not be recorded.
+	// The transaction was sent, so the error is not returned to the caller.
+	OnError func(entry *AuditEntry, err error)
+
+	sink AuditSink
+
+	mu     sync.Mutex
+	seq    uint64
+	last   common.Hash
+	labels map[common.Hash]map[string]string
+}
+
+// NewAuditLog creates an audit log that continues the chain stored in sink
+func NewAuditLog(sink AuditSink) (*AuditLog, error) {
+	last, err := sink.Last()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last audit entry: %w", err)
+	}
+
+	log := &AuditLog{sink: sink, labels: make(map[common.Hash]map[string]string)}
+	if last != nil {
+		log.seq = last.Seq + 1
+		log.last = last.Hash
+	}
+	return log, nil
+}
+
+// Record links the entry to the chain and appends it to the sink
+func (l *AuditLog) Record(entry *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Seq = l.seq
+	entry.PrevHash = l.last
+
+	hash, err := entry.ComputeHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	if err := l.sink.Append(entry); err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	l.seq++
+	l.last = hash
+	return nil
+}
+
+// rememberLabels keeps the labels of a signed transaction until it is broadcast
+func (l *AuditLog) rememberLabels(hash common.Hash, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.labels[hash] = labels
+	l.mu.Unlock()
+}
+
+// takeLabels returns and forgets the labels of a signed transaction
+func (l *AuditLog) takeLabels(hash common.Hash) map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	labels := l.labels[hash]
+	delete(l.labels, hash)
+	return labels
+}
+
+// AuditChainError reports where an audit chain fails verification
+type AuditChainError struct {
+	Seq    uint64
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at entry %d: %s", e.Seq, e.Reason)
+}
+
+// VerifyAuditChain checks sequence numbers, entry hashes and links of a
+// complete audit chain, returning *AuditChainError at the first mismatch
+func VerifyAuditChain(entries []AuditEntry) error {
+	var prev common.Hash
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Seq != uint64(i) {
+			return &AuditChainError{Seq: entry.Seq, Reason: fmt.Sprintf("expected sequence %d", i)}
+		}
+		if entry.PrevHash != prev {
+			return &AuditChainError{Seq: entry.Seq, Reason: "previous hash does not match"}
+		}
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return &AuditChainError{Seq: entry.Seq, Reason: "entry hash does not match contents"}
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// FileAuditSink appends audit entries to a JSONL file
+type FileAuditSink struct {
+	file *jsonlFile
+}
+
+// NewFileAuditSink opens or creates a JSONL audit file
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := openJSONL(path, "audit")
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// Append writes the entry as a single line and syncs the file
+func (s *FileAuditSink) Append(entry *AuditEntry) error {
+	return s.file.append(entry)
+}
+
+// Last returns the last entry in the file
+func (s *FileAuditSink) Last() (*AuditEntry, error) {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+
+	entries, err := ReadAuditFile(s.file.path)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[len(entries)-1], nil
+}
+
+// Close closes the audit file
+func (s *FileAuditSink) Close() error {
+	return s.file.close()
+}
+
+// ReadAuditFile reads every entry of a JSONL audit file. A final line torn
+// by a crash during an append is skipped.
+func ReadAuditFile(path string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	if _, err := scanJSONL(path, "audit", "audit entry", func(entry *AuditEntry) {
+		entries = append(entries, *entry)
+	}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// VerifyAuditFile reads a JSONL audit file and verifies its chain
+func VerifyAuditFile(path string) error {
+	entries, err := ReadAuditFile(path)
+	if err != nil {
+		return err
+	}
+	return VerifyAuditChain(entries)
+}
+
+// Reconciliation states
+const (
+	ReconcileConfirmed = "confirmed"
+	ReconcileReverted  = "reverted"
+	ReconcilePending   = "pending"
+	ReconcileMissing   = "missing"
+)
+
+// AuditReconciliation is the on-chain state of a broadcast audit entry
+type AuditReconciliation struct {
+	Entry   AuditEntry
+	Status  string
+	Receipt *types.Receipt
+}
+
+// SetAuditLog sets the audit log that records every signing and broadcast
+func (c *Client) SetAuditLog(log *AuditLog) {
+	c.audit = log
+}
+
+// WithLabels returns a client that attaches labels to the audit entries of
+// every transaction it signs. The returned client shares all state with c.
+func (c *Client) WithLabels(labels map[string]string) *Client {
+	labeled := c.derive()
+	labeled.labels = make(map[string]string, len(c.labels)+len(labels))
+	for k, v := range c.labels {
+		labeled.labels[k] = v
+	}
+	for k, v := range labels {
+		labeled.labels[k] = v
+	}
+	return labeled
+}
+
+// derive returns a copy of c sharing all state, whose stake wallet signs
+// and reads through the copy
+func (c *Client) derive() *Client {
+	derived := *c
+	if c.stakeWallet != nil {
+		stakeWallet := *c.stakeWallet
+		stakeWallet.backend = &derived
+		stakeWallet.transactor = &derived
+		derived.stakeWallet = &stakeWallet
+	}
+	return &derived
+}
+
+// SendTransaction broadcasts a signed transaction, recording the outcome in
+// the audit log
+func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	err := c.Backend.SendTransaction(ctx, tx)
+	if err != nil && c.policy != nil && !isAlreadyKnown(err) {
+		c.policy.releaseTx(tx.Hash())
+	}
+	if err != nil {
+		c.logger.Error("transaction broadcast failed", "tx", tx.Hash(), "kind", c.txKind(tx), "nonce", tx.Nonce(), "error", err)
+	} else {
+		c.logger.Info("transaction broadcast", "tx", tx.Hash(), "kind", c.txKind(tx), "nonce", tx.Nonce())
+	}
+	if c.audit != nil {
+		from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		labels := c.audit.takeLabels(tx.Hash())
+		if labels == nil {
+			labels = c.labels
+		}
+		outcome := AuditSent
+		if err != nil {
+			outcome = AuditFailed
+		}
+		// A broadcast that succeeded must not look failed because its
+		// entry was lost, or the caller would sign and pay again
+		entry := c.auditEntry(AuditBroadcast, outcome, from, tx, labels, err)
+		if auditErr := c.audit.Record(entry); auditErr != nil {
+			c.logger.Error("failed to record broadcast in audit log", "tx", tx.Hash(), "nonce", tx.Nonce(), "error", auditErr)
+			if c.audit.OnError != nil {
+				c.audit.OnError(entry, auditErr)
+			}
+		}
+	}
+	return err
+}
+
+// auditSigner wraps a signer so every signing attempt is recorded
+func (c *Client) auditSigner(signer bind.SignerFn) bind.SignerFn {
+	labels := c.labels
+	return func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		signed, err := signer(from, tx)
+		if err != nil {
+			outcome := AuditFailed
+			var violation *PolicyViolationError
+			if errors.As(err, &violation) {
+				outcome = AuditRejected
+			}
+			if auditErr := c.recordAudit(AuditSign, outcome, from, tx, labels, err); auditErr != nil {
+				return nil, errors.Join(err, auditErr)
+			}
+			return nil, err
+		}
+
+		if err := c.recordAudit(AuditSign, AuditSigned, from, signed, labels, nil); err != nil {
+			return nil, err
+		}
+		c.audit.rememberLabels(signed.Hash(), labels)
+		return signed, nil
+	}
+}
+
+// recordAudit appends an entry describing tx to the audit log
+func (c *Client) recordAudit(event, outcome string, from common.Address, tx *types.Transaction, labels map[string]string, txErr error) error {
+	return c.audit.Record(c.auditEntry(event, outcome, from, tx, labels, txErr))
+}
+
+// auditEntry describes tx for the audit log
+func (c *Client) auditEntry(event, outcome string, from common.Address, tx *types.Transaction, labels map[string]string, txErr error) *AuditEntry {
+	entry := &AuditEntry{
+		Event:   event,
+		Outcome: outcome,
+		Labels:  labels,
+		ChainID: c.chainID,
+		From:    from,
+		TxHash:  tx.Hash(),
+		Nonce:   tx.Nonce(),
+		Gas:     tx.Gas(),
+	}
+	if txErr != nil {
+		entry.Error = txErr.Error()
+	}
+	if tx.To() != nil {
+		entry.To = *tx.To()
+		if contract := c.contractName(entry.To); contract != "" {
+			entry.Intent, _ = DecodeCallIntent(contract, tx.Data())
+		}
+	}
+	if tx.Type() == types.LegacyTxType {
+		entry.GasPrice = tx.GasPrice()
+	} else {
+		entry.GasTipCap = tx.GasTipCap()
+		entry.GasFeeCap = tx.GasFeeCap()
+	}
+	return entry
+}
+
+// ReconcileAudit looks up the receipts of successfully broadcast entries and
+// reports whether each transaction was confirmed, reverted, is still pending
+// or is unknown to the node
+func (c *Client) ReconcileAudit(ctx context.Context, entries []AuditEntry) ([]AuditReconciliation, error) {
+	var results []AuditReconciliation
+	for _, entry := range entries {
+		if entry.Event != AuditBroadcast || entry.Outcome != AuditSent {
+			continue
+		}
+
+		result := AuditReconciliation{Entry: entry}
+		receipt, err := c.TransactionReceipt(ctx, entry.TxHash)
+		switch {
+		case err == nil:
+			result.Receipt = receipt
+			result.Status = ReconcileConfirmed
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				result.Status = ReconcileReverted
+			}
+		case errors.Is(err, ethereum.NotFound):
+			_, _, err := c.TransactionByHash(ctx, entry.TxHash)
+			switch {
+			case err == nil:
+				result.Status = ReconcilePending
+			case errors.Is(err, ethereum.NotFound):
+				result.Status = ReconcileMissing
+			default:
+				return nil, fmt.Errorf("failed to look up transaction %s: %w", entry.TxHash.Hex(), err)
+			}
+		default:
+			return nil, fmt.Errorf("failed to fetch receipt for %s: %w", entry.TxHash.Hex(), err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,180 @@
+package walletsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestAuditChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	record := func(n int) {
+		t.Helper()
+		sink, err := walletsdk.NewFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("NewFileAuditSink: %v", err)
+		}
+		defer sink.Close()
+		log, err := walletsdk.NewAuditLog(sink)
+		if err != nil {
+			t.Fatalf("NewAuditLog: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			entry := &walletsdk.AuditEntry{Event: walletsdk.AuditSign, Outcome: walletsdk.AuditSigned, ChainID: big.NewInt(1337), Nonce: uint64(i)}
+			if err := log.Record(entry); err != nil {
+				t.Fatalf("Record: %v", err)
+			}
+		}
+	}
+
+	// A reopened log continues the chain
+	record(2)
+	record(1)
+	entries, err := walletsdk.ReadAuditFile(path)
+	if err != nil {
+		t.Fatalf("ReadAuditFile: %v", err)
+	}
+	if len(entries) != 3 || entries[2].Seq != 2 || entries[2].PrevHash != entries[1].Hash {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if err := walletsdk.VerifyAuditFile(path); err != nil {
+		t.Fatalf("VerifyAuditFile: %v", err)
+	}
+
+	// A crash halfway through an append leaves a torn final line, which is
+	// skipped and cut off before the chain continues
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":3,"event":"sig`)
+	file.Close()
+	if torn, err := walletsdk.ReadAuditFile(path); err != nil || len(torn) != 3 {
+		t.Fatalf("ReadAuditFile with a torn line: %d entries, %v", len(torn), err)
+	}
+	record(1)
+	if err := walletsdk.VerifyAuditFile(path); err != nil {
+		t.Fatalf("VerifyAuditFile after a torn line: %v", err)
+	}
+
+	// Rewriting, dropping or reordering entries breaks the chain
+	for name, broken := range map[string][]walletsdk.AuditEntry{
+		"rewritten": {entries[0], entries[1], {Seq: 2, Event: walletsdk.AuditBroadcast, PrevHash: entries[1].Hash, Hash: entries[2].Hash}},
+		"dropped":   {entries[0], entries[2]},
+		"reordered": {entries[1], entries[0], entries[2]},
+	} {
+		var chainErr *walletsdk.AuditChainError
+		if err := walletsdk.VerifyAuditChain(broken); !errors.As(err, &chainErr) {
+			t.Errorf("%s chain: %v", name, err)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := walletsdk.NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewFileAuditSink: %v", err)
+	}
+	defer sink.Close()
+	log, err := walletsdk.NewAuditLog(sink)
+	if err != nil {
+		t.Fatalf("NewAuditLog: %v", err)
+	}
+	client.SetAuditLog(log)
+
+	tx, err := client.WithLabels(map[string]string{"task": "42"}).Transfer(bob.Address, tokens(3))
+	mined(t, chain, tx, err)
+
+	entries, err := walletsdk.ReadAuditFile(path)
+	if err != nil {
+		t.Fatalf("ReadAuditFile: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	for i, event := range []string{walletsdk.AuditSign, walletsdk.AuditBroadcast} {
+		entry := entries[i]
+		if entry.Event != event || entry.TxHash != tx.Hash() || entry.Labels["task"] != "42" {
+			t.Fatalf("entry %d = %+v", i, entry)
+		}
+	}
+	if err := walletsdk.VerifyAuditFile(path); err != nil {
+		t.Fatalf("VerifyAuditFile: %v", err)
+	}
+
+	results, err := client.ReconcileAudit(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("ReconcileAudit: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != walletsdk.ReconcileConfirmed {
+		t.Fatalf("ReconcileAudit = %+v", results)
+	}
+
+	// Rewriting any entry breaks the chain
+	entries[0].Intent.Args[1].Value = "1"
+	var lines []string
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := walletsdk.VerifyAuditFile(path); err == nil {
+		t.Fatal("VerifyAuditFile accepted a rewritten entry")
+	}
+}
+
+// brokenAuditSink stores sign entries and fails every broadcast entry
+type brokenAuditSink struct {
+	walletsdk.AuditSink
+}
+
+func (s brokenAuditSink) Append(entry *walletsdk.AuditEntry) error {
+	if entry.Event == walletsdk.AuditBroadcast {
+		return errors.New("disk full")
+	}
+	return s.AuditSink.Append(entry)
+}
+
+func TestAuditBroadcastNotRecorded(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	sink, err := walletsdk.NewFileAuditSink(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("NewFileAuditSink: %v", err)
+	}
+	defer sink.Close()
+	log, err := walletsdk.NewAuditLog(brokenAuditSink{sink})
+	if err != nil {
+		t.Fatalf("NewAuditLog: %v", err)
+	}
+	var lost []*walletsdk.AuditEntry
+	log.OnError = func(entry *walletsdk.AuditEntry, err error) { lost = append(lost, entry) }
+	client.SetAuditLog(log)
+
+	// The transfer was sent, so it succeeds even though its entry is lost
+	tx, err := client.Transfer(bob.Address, tokens(3))
+	mined(t, chain, tx, err)
+	if len(lost) != 1 || lost[0].TxHash != tx.Hash() || lost[0].Outcome != walletsdk.AuditSent {
+		t.Fatalf("lost entries = %+v", lost)
+	}
+	expectBalance(t, client, tokens(1003), bob)
+}
@@ -0,0 +1,406 @@
+package walletsdk
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CacheOptions configures the read cache of a Client. Zero values use the
+// defaults noted on each field.
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached block-dependent results, 1024
+	// by default. The least recently used entry is evicted first.
+	MaxEntries int
+	// TTL expires block-dependent results after this long even when no
+	// event touched them. Zero keeps them until invalidated.
+	TTL time.Duration
+	// HeadInterval is the minimum time between checks for a new head, 1s
+	// by default. Cached reads may trail the chain by up to this long,
+	// except after the client fetched a newer receipt. A negative interval
+	// checks on every read.
+	HeadInterval time.Duration
+}
+
+func (o CacheOptions) withDefaults() CacheOptions {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 1024
+	}
+	if o.HeadInterval == 0 {
+		o.HeadInterval = time.Second
+	}
+	return o
+}
+
+// CacheStats counts read cache activity
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Invalidations counts entries dropped because an event, a reorg or a
+	// new head touched them
+	Invalidations uint64
+}
+
+var (
+	transferEventID       = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	fundsAddedEventID     = crypto.Keccak256Hash([]byte("FundsAdded(string,address,uint256)"))
+	fundsWithdrawnEventID = crypto.Keccak256Hash([]byte("FundsWithdrawn(string,address,uint256)"))
+	taskPaymentEventID    = crypto.Keccak256Hash([]byte("TaskPayment(string,string,uint256)"))
+)
+
+// Cache tags name the state a cached result depends on. Events touching the
+// state invalidate every entry with the tag.
+const (
+	supplyTag = "supply"
+	// headTag marks results without an event, which are dropped on every
+	// new head
+	headTag = "head"
+)
+
+func balanceTag(addr common.Address) string {
+	return "balance:" + addr.Hex()
+}
+
+// deviceTag uses the hash of the device ID, which is how the indexed string
+// appears in stake events
+func deviceTag(deviceID string) string {
+	return deviceTopicTag(crypto.Keccak256Hash([]byte(deviceID)))
+}
+
+func deviceTopicTag(topic common.Hash) string {
+	return "device:" + topic.Hex()
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	tags    []string
+	expires time.Time
+}
+
+// readCache caches contract reads pinned to the block it last saw as head.
+// When the head moves it fetches the token and stake logs of the new blocks
+// and drops only the entries whose tags the events touch, so results stay
+// cached across blocks that do not change them.
+type readCache struct {
+	backend   Backend
+	options   CacheOptions
+	metrics   Metrics
+	addresses []common.Address
+
+	// syncMu serializes head checks
+	syncMu  sync.Mutex
+	checked time.Time
+
+	mu        sync.Mutex
+	head      *types.Header
+	stale     bool
+	version   uint64
+	entries   map[string]*list.Element
+	lru       *list.List
+	tags      map[string]map[string]struct{}
+	permanent map[string]interface{}
+
+	hits, misses, evictions, invalidations atomic.Uint64
+}
+
+func newReadCache(backend Backend, options CacheOptions, metrics Metrics, addresses ...common.Address) *readCache {
+	return &readCache{
+		backend:   backend,
+		options:   options.withDefaults(),
+		metrics:   metrics,
+		addresses: addresses,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		tags:      make(map[string]map[string]struct{}),
+		permanent: make(map[string]interface{}),
+	}
+}
+
+func (rc *readCache) stats() CacheStats {
+	return CacheStats{
+		Hits:          rc.hits.Load(),
+		Misses:        rc.misses.Load(),
+		Evictions:     rc.evictions.Load(),
+		Invalidations: rc.invalidations.Load(),
+	}
+}
+
+func (rc *readCache) hit() {
+	rc.hits.Add(1)
+	rc.metrics.Add(MetricCacheRequests, 1, map[string]string{"result": "hit"})
+}
+
+func (rc *readCache) miss() {
+	rc.misses.Add(1)
+	rc.metrics.Add(MetricCacheRequests, 1, map[string]string{"result": "miss"})
+}
+
+// observe makes the next read check for a new head when number is past the
+// cached head
+func (rc *readCache) observe(number *big.Int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if number != nil && rc.head != nil && number.Cmp(rc.head.Number) > 0 {
+		rc.stale = true
+	}
+}
+
+// sync moves the cache to the current head and returns it along with the
+// cache version reads must present when storing results
+func (rc *readCache) sync(ctx context.Context) (*big.Int, uint64, error) {
+	rc.syncMu.Lock()
+	defer rc.syncMu.Unlock()
+
+	rc.mu.Lock()
+	head, stale := rc.head, rc.stale
+	rc.mu.Unlock()
+	if head != nil && !stale && time.Since(rc.checked) < rc.options.HeadInterval {
+		return head.Number, rc.currentVersion(), nil
+	}
+
+	latest, err := rc.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get head: %w", err)
+	}
+	rc.checked = time.Now()
+
+	var touched map[string]struct{}
+	purge := false
+	switch {
+	case head == nil || latest.Hash() == head.Hash():
+	case latest.Number.Cmp(head.Number) <= 0:
+		// A reorg or a lagging endpoint, there is no cheap way to tell
+		// which results are still valid
+		purge = true
+	default:
+		touched, err = rc.touched(ctx, head, latest)
+		if err != nil {
+			purge = true
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if head != nil && latest.Hash() != head.Hash() {
+		if purge {
+			rc.purge()
+		} else {
+			touched[headTag] = struct{}{}
+			rc.invalidate(touched)
+		}
+		rc.version++
+	}
+	rc.head = latest
+	rc.stale = false
+	return latest.Number, rc.version, nil
+}
+
+func (rc *readCache) currentVersion() uint64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.version
+}
+
+// touched returns the tags of state changed by events after head up to
+// latest. It fails when head is no longer part of the chain.
+func (rc *readCache) touched(ctx context.Context, head, latest *types.Header) (map[string]struct{}, error) {
+	canonical, err := rc.backend.HeaderByNumber(ctx, head.Number)
+	if err != nil {
+		return nil, err
+	}
+	if canonical.Hash() != head.Hash() {
+		return nil, fmt.Errorf("block %s was reorganized", head.Number)
+	}
+
+	logs, err := rc.backend.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).Add(head.Number, big.NewInt(1)),
+		ToBlock:   latest.Number,
+		Addresses: rc.addresses,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	touched := make(map[string]struct{})
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch log.Topics[0] {
+		case transferEventID:
+			if len(log.Topics) < 3 {
+				continue
+			}
+			from := common.BytesToAddress(log.Topics[1].Bytes())
+			to := common.BytesToAddress(log.Topics[2].Bytes())
+			touched[balanceTag(from)] = struct{}{}
+			touched[balanceTag(to)] = struct{}{}
+			if from == (common.Address{}) || to == (common.Address{}) {
+				touched[supplyTag] = struct{}{}
+			}
+		case fundsAddedEventID, fundsWithdrawnEventID, taskPaymentEventID:
+			for _, topic := range log.Topics[1:] {
+				touched[deviceTopicTag(topic)] = struct{}{}
+			}
+		}
+	}
+	return touched, nil
+}
+
+// get returns a cached result. rc.mu must not be held.
+func (rc *readCache) get(key string) (interface{}, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if v, ok := rc.permanent[key]; ok {
+		return v, true
+	}
+	elem, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		rc.remove(elem)
+		return nil, false
+	}
+	rc.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+// put stores a result read at the head of version. Results of reads that
+// raced with a head change are dropped, as they may predate invalidations.
+func (rc *readCache) put(key string, value interface{}, tags []string, version uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if version != rc.version {
+		return
+	}
+	if elem, ok := rc.entries[key]; ok {
+		rc.remove(elem)
+	}
+	entry := &cacheEntry{key: key, value: value, tags: tags}
+	if rc.options.TTL > 0 {
+		entry.expires = time.Now().Add(rc.options.TTL)
+	}
+	rc.entries[key] = rc.lru.PushFront(entry)
+	for _, tag := range tags {
+		if rc.tags[tag] == nil {
+			rc.tags[tag] = make(map[string]struct{})
+		}
+		rc.tags[tag][key] = struct{}{}
+	}
+	for rc.lru.Len() > rc.options.MaxEntries {
+		rc.remove(rc.lru.Back())
+		rc.evictions.Add(1)
+	}
+}
+
+func (rc *readCache) putPermanent(key string, value interface{}) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.permanent[key] = value
+}
+
+// invalidate drops every entry carrying one of tags. rc.mu must be held.
+func (rc *readCache) invalidate(tags map[string]struct{}) {
+	for tag := range tags {
+		for key := range rc.tags[tag] {
+			if elem, ok := rc.entries[key]; ok {
+				rc.remove(elem)
+				rc.invalidations.Add(1)
+			}
+		}
+	}
+}
+
+// purge drops every block-dependent entry. rc.mu must be held.
+func (rc *readCache) purge() {
+	rc.invalidations.Add(uint64(rc.lru.Len()))
+	rc.entries = make(map[string]*list.Element)
+	rc.lru.Init()
+	rc.tags = make(map[string]map[string]struct{})
+}
+
+// remove drops one entry. rc.mu must be held.
+func (rc *readCache) remove(elem *list.Element) {
+	entry := rc.lru.Remove(elem).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	for _, tag := range entry.tags {
+		delete(rc.tags[tag], entry.key)
+		if len(rc.tags[tag]) == 0 {
+			delete(rc.tags, tag)
+		}
+	}
+}
+
+// cachedRead returns the result of read at the cached head, calling it on a
+// miss. Without a cache, or when the head is unavailable, it reads latest.
+func cachedRead[T any](rc *readCache, tags []string, read func(opts *bind.CallOpts) (T, error), method string, args ...interface{}) (T, error) {
+	if rc == nil {
+		return read(&bind.CallOpts{})
+	}
+	head, version, err := rc.sync(context.Background())
+	if err != nil {
+		return read(&bind.CallOpts{})
+	}
+	key := fmt.Sprintf("%s %v", method, args)
+	if v, ok := rc.get(key); ok {
+		rc.hit()
+		return cloneValue(v).(T), nil
+	}
+	rc.miss()
+	v, err := read(&bind.CallOpts{BlockNumber: head})
+	if err != nil {
+		return v, err
+	}
+	rc.put(key, cloneValue(v), tags, version)
+	return v, nil
+}
+
+// cachedConstant returns a result that never changes, such as the token
+// name, calling read only on the first miss
+func cachedConstant[T any](rc *readCache, read func(opts *bind.CallOpts) (T, error), method string) (T, error) {
+	if rc == nil {
+		return read(&bind.CallOpts{})
+	}
+	if v, ok := rc.get(method); ok {
+		rc.hit()
+		return cloneValue(v).(T), nil
+	}
+	rc.miss()
+	v, err := read(&bind.CallOpts{})
+	if err != nil {
+		return v, err
+	}
+	rc.putPermanent(method, cloneValue(v))
+	return v, nil
+}
+
+// cloneValue copies the mutable parts of a cached result, so callers never
+// share a *big.Int with the cache or with each other
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *big.Int:
+		if v == nil {
+			return v
+		}
+		return new(big.Int).Set(v)
+	case StakeInfo:
+		v.Amount, _ = cloneValue(v.Amount).(*big.Int)
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,201 @@
+package walletsdk_test
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+// countedCalls counts the contract calls that reach the chain
+type countedCalls struct {
+	walletsdk.Backend
+	calls atomic.Int32
+}
+
+func (c *countedCalls) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	return c.Backend.CallContract(ctx, call, blockNumber)
+}
+
+func newCachedClient(t *testing.T, chain *simulated.Chain, account simulated.Account, options walletsdk.CacheOptions) (*walletsdk.Client, *countedCalls) {
+	t.Helper()
+	backend := &countedCalls{Backend: chain.Backend.Client()}
+	config := chain.Config(account)
+	config.Cache = &options
+	client, err := walletsdk.NewClientWithBackend(backend, config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	return client, backend
+}
+
+func TestCacheTokenInfoIsPermanent(t *testing.T) {
+	chain := newChain(t)
+	client, backend := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{HeadInterval: -1})
+
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := client.GetTokenInfo(); err != nil {
+			t.Fatalf("GetTokenInfo: %v", err)
+		}
+		// New blocks do not expire immutable results
+		tx, err := client.Transfer(chain.Accounts[1].Address, big.NewInt(1))
+		mined(t, chain, tx, err)
+	}
+	if calls := backend.calls.Load(); calls != 3 {
+		t.Fatalf("GetTokenInfo made %d calls over three reads, want 3", calls)
+	}
+	if stats := client.CacheStats(); stats.Hits != 6 || stats.Misses != 3 {
+		t.Fatalf("cache stats = %+v, want 6 hits and 3 misses", stats)
+	}
+}
+
+func TestCacheInvalidatesOnEvents(t *testing.T) {
+	chain := newChain(t)
+	client, backend := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{HeadInterval: -1})
+	owner := newClient(t, chain, chain.Owner)
+	sender := newClient(t, chain, chain.Accounts[1])
+	recipient, bystander := chain.Accounts[2], chain.Accounts[0]
+
+	readAll := func() (recipientBalance, bystanderBalance, supply *big.Int) {
+		t.Helper()
+		var err error
+		if recipientBalance, err = client.GetBalance(recipient.Address); err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		if bystanderBalance, err = client.GetBalance(bystander.Address); err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		if supply, err = client.GetTotalSupply(); err != nil {
+			t.Fatalf("GetTotalSupply: %v", err)
+		}
+		return
+	}
+
+	before, _, supply := readAll()
+	readAll()
+	if calls := backend.calls.Load(); calls != 3 {
+		t.Fatalf("repeated reads made %d calls, want 3", calls)
+	}
+
+	// A transfer invalidates only the balances it touches
+	tx, err := sender.Transfer(recipient.Address, tokens(2))
+	mined(t, chain, tx, err)
+	after, _, _ := readAll()
+	if want := new(big.Int).Add(before, tokens(2)); after.Cmp(want) != 0 {
+		t.Fatalf("cached balance after transfer = %s, want %s", after, want)
+	}
+	if calls := backend.calls.Load(); calls != 4 {
+		t.Fatalf("reads after transfer made %d new calls, want 1", calls-3)
+	}
+
+	// Minting changes the supply
+	tx, err = owner.Mint(bystander.Address, tokens(1))
+	mined(t, chain, tx, err)
+	_, _, newSupply := readAll()
+	if want := new(big.Int).Add(supply, tokens(1)); newSupply.Cmp(want) != 0 {
+		t.Fatalf("cached supply after mint = %s, want %s", newSupply, want)
+	}
+}
+
+func TestCacheStakeEvents(t *testing.T) {
+	chain := newChain(t)
+	client, _ := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{HeadInterval: -1})
+	staker := newClient(t, chain, chain.Accounts[1])
+
+	tx, err := staker.AddFunds(tokens(5), "device-1")
+	mined(t, chain, tx, err)
+	balance, err := client.GetStakeBalance("device-1")
+	if err != nil || balance.Cmp(tokens(5)) != 0 {
+		t.Fatalf("GetStakeBalance = %v, %v, want %s", balance, err, tokens(5))
+	}
+
+	tx, err = staker.AddFunds(tokens(3), "device-1")
+	mined(t, chain, tx, err)
+	balance, err = client.GetStakeBalance("device-1")
+	if err != nil || balance.Cmp(tokens(8)) != 0 {
+		t.Fatalf("GetStakeBalance after FundsAdded = %v, %v, want %s", balance, err, tokens(8))
+	}
+
+	tx, err = staker.UpdateWalletAddress("device-1", chain.Accounts[2].Address)
+	mined(t, chain, tx, err)
+	info, err := client.GetStakeInfo("device-1")
+	if err != nil || info.WalletAddress != chain.Accounts[2].Address {
+		t.Fatalf("GetStakeInfo after wallet update = %+v, %v", info, err)
+	}
+}
+
+func TestCacheReturnsCopies(t *testing.T) {
+	chain := newChain(t)
+	client, _ := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{HeadInterval: -1})
+	tx, err := client.AddFunds(tokens(5), "device-1")
+	mined(t, chain, tx, err)
+
+	// Callers mutating a result, on a miss or a hit, leave the cache intact
+	for i := 0; i < 2; i++ {
+		balance, err := client.GetBalance(chain.Accounts[0].Address)
+		if err != nil || balance.Cmp(tokens(995)) != 0 {
+			t.Fatalf("read %d: GetBalance = %v, %v", i, balance, err)
+		}
+		balance.SetInt64(0)
+		info, err := client.GetStakeInfo("device-1")
+		if err != nil || info.Amount.Cmp(tokens(5)) != 0 {
+			t.Fatalf("read %d: GetStakeInfo = %+v, %v", i, info, err)
+		}
+		info.Amount.SetInt64(0)
+	}
+	if stats := client.CacheStats(); stats.Hits == 0 {
+		t.Fatalf("cache stats = %+v, want hits", stats)
+	}
+}
+
+func TestCacheCatchesUpOnReceipts(t *testing.T) {
+	chain := newChain(t)
+	// Without receipts the cache would not look for a new head for an hour
+	client, _ := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{HeadInterval: time.Hour})
+	recipient := chain.Accounts[1]
+
+	before, err := client.GetBalance(recipient.Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	tx, err := client.Transfer(recipient.Address, tokens(1))
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if _, err := bind.WaitMined(context.Background(), client, tx); err != nil {
+		t.Fatalf("WaitMined: %v", err)
+	}
+	expectBalance(t, client, new(big.Int).Add(before, tokens(1)), recipient)
+}
+
+func TestCacheSizeAndTTL(t *testing.T) {
+	chain := newChain(t)
+	client, _ := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{MaxEntries: 2, HeadInterval: -1})
+	for _, account := range chain.Accounts {
+		if _, err := client.GetBalance(account.Address); err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+	}
+	if stats := client.CacheStats(); stats.Evictions != uint64(len(chain.Accounts)-2) {
+		t.Fatalf("cache stats = %+v, want %d evictions", stats, len(chain.Accounts)-2)
+	}
+
+	client, backend := newCachedClient(t, chain, chain.Accounts[0], walletsdk.CacheOptions{TTL: time.Millisecond, HeadInterval: -1})
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetBalance(chain.Owner.Address); err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls := backend.calls.Load(); calls != 2 {
+		t.Fatalf("expired entry served %d calls, want 2", calls)
+	}
+}
@@ -2,11 +2,14 @@
 package walletsdk
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"fmt"
+	"log/slog"
 	"math/big"
 	"strings"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -14,15 +17,42 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// Backend is the chain access a Client needs. *ethclient.Client and the
+// go-ethereum simulated backend client both implement it.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ethereum.TransactionReader
+	ethereum.ChainIDReader
+}
+
+// Transactor supplies signed transaction options for write operations
+type Transactor interface {
+	GetTransactOpts() (*bind.TransactOpts, error)
+}
+
 // Client represents a unified Parity SDK client
 type Client struct {
-	*ethclient.Client
-	chainID     *big.Int
-	auth        *bind.TransactOpts
-	privateKey  *ecdsa.PrivateKey
-	address     common.Address
-	token       *ParityToken
-	stakeWallet *StakeWallet
+	Backend
+	chainID      *big.Int
+	auth         *bind.TransactOpts
+	privateKey   *ecdsa.PrivateKey
+	address      common.Address
+	tokenAddress common.Address
+	token        *ParityToken
+	stakeWallet  *StakeWallet
+	policy       *Policy
+	audit        *AuditLog
+	labels       map[string]string
+	cache        *readCache
+	logger       *slog.Logger
+	fees         *FeePolicy
+	tracer       Tracer
+	metrics      Metrics
+	// authorizations holds the payment authorizations the client paid
+	authorizations *usedAuthorizations
+	// opCtx is the context of the operation span of a traced copy
+	opCtx context.Context
 }
 
 // ClientConfig represents the configuration for creating a new client
@@ -32,25 +62,124 @@ type ClientConfig struct {
 	TokenAddress common.Address
 	StakeAddress common.Address
 	PrivateKey   string
+	// Fees fixes or caps the fees of every transaction the client signs
+	Fees *FeePolicy
+	// Policy is checked before every transaction is signed
+	Policy *Policy
+	// Audit records every signing and broadcast
+	Audit *AuditLog
+	// Verify, when set, checks the chain ID and contracts on creation
+	Verify *VerifyOptions
+	// Endpoints, when set, replace RPCURL with several nodes used through a
+	// FailoverBackend
+	Endpoints []Endpoint
+	// Failover configures health probing and hedging of Endpoints
+	Failover FailoverOptions
+	// Retry, when set, retries requests that fail with transient errors
+	Retry *RetryPolicy
+	// RateLimit, when set, limits the rate of requests sent to the node
+	RateLimit *RateLimitOptions
+	// CoalesceReads shares one request between identical concurrent reads
+	CoalesceReads bool
+	// Cache, when set, caches token and stake reads between blocks
+	Cache *CacheOptions
+	// Metrics receives RPC, transaction and cache metrics
+	Metrics Metrics
+	// Tracer starts a span for every RPC request
+	Tracer Tracer
+	// Logger receives structured records. Info covers connections,
+	// broadcasts and waits, Warn covers retries, failovers and policy
+	// rejections, and Debug adds every RPC request and signature.
+	Logger *slog.Logger
+	// LogRedact lists attribute keys redacted in addition to
+	// DefaultRedactedFields
+	LogRedact []string
 }
 
-// NewClient creates a new Parity SDK client
+// NewClient creates a new Parity SDK client connected to config.RPCURL, or
+// to config.Endpoints when set
 func NewClient(config ClientConfig) (*Client, error) {
+	backend, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClientWithBackend(backend, config)
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// closingBackend is a Backend owning its connections
+type closingBackend interface {
+	Backend
+	Close()
+}
+
+func dial(config ClientConfig) (closingBackend, error) {
+	logger := newLogger(config.Logger, config.LogRedact)
+	if len(config.Endpoints) > 0 {
+		if config.Failover.Logger == nil {
+			config.Failover.Logger = logger
+		}
+		if config.Failover.ChainID == 0 {
+			config.Failover.ChainID = config.ChainID
+		}
+		return DialFailover(context.Background(), config.Endpoints, config.Failover)
+	}
+	logger.Info("connecting to RPC endpoint", "url", redactURL(config.RPCURL))
 	ethClient, err := ethclient.Dial(config.RPCURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to Ethereum client: %w", err)
 	}
+	return ethClient, nil
+}
 
-	token, err := NewParityToken(config.TokenAddress, ethClient)
+// NewClientWithBackend creates a new Parity SDK client over an existing
+// backend. config.RPCURL is ignored, and the chain ID is fetched from the
+// backend when config.ChainID is zero.
+func NewClientWithBackend(backend Backend, config ClientConfig) (*Client, error) {
+	backend, err := wrapBackend(backend, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token contract: %w", err)
+		return nil, err
+	}
+
+	chainID := big.NewInt(config.ChainID)
+	if config.ChainID == 0 {
+		id, err := backend.ChainID(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain ID: %w", err)
+		}
+		chainID = id
 	}
 
 	client := &Client{
-		Client:  ethClient,
-		chainID: big.NewInt(config.ChainID),
-		token:   token,
+		Backend:      backend,
+		chainID:      chainID,
+		tokenAddress: config.TokenAddress,
+		policy:       config.Policy,
+		audit:        config.Audit,
+		logger:       newLogger(config.Logger, config.LogRedact),
+		fees:         config.Fees,
+		tracer:       config.Tracer,
+		metrics:      metricsOrNop(config.Metrics),
+
+		authorizations: &usedAuthorizations{used: make(map[authorizationKey]int64)},
 	}
+	if config.Fees != nil {
+		if err := config.Fees.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid fee policy: %w", err)
+		}
+	}
+
+	// Bind through the client so broadcasts pass its SendTransaction
+	token, err := NewParityToken(config.TokenAddress, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token contract: %w", err)
+	}
+	client.token = token
 
 	if config.PrivateKey != "" {
 		if err := client.SetPrivateKey(config.PrivateKey); err != nil {
@@ -59,16 +188,72 @@ func NewClient(config ClientConfig) (*Client, error) {
 	}
 
 	if config.StakeAddress != (common.Address{}) {
-		stakeWallet, err := NewStakeWallet(client, config.StakeAddress, config.TokenAddress)
+		stakeWallet, err := NewStakeWallet(client, client, config.StakeAddress, config.TokenAddress)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create stake wallet: %w", err)
 		}
+		stakeWallet.logger = client.logger
 		client.stakeWallet = stakeWallet
 	}
 
+	if config.Cache != nil {
+		watched := []common.Address{config.TokenAddress}
+		if client.stakeWallet != nil {
+			watched = append(watched, config.StakeAddress)
+		}
+		client.cache = newReadCache(client.Backend, *config.Cache, client.metrics, watched...)
+	}
+
+	if config.Verify != nil {
+		if _, err := client.Verify(context.Background(), *config.Verify); err != nil {
+			return nil, err
+		}
+	}
+
+	client.logger.Info("client ready", "chain_id", chainID, "address", client.address,
+		"token", config.TokenAddress, "stake", config.StakeAddress)
 	return client, nil
 }
 
+// wrapBackend layers the middleware enabled in config over backend. Retries
+// pass the rate limiter, coalesced reads share retries, and instrumentation
+// sees every request that reaches the node.
+func wrapBackend(backend Backend, config ClientConfig) (Backend, error) {
+	logger := newLogger(config.Logger, config.LogRedact)
+	if config.Metrics != nil || config.Tracer != nil || config.Logger != nil {
+		contracts := map[common.Address]string{config.TokenAddress: ContractParityToken}
+		if config.StakeAddress != (common.Address{}) {
+			contracts[config.StakeAddress] = ContractStakeWallet
+		}
+		backend = newInstrumentedBackend(backend, metricsOrNop(config.Metrics), tracerOrNop(config.Tracer), logger, contracts)
+	}
+	if config.RateLimit != nil {
+		limited, err := NewRateLimitBackend(backend, *config.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		backend = limited
+	}
+	if config.Retry != nil {
+		policy := *config.Retry
+		if policy.Logger == nil {
+			policy.Logger = logger
+		}
+		backend = NewRetryBackend(backend, policy)
+	}
+	if config.CoalesceReads {
+		backend = NewCoalescingBackend(backend)
+	}
+	return backend, nil
+}
+
+// Close closes the backend connection if the backend supports closing
+func (c *Client) Close() {
+	if closer, ok := c.Backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
 // SetPrivateKey sets the private key for the client
 func (c *Client) SetPrivateKey(privateKey string) error {
 	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKey, "0x"))
@@ -98,29 +283,92 @@ func (c *Client) GetTransactOpts() (*bind.TransactOpts, error) {
 	if c.auth == nil {
 		return nil, fmt.Errorf("wallet not authenticated")
 	}
-	return c.auth, nil
+	debug := c.logger.Enabled(context.Background(), slog.LevelDebug)
+	if c.policy == nil && c.audit == nil && c.fees == nil && c.opCtx == nil && !debug {
+		return c.auth, nil
+	}
+	opts := *c.auth
+	if c.opCtx != nil {
+		opts.Context = c.opCtx
+	}
+	if debug {
+		opts.Signer = c.logSigner(opts.Signer)
+	}
+	if c.fees != nil {
+		c.fees.apply(&opts)
+	}
+	if c.policy != nil {
+		opts.Signer = c.policySigner(opts.Signer)
+	}
+	if c.audit != nil {
+		opts.Signer = c.auditSigner(opts.Signer)
+	}
+	return &opts, nil
+}
+
+// SetPolicy sets the spending policy checked before every transaction is signed
+func (c *Client) SetPolicy(policy *Policy) {
+	c.policy = policy
+}
+
+// contractName returns the name of the SDK contract deployed at addr
+func (c *Client) contractName(addr common.Address) string {
+	switch {
+	case addr == c.tokenAddress:
+		return ContractParityToken
+	case c.stakeWallet != nil && addr == c.stakeWallet.contract.address:
+		return ContractStakeWallet
+	default:
+		return ""
+	}
+}
+
+// CacheStats returns the activity of the read cache, which is zero when
+// ClientConfig.Cache is unset
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.stats()
+}
+
+// TransactionReceipt returns the receipt of a mined transaction. A receipt
+// from a block past the cached head makes the next cached read catch up.
+func (c *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := c.Backend.TransactionReceipt(ctx, txHash)
+	if err == nil && c.cache != nil {
+		c.cache.observe(receipt.BlockNumber)
+	}
+	return receipt, err
+}
+
+// PendingCallContract executes a call against the pending state, which
+// bindings use for CallOpts with Pending set. It fails with
+// bind.ErrNoPendingState when the backend has no pending state.
+func (c *Client) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return pendingCall(ctx, c.Backend, call)
 }
 
 // GetBalance returns the token balance for an address
 func (c *Client) GetBalance(address common.Address) (*big.Int, error) {
-	return c.token.BalanceOf(&bind.CallOpts{}, address)
+	return cachedRead(c.cache, []string{balanceTag(address)}, func(opts *bind.CallOpts) (*big.Int, error) {
+		return c.token.BalanceOf(opts, address)
+	}, "balanceOf", address)
 }
 
 // GetTokenInfo returns token information
 func (c *Client) GetTokenInfo() (name string, symbol string, decimals uint8, err error) {
-	opts := &bind.CallOpts{}
-
-	name, err = c.token.Name(opts)
+	name, err = cachedConstant(c.cache, c.token.Name, "ParityToken.name")
 	if err != nil {
 		return "", "", 0, err
 	}
 
-	symbol, err = c.token.Symbol(opts)
+	symbol, err = cachedConstant(c.cache, c.token.Symbol, "ParityToken.symbol")
 	if err != nil {
 		return "", "", 0, err
 	}
 
-	decimals, err = c.token.Decimals(opts)
+	decimals, err = cachedConstant(c.cache, c.token.Decimals, "ParityToken.decimals")
 	if err != nil {
 		return "", "", 0, err
 	}
@@ -135,70 +383,84 @@ func (c *Client) GetAllowance(owner, spender common.Address) (*big.Int, error) {
 
 // GetTotalSupply returns the total token supply
 func (c *Client) GetTotalSupply() (*big.Int, error) {
-	return c.token.TotalSupply(&bind.CallOpts{})
+	return cachedRead(c.cache, []string{supplyTag}, c.token.TotalSupply, "totalSupply")
 }
 
 // Transfer transfers tokens to an address
 func (c *Client) Transfer(to common.Address, amount *big.Int) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.Transfer(opts, to, amount)
+	return c.traceTx("Transfer", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.Transfer(opts, to, amount)
+	})
 }
 
 // Approve approves tokens for a spender
 func (c *Client) Approve(spender common.Address, amount *big.Int) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.Approve(opts, spender, amount)
+	return c.traceTx("Approve", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.Approve(opts, spender, amount)
+	})
 }
 
 // TransferFrom transfers tokens from one address to another
 func (c *Client) TransferFrom(from, to common.Address, amount *big.Int) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.TransferFrom(opts, from, to, amount)
+	return c.traceTx("TransferFrom", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.TransferFrom(opts, from, to, amount)
+	})
 }
 
 // Mint mints new tokens
 func (c *Client) Mint(to common.Address, amount *big.Int) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.Mint(opts, to, amount)
+	return c.traceTx("Mint", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.Mint(opts, to, amount)
+	})
 }
 
 // Burn burns tokens
 func (c *Client) Burn(amount *big.Int) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.Burn(opts, amount)
+	return c.traceTx("Burn", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.Burn(opts, amount)
+	})
 }
 
 // TransferWithData transfers tokens with additional data
 func (c *Client) TransferWithData(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.TransferWithData(opts, to, amount, data)
+	return c.traceTx("TransferWithData", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.TransferWithData(opts, to, amount, data)
+	})
 }
 
 // TransferWithDataAndCallback transfers tokens with data and callback
 func (c *Client) TransferWithDataAndCallback(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error) {
-	opts, err := c.GetTransactOpts()
-	if err != nil {
-		return nil, err
-	}
-	return c.token.TransferWithDataAndCallback(opts, to, amount, data)
+	return c.traceTx("TransferWithDataAndCallback", func(c *Client) (*types.Transaction, error) {
+		opts, err := c.GetTransactOpts()
+		if err != nil {
+			return nil, err
+		}
+		return c.token.TransferWithDataAndCallback(opts, to, amount, data)
+	})
 }
 
 // GetStakeInfo retrieves stake information for a device ID
@@ -206,23 +468,39 @@ func (c *Client) GetStakeInfo(deviceID string) (StakeInfo, error) {
 	if c.stakeWallet == nil {
 		return StakeInfo{}, fmt.Errorf("stake wallet not initialized")
 	}
-	return c.stakeWallet.GetStakeInfo(deviceID)
+	// The contract emits no event when a wallet address changes, so stake
+	// info is refreshed on every new head
+	return cachedRead(c.cache, []string{deviceTag(deviceID), headTag}, func(opts *bind.CallOpts) (StakeInfo, error) {
+		return c.stakeWallet.stakeInfo(opts, deviceID)
+	}, "getWalletInfo", deviceID)
 }
 
-// AddFunds adds funds to a device's wallet
-func (c *Client) AddFunds(amount *big.Int, deviceID string) (*types.Transaction, error) {
+// GetStakeToken returns the token the stake contract accepts
+func (c *Client) GetStakeToken() (common.Address, error) {
 	if c.stakeWallet == nil {
-		return nil, fmt.Errorf("stake wallet not initialized")
+		return common.Address{}, fmt.Errorf("stake wallet not initialized")
 	}
-	return c.stakeWallet.Stake(amount, deviceID)
+	return cachedConstant(c.cache, c.stakeWallet.contract.Token, "StakeWallet.token")
+}
+
+// AddFunds adds funds to a device's wallet
+func (c *Client) AddFunds(amount *big.Int, deviceID string) (*types.Transaction, error) {
+	return c.traceTx("AddFunds", func(c *Client) (*types.Transaction, error) {
+		if c.stakeWallet == nil {
+			return nil, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.Stake(amount, deviceID)
+	})
 }
 
 // TransferPayment transfers stake between devices
 func (c *Client) TransferPayment(creatorDeviceID, solverDeviceID string, amount *big.Int) (*types.Transaction, error) {
-	if c.stakeWallet == nil {
-		return nil, fmt.Errorf("stake wallet not initialized")
-	}
-	return c.stakeWallet.TransferPayment(creatorDeviceID, solverDeviceID, amount)
+	return c.traceTx("TransferPayment", func(c *Client) (*types.Transaction, error) {
+		if c.stakeWallet == nil {
+			return nil, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.TransferPayment(creatorDeviceID, solverDeviceID, amount)
+	})
 }
 
 // GetStakeBalance returns the stake balance for a device ID
@@ -230,21 +508,41 @@ func (c *Client) GetStakeBalance(deviceID string) (*big.Int, error) {
 	if c.stakeWallet == nil {
 		return nil, fmt.Errorf("stake wallet not initialized")
 	}
-	return c.stakeWallet.GetBalance(deviceID)
+	return cachedRead(c.cache, []string{deviceTag(deviceID)}, func(opts *bind.CallOpts) (*big.Int, error) {
+		return c.stakeWallet.contract.GetBalance(opts, deviceID)
+	}, "getBalance", deviceID)
 }
 
 // WithdrawFunds withdraws staked tokens
 func (c *Client) WithdrawFunds(deviceID string, amount *big.Int) (*types.Transaction, error) {
+	return c.traceTx("WithdrawFunds", func(c *Client) (*types.Transaction, error) {
+		if c.stakeWallet == nil {
+			return nil, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.WithdrawStake(deviceID, amount)
+	})
+}
+
+// WithdrawAll withdraws a device's whole stake, read at the pending block so
+// payments already broadcast are included, and returns the amount withdrawn
+func (c *Client) WithdrawAll(deviceID string) (*types.Transaction, *big.Int, error) {
 	if c.stakeWallet == nil {
-		return nil, fmt.Errorf("stake wallet not initialized")
+		return nil, nil, fmt.Errorf("stake wallet not initialized")
 	}
-	return c.stakeWallet.WithdrawStake(deviceID, amount)
+	var amount *big.Int
+	tx, err := c.traceTx("WithdrawAll", func(c *Client) (tx *types.Transaction, err error) {
+		tx, amount, err = c.stakeWallet.WithdrawAll(deviceID)
+		return tx, err
+	})
+	return tx, amount, err
 }
 
 // UpdateWalletAddress updates the wallet address for a device ID
 func (c *Client) UpdateWalletAddress(deviceID string, newWalletAddr common.Address) (*types.Transaction, error) {
-	if c.stakeWallet == nil {
-		return nil, fmt.Errorf("stake wallet not initialized")
-	}
-	return c.stakeWallet.UpdateWalletAddress(deviceID, newWalletAddr)
+	return c.traceTx("UpdateWalletAddress", func(c *Client) (*types.Transaction, error) {
+		if c.stakeWallet == nil {
+			return nil, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.UpdateWalletAddress(deviceID, newWalletAddr)
+	})
 }
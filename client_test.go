@@ -0,0 +1,181 @@
+package walletsdk_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+// newChain starts a simulated chain that is closed when the test ends
+func newChain(t *testing.T) *simulated.Chain {
+	t.Helper()
+	chain, err := simulated.New(simulated.DefaultOptions())
+	if err != nil {
+		t.Fatalf("failed to start simulated chain: %v", err)
+	}
+	t.Cleanup(func() { chain.Close() })
+	return chain
+}
+
+// newClient returns a client for account that is closed when the test ends
+func newClient(t *testing.T, chain *simulated.Chain, account simulated.Account) *walletsdk.Client {
+	t.Helper()
+	client, err := chain.Client(account)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// mined waits for tx and fails the test unless it succeeded
+func mined(t *testing.T, chain *simulated.Chain, tx *types.Transaction, err error) *types.Receipt {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	receipt, err := chain.WaitMined(tx)
+	if err != nil {
+		t.Fatalf("failed to wait for transaction: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction %s reverted", tx.Hash().Hex())
+	}
+	return receipt
+}
+
+// tokens returns n whole tokens in base units
+func tokens(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func expectBalance(t *testing.T, client *walletsdk.Client, want *big.Int, account simulated.Account) {
+	t.Helper()
+	got, err := client.GetBalance(account.Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if got.Cmp(want) != 0 {
+		t.Fatalf("balance of %s = %s, want %s", account.Address.Hex(), got, want)
+	}
+}
+
+func expectRevert(t *testing.T, err error, reason string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected revert %q, got success", reason)
+	}
+	if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("expected revert %q, got %v", reason, err)
+	}
+}
+
+func TestGetTokenInfo(t *testing.T) {
+	chain := newChain(t)
+	client := newClient(t, chain, chain.Accounts[0])
+
+	name, symbol, decimals, err := client.GetTokenInfo()
+	if err != nil {
+		t.Fatalf("GetTokenInfo: %v", err)
+	}
+	if name != "Parity Token" || symbol != "PRTY" || decimals != 18 {
+		t.Fatalf("GetTokenInfo = %q, %q, %d", name, symbol, decimals)
+	}
+
+	supply, err := client.GetTotalSupply()
+	if err != nil {
+		t.Fatalf("GetTotalSupply: %v", err)
+	}
+	if want := simulated.DefaultOptions().InitialSupply; supply.Cmp(want) != 0 {
+		t.Fatalf("GetTotalSupply = %s, want %s", supply, want)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	tx, err := client.Transfer(bob.Address, tokens(10))
+	mined(t, chain, tx, err)
+	expectBalance(t, client, tokens(990), alice)
+	expectBalance(t, client, tokens(1010), bob)
+
+	_, err = client.Transfer(bob.Address, tokens(5000))
+	expectRevert(t, err, "ERC20: amount exceeds balance")
+
+	tx, err = client.TransferWithData(bob.Address, tokens(1), []byte("task-1"))
+	mined(t, chain, tx, err)
+	expectBalance(t, client, tokens(1011), bob)
+}
+
+func TestApproveAndTransferFrom(t *testing.T) {
+	chain := newChain(t)
+	alice, bob, carol := chain.Accounts[0], chain.Accounts[1], chain.Accounts[2]
+	aliceClient := newClient(t, chain, alice)
+	bobClient := newClient(t, chain, bob)
+
+	tx, err := aliceClient.Approve(bob.Address, tokens(20))
+	mined(t, chain, tx, err)
+
+	allowance, err := aliceClient.GetAllowance(alice.Address, bob.Address)
+	if err != nil {
+		t.Fatalf("GetAllowance: %v", err)
+	}
+	if allowance.Cmp(tokens(20)) != 0 {
+		t.Fatalf("GetAllowance = %s, want %s", allowance, tokens(20))
+	}
+
+	tx, err = bobClient.TransferFrom(alice.Address, carol.Address, tokens(15))
+	mined(t, chain, tx, err)
+	expectBalance(t, bobClient, tokens(1015), carol)
+
+	_, err = bobClient.TransferFrom(alice.Address, carol.Address, tokens(15))
+	expectRevert(t, err, "ERC20: insufficient allowance")
+}
+
+func TestMintAndBurn(t *testing.T) {
+	chain := newChain(t)
+	alice := chain.Accounts[0]
+	owner := newClient(t, chain, chain.Owner)
+	client := newClient(t, chain, alice)
+
+	tx, err := owner.Mint(alice.Address, tokens(5))
+	mined(t, chain, tx, err)
+	expectBalance(t, client, tokens(1005), alice)
+
+	_, err = client.Mint(alice.Address, tokens(5))
+	expectRevert(t, err, "execution reverted")
+
+	tx, err = client.Burn(tokens(1005))
+	mined(t, chain, tx, err)
+	expectBalance(t, client, new(big.Int), alice)
+
+	supply, err := client.GetTotalSupply()
+	if err != nil {
+		t.Fatalf("GetTotalSupply: %v", err)
+	}
+	if want := simulated.DefaultOptions().InitialSupply; supply.Cmp(new(big.Int).Sub(want, tokens(1000))) != 0 {
+		t.Fatalf("GetTotalSupply = %s after burn", supply)
+	}
+}
+
+func TestSetPrivateKey(t *testing.T) {
+	chain := newChain(t)
+	client := newClient(t, chain, chain.Accounts[0])
+
+	if err := client.SetPrivateKey(chain.Accounts[1].PrivateKeyHex()); err != nil {
+		t.Fatalf("SetPrivateKey: %v", err)
+	}
+	if client.Address() != chain.Accounts[1].Address {
+		t.Fatalf("Address = %s, want %s", client.Address().Hex(), chain.Accounts[1].Address.Hex())
+	}
+	if err := client.SetPrivateKey("not a key"); err == nil {
+		t.Fatal("SetPrivateKey accepted an invalid key")
+	}
+}
@@ -0,0 +1,603 @@
+package walletsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// DefaultEnvPrefix prefixes the environment variables that override a loaded
+// profile, e.g. PARITY_RPC_URL
+const DefaultEnvPrefix = "PARITY_"
+
+// ConfigFile is the layout of a configuration file: named network profiles
+// and the one used when no other is selected
+type ConfigFile struct {
+	Profile  string                   `yaml:"profile" toml:"profile" json:"profile"`
+	Profiles map[string]ProfileConfig `yaml:"profiles" toml:"profiles" json:"profiles"`
+}
+
+// ProfileConfig describes one network such as devnet, testnet or mainnet.
+// Exactly one of RPCURL, RPCURLSecret and Endpoints is set.
+type ProfileConfig struct {
+	// Network names a registered deployment supplying the chain ID, the
+	// contract addresses and their expected code
+	Network string `yaml:"network" toml:"network" json:"network"`
+	RPCURL  string `yaml:"rpc_url" toml:"rpc_url" json:"rpc_url"`
+	// RPCURLSecret reads the RPC URL from a secret, for provider URLs
+	// carrying an API key
+	RPCURLSecret *SecretSource   `yaml:"rpc_url_secret" toml:"rpc_url_secret" json:"rpc_url_secret"`
+	Endpoints    []EndpointEntry `yaml:"endpoints" toml:"endpoints" json:"endpoints"`
+	// ChainID is fetched from the node when zero
+	ChainID      int64        `yaml:"chain_id" toml:"chain_id" json:"chain_id"`
+	TokenAddress string       `yaml:"token_address" toml:"token_address" json:"token_address"`
+	StakeAddress string       `yaml:"stake_address" toml:"stake_address" json:"stake_address"`
+	Signer       SignerConfig `yaml:"signer" toml:"signer" json:"signer"`
+	Fees         FeeConfig    `yaml:"fees" toml:"fees" json:"fees"`
+}
+
+// EndpointEntry is one of several RPC endpoints. Exactly one of URL and
+// URLSecret is set.
+type EndpointEntry struct {
+	URL       string        `yaml:"url" toml:"url" json:"url"`
+	URLSecret *SecretSource `yaml:"url_secret" toml:"url_secret" json:"url_secret"`
+	Priority  int           `yaml:"priority" toml:"priority" json:"priority"`
+}
+
+// SecretSource names where a secret is read from. Exactly one field is set.
+// Secrets never appear inline in configuration files.
+type SecretSource struct {
+	// File is read and trimmed. Relative paths are resolved against the
+	// directory of the configuration file.
+	File string `yaml:"file" toml:"file" json:"file"`
+	// Command is run without a shell and its trimmed output used, e.g.
+	// ["pass", "show", "parity/mainnet"]
+	Command []string `yaml:"command" toml:"command" json:"command"`
+	// Env names an environment variable holding the secret
+	Env string `yaml:"env" toml:"env" json:"env"`
+}
+
+// SignerConfig selects the signing key. Without a key the client is read-only.
+type SignerConfig struct {
+	Key *SecretSource `yaml:"key" toml:"key" json:"key"`
+	// PrivateKey is rejected. It exists so an inline key is reported
+	// clearly rather than as an unknown field.
+	PrivateKey string `yaml:"private_key" toml:"private_key" json:"private_key"`
+}
+
+// FeeConfig is the file form of FeePolicy. Amounts are strings in wei, or
+// with a unit such as "30 gwei" or "0.001 ether".
+type FeeConfig struct {
+	GasPrice    string `yaml:"gas_price" toml:"gas_price" json:"gas_price"`
+	GasTipCap   string `yaml:"gas_tip_cap" toml:"gas_tip_cap" json:"gas_tip_cap"`
+	GasFeeCap   string `yaml:"gas_fee_cap" toml:"gas_fee_cap" json:"gas_fee_cap"`
+	MaxGasPrice string `yaml:"max_gas_price" toml:"max_gas_price" json:"max_gas_price"`
+}
+
+// LoadOptions controls how a profile is selected and resolved
+type LoadOptions struct {
+	// Profile selects the profile, taking precedence over the PROFILE
+	// environment variable and the file's default
+	Profile string
+	// EnvPrefix prefixes override variables, DefaultEnvPrefix by default
+	EnvPrefix string
+	// LookupEnv reads environment variables, os.LookupEnv by default
+	LookupEnv func(key string) (string, bool)
+	// CommandTimeout bounds secret commands, 10s by default
+	CommandTimeout time.Duration
+}
+
+func (o LoadOptions) withDefaults() LoadOptions {
+	if o.EnvPrefix == "" {
+		o.EnvPrefix = DefaultEnvPrefix
+	}
+	if o.LookupEnv == nil {
+		o.LookupEnv = os.LookupEnv
+	}
+	if o.CommandTimeout <= 0 {
+		o.CommandTimeout = 10 * time.Second
+	}
+	return o
+}
+
+// ConfigError reports an invalid value in a profile. Field is the path of the
+// value in the file, e.g. endpoints[1].url, or the environment variable it
+// was read from.
+type ConfigError struct {
+	Profile string
+	Field   string
+	Reason  string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("profile %q: %s: %s", e.Profile, e.Field, e.Reason)
+}
+
+// LoadConfig reads a YAML, TOML or JSON file, chosen by its extension, and
+// returns the client configuration of the selected profile with environment
+// overrides applied and secrets resolved
+func LoadConfig(path string, options LoadOptions) (ClientConfig, error) {
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = FormatYAML
+	case ".toml":
+		format = FormatTOML
+	case ".json":
+		format = FormatJSON
+	default:
+		return ClientConfig{}, fmt.Errorf("unknown config format of %s, want .yaml, .yml, .toml or .json", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ClientConfig{}, fmt.Errorf("failed to read config: %w", err)
+	}
+	file, err := ParseConfigFile(data, format)
+	if err != nil {
+		return ClientConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.clientConfig(filepath.Dir(path), options)
+}
+
+// ParseConfig is LoadConfig for data already read. Relative secret files are
+// resolved against the working directory.
+func ParseConfig(data []byte, format string, options LoadOptions) (ClientConfig, error) {
+	file, err := ParseConfigFile(data, format)
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	return file.clientConfig(".", options)
+}
+
+// ParseConfigFile decodes a configuration file without resolving a profile.
+// Unknown fields are errors, so typos do not silently fall back to defaults.
+func ParseConfigFile(data []byte, format string) (*ConfigFile, error) {
+	file := &ConfigFile{}
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse YAML config: %w", err)
+		}
+	case FormatTOML:
+		meta, err := toml.Decode(string(data), file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config: %w", err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("failed to parse TOML config: unknown field %s", undecoded[0])
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(file); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q, want %s, %s or %s", format, FormatYAML, FormatTOML, FormatJSON)
+	}
+	return file, nil
+}
+
+// clientConfig selects, overrides, validates and resolves a profile
+func (f *ConfigFile) clientConfig(dir string, options LoadOptions) (ClientConfig, error) {
+	options = options.withDefaults()
+	name, err := f.selectProfile(options)
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	r := &profileResolver{
+		name:    name,
+		profile: f.Profiles[name],
+		dir:     dir,
+		options: options,
+		fields:  make(map[string]string),
+	}
+	r.applyEnv()
+	config := r.resolve()
+	if len(r.errs) > 0 {
+		return ClientConfig{}, errors.Join(r.errs...)
+	}
+	return config, nil
+}
+
+func (f *ConfigFile) selectProfile(options LoadOptions) (string, error) {
+	name := options.Profile
+	if name == "" {
+		name, _ = options.LookupEnv(options.EnvPrefix + "PROFILE")
+	}
+	if name == "" {
+		name = f.Profile
+	}
+	if name == "" && len(f.Profiles) == 1 {
+		for only := range f.Profiles {
+			name = only
+		}
+	}
+
+	names := make([]string, 0, len(f.Profiles))
+	for n := range f.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	switch {
+	case len(names) == 0:
+		return "", fmt.Errorf("config defines no profiles")
+	case name == "":
+		return "", fmt.Errorf("no profile selected, set profile in the file, %sPROFILE or LoadOptions.Profile to one of %s",
+			options.EnvPrefix, strings.Join(names, ", "))
+	}
+	if _, ok := f.Profiles[name]; !ok {
+		return "", fmt.Errorf("profile %q not found, have %s", name, strings.Join(names, ", "))
+	}
+	return name, nil
+}
+
+// profileResolver turns one profile into a ClientConfig, collecting every
+// problem rather than stopping at the first
+type profileResolver struct {
+	name    string
+	profile ProfileConfig
+	dir     string
+	options LoadOptions
+	// fields maps overridden fields to the variable they were read from
+	fields map[string]string
+	errs   []error
+}
+
+func (r *profileResolver) fail(field, format string, args ...interface{}) {
+	if env, ok := r.fields[field]; ok {
+		field = env
+	}
+	r.errs = append(r.errs, &ConfigError{Profile: r.name, Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// env returns the override of field, remembering where it came from
+func (r *profileResolver) env(field, suffix string) (string, bool) {
+	key := r.options.EnvPrefix + suffix
+	value, ok := r.options.LookupEnv(key)
+	if !ok || value == "" {
+		return "", false
+	}
+	r.fields[field] = key
+	return value, true
+}
+
+// applyEnv overrides profile fields from the environment. RPC_URL and
+// ENDPOINTS replace each other, and any KEY_ variable replaces the key source.
+func (r *profileResolver) applyEnv() {
+	p := &r.profile
+	if v, ok := r.env("network", "NETWORK"); ok {
+		p.Network = v
+	}
+	if v, ok := r.env("rpc_url", "RPC_URL"); ok {
+		p.RPCURL, p.RPCURLSecret, p.Endpoints = v, nil, nil
+	}
+	if v, ok := r.env("endpoints", "ENDPOINTS"); ok {
+		p.RPCURL, p.RPCURLSecret, p.Endpoints = "", nil, nil
+		for i, u := range strings.Split(v, ",") {
+			p.Endpoints = append(p.Endpoints, EndpointEntry{URL: strings.TrimSpace(u), Priority: i})
+		}
+	}
+	if v, ok := r.env("chain_id", "CHAIN_ID"); ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			r.fail("chain_id", "invalid chain ID %q", v)
+		}
+		p.ChainID = id
+	}
+	if v, ok := r.env("token_address", "TOKEN_ADDRESS"); ok {
+		p.TokenAddress = v
+	}
+	if v, ok := r.env("stake_address", "STAKE_ADDRESS"); ok {
+		p.StakeAddress = v
+	}
+	if v, ok := r.env("signer.key.file", "KEY_FILE"); ok {
+		p.Signer.Key = &SecretSource{File: v}
+	}
+	if v, ok := r.env("signer.key.command", "KEY_COMMAND"); ok {
+		p.Signer.Key = &SecretSource{Command: strings.Fields(v)}
+	}
+	if v, ok := r.env("signer.key.env", "KEY_ENV"); ok {
+		p.Signer.Key = &SecretSource{Env: v}
+	}
+	if v, ok := r.env("fees.gas_price", "GAS_PRICE"); ok {
+		p.Fees.GasPrice = v
+	}
+	if v, ok := r.env("fees.gas_tip_cap", "GAS_TIP_CAP"); ok {
+		p.Fees.GasTipCap = v
+	}
+	if v, ok := r.env("fees.gas_fee_cap", "GAS_FEE_CAP"); ok {
+		p.Fees.GasFeeCap = v
+	}
+	if v, ok := r.env("fees.max_gas_price", "MAX_GAS_PRICE"); ok {
+		p.Fees.MaxGasPrice = v
+	}
+}
+
+// resolve validates the profile and, when it is valid, reads its secrets
+func (r *profileResolver) resolve() ClientConfig {
+	p := r.profile
+	config := ClientConfig{ChainID: p.ChainID}
+
+	sources := 0
+	for _, set := range []bool{p.RPCURL != "", p.RPCURLSecret != nil, len(p.Endpoints) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		r.fail("rpc_url", "set exactly one of rpc_url, rpc_url_secret and endpoints")
+	}
+	if p.RPCURL != "" {
+		r.checkURL("rpc_url", p.RPCURL)
+	}
+	r.checkSecret("rpc_url_secret", p.RPCURLSecret)
+	for i, ep := range p.Endpoints {
+		field := fmt.Sprintf("endpoints[%d]", i)
+		if (ep.URL == "") == (ep.URLSecret == nil) {
+			r.fail(field, "set exactly one of url and url_secret")
+		}
+		if ep.URL != "" {
+			r.checkURL(field+".url", ep.URL)
+		}
+		r.checkSecret(field+".url_secret", ep.URLSecret)
+	}
+
+	if p.ChainID < 0 {
+		r.fail("chain_id", "must not be negative")
+	}
+	if p.TokenAddress != "" {
+		config.TokenAddress = r.address("token_address", p.TokenAddress)
+	}
+	if p.StakeAddress != "" {
+		config.StakeAddress = r.address("stake_address", p.StakeAddress)
+	}
+	if p.Network != "" {
+		r.network(p.Network, &config)
+	} else if p.TokenAddress == "" {
+		r.fail("token_address", "required unless network is set")
+	}
+
+	if p.Signer.PrivateKey != "" {
+		r.fail("signer.private_key", "inline private keys are not allowed, use signer.key with a file, command or env source")
+	}
+	r.checkSecret("signer.key", p.Signer.Key)
+
+	config.Fees = r.fees(p.Fees)
+
+	if len(r.errs) > 0 {
+		return ClientConfig{}
+	}
+
+	// Secrets are only read, and commands only run, for a valid profile
+	if p.RPCURLSecret != nil {
+		config.RPCURL = r.secret("rpc_url_secret", p.RPCURLSecret)
+		r.checkURL("rpc_url_secret", config.RPCURL)
+	} else {
+		config.RPCURL = p.RPCURL
+	}
+	for i, ep := range p.Endpoints {
+		endpoint := Endpoint{URL: ep.URL, Priority: ep.Priority}
+		if ep.URLSecret != nil {
+			field := fmt.Sprintf("endpoints[%d].url_secret", i)
+			endpoint.URL = r.secret(field, ep.URLSecret)
+			r.checkURL(field, endpoint.URL)
+		}
+		config.Endpoints = append(config.Endpoints, endpoint)
+	}
+	if p.Signer.Key != nil {
+		key := r.secret("signer.key", p.Signer.Key)
+		if key != "" {
+			if _, err := crypto.HexToECDSA(strings.TrimPrefix(key, "0x")); err != nil {
+				// The error never includes the key itself
+				r.fail("signer.key", "not a hex private key")
+			}
+		}
+		config.PrivateKey = key
+	}
+	return config
+}
+
+// network fills config from a registered network. Values also set in the
+// profile must agree with it.
+func (r *profileResolver) network(name string, config *ClientConfig) {
+	network, ok := LookupNetwork(name)
+	if !ok {
+		r.fail("network", "unknown network %q, have %s", name, networkNames())
+		return
+	}
+	if config.ChainID == 0 {
+		config.ChainID = network.ChainID
+	} else if config.ChainID != network.ChainID {
+		r.fail("chain_id", "%d differs from chain %d of network %q", config.ChainID, network.ChainID, network.Name)
+	}
+	if config.TokenAddress == (common.Address{}) {
+		config.TokenAddress = network.TokenAddress
+	} else if config.TokenAddress != network.TokenAddress {
+		r.fail("token_address", "%s differs from %s of network %q", config.TokenAddress.Hex(), network.TokenAddress.Hex(), network.Name)
+	}
+	if config.StakeAddress == (common.Address{}) {
+		config.StakeAddress = network.StakeAddress
+	} else if config.StakeAddress != network.StakeAddress {
+		r.fail("stake_address", "%s differs from %s of network %q", config.StakeAddress.Hex(), network.StakeAddress.Hex(), network.Name)
+	}
+	config.Verify = &VerifyOptions{TokenCodeHash: network.TokenCodeHash, StakeCodeHash: network.StakeCodeHash}
+}
+
+// checkURL accepts http, https, ws and wss URLs and absolute IPC paths. The
+// URL is never quoted in errors, as it may carry an API key.
+func (r *profileResolver) checkURL(field, raw string) {
+	if filepath.IsAbs(raw) {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		r.fail(field, "invalid URL")
+		return
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		r.fail(field, "unsupported scheme %q, want http, https, ws, wss or an absolute IPC path", u.Scheme)
+		return
+	}
+	if u.Host == "" {
+		r.fail(field, "missing host")
+	}
+	if _, ok := u.User.Password(); ok && !strings.HasSuffix(field, "_secret") {
+		r.fail(field, "URL contains a password, move it to %s_secret", field)
+	}
+}
+
+func (r *profileResolver) checkSecret(field string, s *SecretSource) {
+	if s == nil {
+		return
+	}
+	sources := 0
+	for _, set := range []bool{s.File != "", len(s.Command) > 0, s.Env != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		r.fail(field, "set exactly one of file, command and env")
+	}
+}
+
+// address parses a hex address, rejecting mixed case that fails the EIP-55
+// checksum as likely mistyped
+func (r *profileResolver) address(field, value string) common.Address {
+	if !common.IsHexAddress(value) {
+		r.fail(field, "invalid address %q", value)
+		return common.Address{}
+	}
+	addr := common.HexToAddress(value)
+	hex := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && "0x"+hex != addr.Hex() {
+		r.fail(field, "address %q fails its EIP-55 checksum", value)
+	}
+	if addr == (common.Address{}) {
+		r.fail(field, "zero address")
+	}
+	return addr
+}
+
+func (r *profileResolver) fees(c FeeConfig) *FeePolicy {
+	if c == (FeeConfig{}) {
+		return nil
+	}
+	policy := &FeePolicy{
+		GasPrice:    r.amount("fees.gas_price", c.GasPrice),
+		GasTipCap:   r.amount("fees.gas_tip_cap", c.GasTipCap),
+		GasFeeCap:   r.amount("fees.gas_fee_cap", c.GasFeeCap),
+		MaxGasPrice: r.amount("fees.max_gas_price", c.MaxGasPrice),
+	}
+	if err := policy.Validate(); err != nil {
+		r.fail("fees", "%v", err)
+	}
+	return policy
+}
+
+// weiUnits are the units accepted in fee amounts
+var weiUnits = map[string]*big.Int{
+	"wei":   big.NewInt(1),
+	"gwei":  big.NewInt(1e9),
+	"ether": big.NewInt(1e18),
+}
+
+// amount parses a wei amount such as "1000", "30 gwei" or "1.5gwei"
+func (r *profileResolver) amount(field, value string) *big.Int {
+	if value == "" {
+		return nil
+	}
+	number, unit := value, "wei"
+	if i := strings.IndexFunc(value, func(c rune) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }); i >= 0 {
+		number, unit = strings.TrimSpace(value[:i]), strings.ToLower(value[i:])
+	}
+	multiplier, ok := weiUnits[unit]
+	if !ok {
+		r.fail(field, "unknown unit %q in %q, want wei, gwei or ether", unit, value)
+		return nil
+	}
+	amount, ok := new(big.Rat).SetString(number)
+	if !ok || amount.Sign() < 0 {
+		r.fail(field, "invalid amount %q", value)
+		return nil
+	}
+	amount.Mul(amount, new(big.Rat).SetInt(multiplier))
+	if !amount.IsInt() {
+		r.fail(field, "%q is not a whole number of wei", value)
+		return nil
+	}
+	return amount.Num()
+}
+
+// secret reads a secret. Errors name the source but never the value.
+func (r *profileResolver) secret(field string, s *SecretSource) string {
+	var value string
+	switch {
+	case s.File != "":
+		path := s.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			r.fail(field+".file", "%v", err)
+			return ""
+		}
+		value = string(data)
+	case len(s.Command) > 0:
+		ctx, cancel := context.WithTimeout(context.Background(), r.options.CommandTimeout)
+		defer cancel()
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			r.fail(field+".command", "%s failed: %v", s.Command[0], err)
+			return ""
+		}
+		value = stdout.String()
+	case s.Env != "":
+		v, ok := r.options.LookupEnv(s.Env)
+		if !ok {
+			r.fail(field+".env", "environment variable %s is not set", s.Env)
+			return ""
+		}
+		value = v
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		r.fail(field, "secret is empty")
+	}
+	return value
+}
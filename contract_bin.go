@@ -0,0 +1,9 @@
+// Code generated by internal/contractgen. DO NOT EDIT.
+
+package walletsdk
+
+// ParityTokenBin is the creation bytecode of the ParityToken contract
+const ParityTokenBin = "0x341561000b5760006000fd5b336000553360007f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a360206020380360003960005180600155803360005260026020526040600020556000523360007fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a361096c61009460003961096c6000f3341561000b5760006000fd5b600436106100ca5760003560e01c8063dd62ed3e1461017f578063095ea7b31461032857806370a082311461014f57806342966c6814610779578063313ce5671461013857806340c10f191461060457806306fdde03146100d05780638da5cb5b1461083c578063715018a61461090357806395d89b411461010457806318160ddd14610143578063a9059cbb146101d357806323b872dd14610400578063f2fde38b146108485780632535f762146101d357806390008724146101d3575b60006000fd5b6020600052600c6020527f50617269747920546f6b656e000000000000000000000000000000000000000060405260606000f35b602060005260046020527f505254590000000000000000000000000000000000000000000000000000000060405260606000f35b601260005260206000f35b60015460005260206000f35b60043573ffffffffffffffffffffffffffffffffffffffff16600052600260205260406000205460005260206000f35b60043573ffffffffffffffffffffffffffffffffffffffff166000526003602052604060002060243573ffffffffffffffffffffffffffffffffffffffff1660005260205260406000205460005260206000f35b3360805260043573ffffffffffffffffffffffffffffffffffffffff1660a05260243560c05260a051610258577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601f6024527f45524332303a207472616e7366657220746f207a65726f20616464726573730060445260646000fd5b6080516000526002602052604060002080548060c05111156102cc577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f45524332303a20616d6f756e7420657863656564732062616c616e636500000060445260646000fd5b60c0519003905560a05160005260026020526040600020805460c05101905560c05160005260a0516080517fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3600160005260206000f35b60043573ffffffffffffffffffffffffffffffffffffffff168060a0526103a1577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601e6024527f45524332303a20617070726f766520746f207a65726f2061646472657373000060445260646000fd5b6024358060c052336000526003602052604060002060a05160005260205260406000205560c05160005260a051337f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b92560206000a3600160005260206000f35b60043573ffffffffffffffffffffffffffffffffffffffff1660805260243573ffffffffffffffffffffffffffffffffffffffff1660a05260443560c052608051600052600360205260406000203360005260205260406000208060e052548019156104d4578060c05111156104c8577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f45524332303a20696e73756666696369656e7420616c6c6f77616e636500000060445260646000fd5b60c051900360e0515560005b5060a051610534577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601f6024527f45524332303a207472616e7366657220746f207a65726f20616464726573730060445260646000fd5b6080516000526002602052604060002080548060c05111156105a8577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f45524332303a20616d6f756e7420657863656564732062616c616e636500000060445260646000fd5b60c0519003905560a05160005260026020526040600020805460c05101905560c05160005260a0516080517fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3600160005260206000f35b336000541461063b57337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60043573ffffffffffffffffffffffffffffffffffffffff168060a0526106b4577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601b6024527f45524332303a206d696e7420746f207a65726f2061646472657373000000000060445260646000fd5b60243560c0526001548060c0510180911115610722577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601c6024527f45524332303a20746f74616c20737570706c79206f766572666c6f770000000060445260646000fd5b60015560a05160005260026020526040600020805460c05101905560c05160005260a05160007fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3600160005260206000f35b60043560c052336000526002602052604060002080548060c05111156107f1577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601b6024527f45524332303a206275726e20657863656564732062616c616e6365000000000060445260646000fd5b60c0519003905560c0516001540360015560c0516000526000337fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef60206000a3600160005260206000f35b60005460005260206000f35b336000541461087f57337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60043573ffffffffffffffffffffffffffffffffffffffff16806080526108cf5760007f1e4fbdf70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b6080516000547f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a3608051600055005b336000541461093a57337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60006000547f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a3600060005500"
+
+// StakeWalletContractBin is the creation bytecode of the StakeWallet contract
+const StakeWalletContractBin = "0x341561000b5760006000fd5b336000553360007f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a360206020380360003960005173ffffffffffffffffffffffffffffffffffffffff16806100b7577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260156024527f496e76616c696420746f6b656e2061646472657373000000000000000000000060445260646000fd5b6001556111286100ca6000396111286000f3341561000b5760006000fd5b6004361061009e5760003560e01c80639360b1e31461024b5780633a51d246146100b057806313c6bbfb146101535780638da5cb5b14610ff8578063069c9fae14610e4d578063715018a6146110bf578063fc0c546a146100a4578063f2fde38b14611004578063886389a91461057b578063d369be7314610c5d57806372f179f8146101535780639769b439146108c1575b60006000fd5b60015460005260206000f35b600435600401803580608052806130001161011d577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c0526000608051610400015260c0515460005260206000f35b60043560040180358060805280613000116101c0577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c0526000608051610400015260c051600001546103005260806103205260c051600101546103405260c051600201546103605260c051600301546103805260005b61038051811015610243578060051c60c0516004010154816103a0015260200161021e565b60a001610300f35b60043580610100526102af577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f416d6f756e74206d7573742062652067726561746572207468616e203000000060445260646000fd5b60443573ffffffffffffffffffffffffffffffffffffffff168061012052610329577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260166024527f496e76616c69642077616c6c657420616464726573730000000000000000000060445260646000fd5b6024356004018035806080528061300011610396577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c05260006080516104000152600154610140527f23b872dd0000000000000000000000000000000000000000000000000000000061020052336102045230610224526101005161024452610140513b61045e577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260176024527f546f6b656e206973206e6f74206120636f6e747261637400000000000000000060445260646000fd5b602061020060646102006000610140515af161047f573d600060003e3d6000fd5b3d156104e657610200516104e5577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260156024527f546f6b656e207472616e73666572206661696c6564000000000000000000000060445260646000fd5b5b60c05160020154610538576101205160c05160010155600160c0516002015560805160c0516003015560005b608051811015610536578061040001518160051c60c0516004010155602001610512565b505b60c0518054610100510190556101005160005233608051610400207f638d080340ef92be09fcea1c0d842ca1c8faa43b2107e345738baae64faed80a60206000a3005b33600054146105b257337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b6044358061010052610616577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f416d6f756e74206d7573742062652067726561746572207468616e203000000060445260646000fd5b6004356004018035806080528061300011610683577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c0526000608051610400015260243560040180358060a0528061300011610719577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161400037600260a051614000015260a0516020016140002060e052600060a051614000015260c051600201546107a5577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260186024527f43726561746f7220646576696365206e6f7420666f756e64000000000000000060445260646000fd5b60e05160020154610808577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260176024527f536f6c76657220646576696365206e6f7420666f756e6400000000000000000060445260646000fd5b60c051805480610100511115610870577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260146024527f496e73756666696369656e742062616c616e636500000000000000000000000060445260646000fd5b610100519003905560e0518054610100510190556101005160005260a05161400020608051610400207fa6fb7800518d7e7a020dd3a0e8f7273a0bfa695f7fee44382a878641650d26f960206000a3005b6024358061010052610925577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452601d6024527f416d6f756e74206d7573742062652067726561746572207468616e203000000060445260646000fd5b6004356004018035806080528061300011610992577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c0526000608051610400015260c05160020154610a1e577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260106024527f446576696365206e6f7420666f756e640000000000000000000000000000000060445260646000fd5b60c0516001015480610120523314336000541417610a8e577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452600e6024527f4e6f7420617574686f72697a656400000000000000000000000000000000000060445260646000fd5b60c051805480610100511115610af6577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260146024527f496e73756666696369656e742062616c616e636500000000000000000000000060445260646000fd5b6101005190039055600154610140527fa9059cbb000000000000000000000000000000000000000000000000000000006102005261012051610204526101005161022452610140513b610b9b577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260176024527f546f6b656e206973206e6f74206120636f6e747261637400000000000000000060445260646000fd5b602061020060446102006000610140515af1610bbc573d600060003e3d6000fd5b3d15610c235761020051610c22577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260156024527f546f6b656e207472616e73666572206661696c6564000000000000000000000060445260646000fd5b5b6101005160005261012051608051610400207f04f1cd9c278166a000e1b082998f5bdbdf1b11c193aafbd7d1a90a0c9093a2ec60206000a3005b60243573ffffffffffffffffffffffffffffffffffffffff168061010052610cd7577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260166024527f496e76616c69642077616c6c657420616464726573730000000000000000000060445260646000fd5b6004356004018035806080528061300011610d44577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260126024527f44657669636520494420746f6f206c6f6e67000000000000000000000000000060445260646000fd5b9060200161040037600260805161040001526080516020016104002060c0526000608051610400015260c05160020154610dd0577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260106024527f446576696365206e6f7420666f756e640000000000000000000000000000000060445260646000fd5b60c0516001015480610120523314336000541417610e40577f08c379a0000000000000000000000000000000000000000000000000000000006000526020600452600e6024527f4e6f7420617574686f72697a656400000000000000000000000000000000000060445260646000fd5b6101005160c05160010155005b3360005414610e8457337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60043573ffffffffffffffffffffffffffffffffffffffff1661012052602435610100527fa9059cbb0000000000000000000000000000000000000000000000000000000061020052600054610204526101005161022452610120513b610f3d577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260176024527f546f6b656e206973206e6f74206120636f6e747261637400000000000000000060445260646000fd5b602061020060446102006000610120515af1610f5e573d600060003e3d6000fd5b3d15610fc55761020051610fc4577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260156024527f546f6b656e207472616e73666572206661696c6564000000000000000000000060445260646000fd5b5b61010051600052610120517f4590b594be6fdef6bd5e18792a2494ddf2156b618c7bbe48d13a92831208af0560206000a2005b60005460005260206000f35b336000541461103b57337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60043573ffffffffffffffffffffffffffffffffffffffff168060805261108b5760007f1e4fbdf70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b6080516000547f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a3608051600055005b33600054146110f657337f118cdaa70000000000000000000000000000000000000000000000000000000060005260045260246000fd5b60006000547f8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e060006000a3600060005500"
@@ -0,0 +1,114 @@
+package walletsdk
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DeployParityToken deploys the token contract from config.PrivateKey, with
+// initialSupply minted to the deployer, and returns a client wired to it
+func DeployParityToken(ctx context.Context, backend Backend, config ClientConfig, initialSupply *big.Int) (*Client, error) {
+	deployer, err := newDeployer(backend, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.TokenAddress, err = deployer.deployToken(ctx, initialSupply); err != nil {
+		return nil, err
+	}
+	return NewClientWithBackend(backend, config)
+}
+
+// DeployStakeWallet deploys the stake contract for config.TokenAddress from
+// config.PrivateKey and returns a client wired to it
+func DeployStakeWallet(ctx context.Context, backend Backend, config ClientConfig) (*Client, error) {
+	deployer, err := newDeployer(backend, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.StakeAddress, err = deployer.deployStake(ctx, config.TokenAddress); err != nil {
+		return nil, err
+	}
+	return NewClientWithBackend(backend, config)
+}
+
+// DeployContracts deploys the token and a stake contract for it and returns
+// a client wired to both. Both contracts are sent by the same deployer.
+func DeployContracts(ctx context.Context, backend Backend, config ClientConfig, initialSupply *big.Int) (*Client, error) {
+	deployer, err := newDeployer(backend, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.TokenAddress, err = deployer.deployToken(ctx, initialSupply); err != nil {
+		return nil, err
+	}
+	if config.StakeAddress, err = deployer.deployStake(ctx, config.TokenAddress); err != nil {
+		return nil, err
+	}
+	return NewClientWithBackend(backend, config)
+}
+
+// newDeployer returns a client for sending creation transactions. The
+// contracts do not exist yet, so it is bound to none and skips verification.
+func newDeployer(backend Backend, config ClientConfig) (*Client, error) {
+	config.Verify = nil
+	config.TokenAddress = common.Address{}
+	config.StakeAddress = common.Address{}
+	return NewClientWithBackend(backend, config)
+}
+
+// deployToken deploys the token contract with initialSupply minted to the
+// deployer
+func (c *Client) deployToken(ctx context.Context, initialSupply *big.Int) (common.Address, error) {
+	return c.deploy(ctx, ContractParityToken, ParityTokenBin, initialSupply)
+}
+
+// deployStake deploys the stake contract for token
+func (c *Client) deployStake(ctx context.Context, token common.Address) (common.Address, error) {
+	if token == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("stake wallet deployment requires a token address")
+	}
+	return c.deploy(ctx, ContractStakeWallet, StakeWalletContractBin, token)
+}
+
+// deploy sends the creation transaction of contract and waits until its
+// runtime code is on chain
+func (c *Client) deploy(ctx context.Context, contract, bin string, params ...interface{}) (common.Address, error) {
+	parsed, err := contractABI(contract)
+	if err != nil {
+		return common.Address{}, err
+	}
+	auth, err := c.GetTransactOpts()
+	if err != nil {
+		return common.Address{}, err
+	}
+	opts := *auth
+	opts.Context = ctx
+
+	// Gas is estimated by DeployContract when opts.GasLimit is zero
+	addr, tx, _, err := bind.DeployContract(&opts, parsed, common.FromHex(bin), c, params...)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to deploy %s: %w", contract, err)
+	}
+
+	receipt, err := bind.WaitMined(ctx, c, tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to wait for %s deployment: %w", contract, err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return common.Address{}, fmt.Errorf("%s deployment %s reverted", contract, tx.Hash().Hex())
+	}
+
+	code, err := c.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to fetch %s code: %w", contract, err)
+	}
+	if len(code) == 0 {
+		return common.Address{}, fmt.Errorf("no %s code at %s after deployment", contract, addr.Hex())
+	}
+	return addr, nil
+}
@@ -0,0 +1,46 @@
+package walletsdk_test
+
+import (
+	"context"
+	"testing"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestDeployContracts(t *testing.T) {
+	chain := newChain(t)
+	alice := chain.Accounts[0]
+
+	config := walletsdk.ClientConfig{PrivateKey: alice.PrivateKeyHex()}
+	client, err := walletsdk.DeployContracts(context.Background(), chain.Backend.Client(), config, tokens(500))
+	if err != nil {
+		t.Fatalf("DeployContracts: %v", err)
+	}
+
+	supply, err := client.GetTotalSupply()
+	if err != nil {
+		t.Fatalf("GetTotalSupply: %v", err)
+	}
+	if supply.Cmp(tokens(500)) != 0 {
+		t.Fatalf("GetTotalSupply = %s, want %s", supply, tokens(500))
+	}
+	expectBalance(t, client, tokens(500), alice)
+
+	tx, err := client.AddFunds(tokens(20), "device")
+	mined(t, chain, tx, err)
+	balance, err := client.GetStakeBalance("device")
+	if err != nil {
+		t.Fatalf("GetStakeBalance: %v", err)
+	}
+	if balance.Cmp(tokens(20)) != 0 {
+		t.Fatalf("GetStakeBalance = %s, want %s", balance, tokens(20))
+	}
+}
+
+func TestDeployStakeWalletRequiresToken(t *testing.T) {
+	chain := newChain(t)
+	config := walletsdk.ClientConfig{PrivateKey: chain.Accounts[0].PrivateKeyHex()}
+	if _, err := walletsdk.DeployStakeWallet(context.Background(), chain.Backend.Client(), config); err == nil {
+		t.Fatal("DeployStakeWallet accepted a config without a token address")
+	}
+}
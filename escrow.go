@@ -0,0 +1,438 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Hold states
+const (
+	// HoldActive holds reserve stake for a task that is still open
+	HoldActive = "active"
+	// HoldSettling holds are being paid to their solver
+	HoldSettling = "settling"
+	// HoldSettled holds were paid to their solver
+	HoldSettled = "settled"
+	// HoldReleased holds were cancelled without payment
+	HoldReleased = "released"
+	// HoldExpired holds timed out without payment
+	HoldExpired = "expired"
+)
+
+// ErrHoldNotFound is returned for hold IDs the escrow does not know
+var ErrHoldNotFound = errors.New("hold not found")
+
+// Hold reserves part of a creator device's stake for one task
+type Hold struct {
+	ID      string    `json:"id"`
+	Creator string    `json:"creator"`
+	Amount  *big.Int  `json:"amount"`
+	Status  string    `json:"status"`
+	Expires time.Time `json:"expires"`
+	Updated time.Time `json:"updated"`
+	// Solver is the device paid on completion
+	Solver string `json:"solver,omitempty"`
+	// Tx is the signed payment, stored before it is broadcast
+	Tx *types.Transaction `json:"tx,omitempty"`
+	// Attempt counts the payments tried for the hold. Each is settled under
+	// its own payment ID, so a hold can be paid to another solver after a
+	// payment failed.
+	Attempt int `json:"attempt,omitempty"`
+	// Reason explains the last failed payment attempt
+	Reason string `json:"reason,omitempty"`
+}
+
+// open reports whether the hold still reserves stake
+func (h *Hold) open() bool {
+	return h.Status == HoldActive || h.Status == HoldSettling
+}
+
+// payment returns the payment of the hold's current attempt
+func (h *Hold) payment() Payment {
+	return Payment{ID: fmt.Sprintf("%s#%d", h.ID, h.Attempt), Creator: h.Creator, Solver: h.Solver, Amount: h.Amount}
+}
+
+// EscrowStore persists holds across restarts
+type EscrowStore interface {
+	// Save durably stores the latest state of the hold
+	Save(hold *Hold) error
+	// Load returns the latest state of every saved hold
+	Load() ([]Hold, error)
+}
+
+// EscrowOptions configures an Escrow
+type EscrowOptions struct {
+	// TTL is how long holds last when Reserve is given no timeout, 24
+	// hours by default
+	TTL time.Duration
+	// Settlement configures the settler that pays completed holds
+	Settlement SettlementOptions
+}
+
+// Escrow reserves creator stake when tasks are posted, pays solvers through
+// TransferPayment on completion and releases holds on cancellation or
+// timeout. Holds are kept off chain and saved to a store, so reservations
+// and payments in flight survive restarts.
+type Escrow struct {
+	client  *Client
+	store   EscrowStore
+	settler *Settler
+	options EscrowOptions
+
+	mu    sync.Mutex
+	holds map[string]*Hold
+}
+
+// NewEscrow returns an escrow signing payments with client and resumes the
+// holds saved in store
+func NewEscrow(client *Client, store EscrowStore, options EscrowOptions) (*Escrow, error) {
+	if client.stakeWallet == nil {
+		return nil, fmt.Errorf("stake wallet not initialized")
+	}
+	if options.TTL <= 0 {
+		options.TTL = 24 * time.Hour
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load holds: %w", err)
+	}
+
+	e := &Escrow{client: client, store: store, options: options, holds: make(map[string]*Hold, len(saved))}
+	settlement := options.Settlement
+	onSigned := settlement.OnSigned
+	settlement.OnSigned = func(p Payment, tx *types.Transaction) error {
+		if onSigned != nil {
+			if err := onSigned(p, tx); err != nil {
+				return err
+			}
+		}
+		return e.signed(p, tx)
+	}
+	e.settler = NewSettler(client, settlement)
+
+	for i := range saved {
+		hold := &saved[i]
+		e.holds[hold.ID] = hold
+		if hold.Status == HoldSettling && hold.Tx != nil {
+			e.settler.restore(hold.payment(), hold.Tx)
+		}
+	}
+	return e, nil
+}
+
+// Reserve holds amount of the creator's stake until the hold is completed,
+// cancelled or ttl passes. It fails with ErrInsufficientStake when the
+// on-chain balance minus the creator's open holds does not cover amount.
+// Reserving an ID again with the same creator and amount returns the
+// existing hold.
+func (e *Escrow) Reserve(ctx context.Context, id, creator string, amount *big.Int, ttl time.Duration) (Hold, error) {
+	switch {
+	case id == "":
+		return Hold{}, fmt.Errorf("hold ID is required")
+	case creator == "":
+		return Hold{}, fmt.Errorf("hold %s: creator device is required", id)
+	case amount == nil || amount.Sign() <= 0:
+		return Hold{}, fmt.Errorf("hold %s: amount must be positive", id)
+	}
+	if ttl <= 0 {
+		ttl = e.options.TTL
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.expire(time.Now()); err != nil {
+		return Hold{}, err
+	}
+
+	if hold, ok := e.holds[id]; ok {
+		if hold.Creator != creator || hold.Amount.Cmp(amount) != 0 || !hold.open() {
+			return Hold{}, fmt.Errorf("hold %s already exists (%s)", id, hold.Status)
+		}
+		return *hold, nil
+	}
+
+	available, err := e.available(ctx, creator)
+	if err != nil {
+		return Hold{}, err
+	}
+	if available.Cmp(amount) < 0 {
+		return Hold{}, fmt.Errorf("%w: %s has %s available, hold needs %s", ErrInsufficientStake, creator, available, amount)
+	}
+
+	now := time.Now().UTC()
+	hold := &Hold{
+		ID:      id,
+		Creator: creator,
+		Amount:  new(big.Int).Set(amount),
+		Status:  HoldActive,
+		Expires: now.Add(ttl),
+		Updated: now,
+	}
+	if err := e.store.Save(hold); err != nil {
+		return Hold{}, fmt.Errorf("failed to save hold: %w", err)
+	}
+	e.holds[id] = hold
+	e.client.logger.Info("stake reserved", "hold", id, "creator", creator, "amount", amount)
+	return *hold, nil
+}
+
+// Available returns the creator's stake balance minus its open holds
+func (e *Escrow) Available(ctx context.Context, creator string) (*big.Int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.expire(time.Now()); err != nil {
+		return nil, err
+	}
+	return e.available(ctx, creator)
+}
+
+// available returns the creator's balance minus open holds with e.mu held
+func (e *Escrow) available(ctx context.Context, creator string) (*big.Int, error) {
+	balance, err := e.client.stakeWallet.contract.GetBalance(&bind.CallOpts{Context: ctx}, creator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance of %s: %w", creator, err)
+	}
+	for _, hold := range e.holds {
+		if hold.Creator == creator && hold.open() {
+			balance.Sub(balance, hold.Amount)
+		}
+	}
+	return balance, nil
+}
+
+// Complete pays the hold to the solver device and waits until the payment is
+// mined or ctx ends. A hold whose payment is still pending, or whose signed
+// payment could not be accounted for, can be completed again to keep
+// working on the same payment; the hold stays reserved until then.
+func (e *Escrow) Complete(ctx context.Context, id, solver string) (Hold, error) {
+	if solver == "" {
+		return Hold{}, fmt.Errorf("hold %s: solver device is required", id)
+	}
+
+	e.mu.Lock()
+	if _, err := e.expire(time.Now()); err != nil {
+		e.mu.Unlock()
+		return Hold{}, err
+	}
+	hold, ok := e.holds[id]
+	switch {
+	case !ok:
+		e.mu.Unlock()
+		return Hold{}, fmt.Errorf("%w: %s", ErrHoldNotFound, id)
+	case hold.Status == HoldSettled:
+		e.mu.Unlock()
+		return *hold, nil
+	case hold.Status == HoldSettling && hold.Solver != solver:
+		e.mu.Unlock()
+		return Hold{}, fmt.Errorf("hold %s is already being paid to %s", id, hold.Solver)
+	case !hold.open():
+		e.mu.Unlock()
+		return Hold{}, fmt.Errorf("hold %s is %s", id, hold.Status)
+	}
+	if hold.Status == HoldActive {
+		if err := e.update(hold, func(h *Hold) { h.Status, h.Solver, h.Attempt = HoldSettling, solver, h.Attempt+1 }); err != nil {
+			e.mu.Unlock()
+			return Hold{}, err
+		}
+	}
+	payment := hold.payment()
+	e.mu.Unlock()
+
+	results, err := e.settler.Settle(ctx, []Payment{payment})
+	if err != nil {
+		return Hold{}, err
+	}
+	result := results[0]
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch result.Status {
+	case PaymentConfirmed:
+		err = e.update(hold, func(h *Hold) { h.Status, h.Tx, h.Reason = HoldSettled, result.Tx, "" })
+		if err == nil {
+			e.client.logger.Info("hold settled", "hold", id, "solver", solver, "tx", result.Tx.Hash())
+		}
+		return *hold, err
+	case PaymentPending:
+		return *hold, fmt.Errorf("payment of hold %s is pending: %w", id, result.Err)
+	}
+
+	reason := result.Reason
+	failure := fmt.Errorf("payment of hold %s reverted: %s", id, reason)
+	if result.Status == PaymentNotSent {
+		reason = result.Err.Error()
+		failure = fmt.Errorf("payment of hold %s not sent: %w", id, result.Err)
+		if hold.Tx != nil {
+			return e.reconcile(ctx, hold, reason, failure)
+		}
+	}
+
+	// No stake moved, so the hold stays reserved for another attempt
+	if err := e.update(hold, func(h *Hold) { h.Status, h.Solver, h.Tx, h.Reason = HoldActive, "", nil, reason }); err != nil {
+		return *hold, errors.Join(failure, err)
+	}
+	return *hold, failure
+}
+
+// reconcile checks the transaction saved for a hold whose payment was not
+// sent again. Until that transaction is known to be mined, the hold keeps
+// settling under the same attempt, so completing it again retries the same
+// payment ID and cannot pay twice.
+func (e *Escrow) reconcile(ctx context.Context, hold *Hold, reason string, failure error) (Hold, error) {
+	receipt, err := e.client.TransactionReceipt(ctx, hold.Tx.Hash())
+	switch {
+	case err == nil && receipt.Status == types.ReceiptStatusSuccessful:
+		if err := e.update(hold, func(h *Hold) { h.Status, h.Reason = HoldSettled, "" }); err != nil {
+			return *hold, err
+		}
+		e.client.logger.Info("hold settled", "hold", hold.ID, "solver", hold.Solver, "tx", hold.Tx.Hash())
+		return *hold, nil
+	case err == nil:
+		// Reverted on chain, so no stake moved
+		err = e.update(hold, func(h *Hold) { h.Status, h.Solver, h.Tx, h.Reason = HoldActive, "", nil, reason })
+	case errors.Is(err, ethereum.NotFound):
+		err = e.update(hold, func(h *Hold) { h.Reason = reason })
+	default:
+		failure = errors.Join(failure, fmt.Errorf("failed to get receipt of %s: %w", hold.Tx.Hash(), err))
+		err = e.update(hold, func(h *Hold) { h.Reason = reason })
+	}
+	if err != nil {
+		return *hold, errors.Join(failure, err)
+	}
+	return *hold, failure
+}
+
+// Cancel releases an active hold without payment
+func (e *Escrow) Cancel(id string) (Hold, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	hold, ok := e.holds[id]
+	switch {
+	case !ok:
+		return Hold{}, fmt.Errorf("%w: %s", ErrHoldNotFound, id)
+	case hold.Status == HoldReleased:
+		return *hold, nil
+	case hold.Status != HoldActive:
+		return Hold{}, fmt.Errorf("hold %s is %s", id, hold.Status)
+	}
+	if err := e.update(hold, func(h *Hold) { h.Status = HoldReleased }); err != nil {
+		return Hold{}, err
+	}
+	e.client.logger.Info("hold released", "hold", id)
+	return *hold, nil
+}
+
+// Expire releases active holds past their timeout and returns them. Expired
+// holds are also released lazily by every other escrow call.
+func (e *Escrow) Expire() ([]Hold, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.expire(time.Now())
+}
+
+// expire marks active holds past their timeout as expired
+func (e *Escrow) expire(now time.Time) ([]Hold, error) {
+	var expired []Hold
+	for _, hold := range e.holds {
+		if hold.Status == HoldActive && now.After(hold.Expires) {
+			if err := e.update(hold, func(h *Hold) { h.Status = HoldExpired }); err != nil {
+				return expired, err
+			}
+			e.client.logger.Info("hold expired", "hold", hold.ID)
+			expired = append(expired, *hold)
+		}
+	}
+	return expired, nil
+}
+
+// Hold returns the hold with the given ID
+func (e *Escrow) Hold(id string) (Hold, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	hold, ok := e.holds[id]
+	if !ok {
+		return Hold{}, false
+	}
+	return *hold, true
+}
+
+// Holds returns the open holds of the creator device
+func (e *Escrow) Holds(creator string) []Hold {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var holds []Hold
+	for _, hold := range e.holds {
+		if hold.Creator == creator && hold.open() {
+			holds = append(holds, *hold)
+		}
+	}
+	return holds
+}
+
+// signed saves the signed payment of a settling hold before it is broadcast
+func (e *Escrow) signed(p Payment, tx *types.Transaction) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := strings.LastIndexByte(p.ID, '#')
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrHoldNotFound, p.ID)
+	}
+	hold, ok := e.holds[p.ID[:i]]
+	if !ok || hold.payment().ID != p.ID {
+		return fmt.Errorf("%w: %s", ErrHoldNotFound, p.ID)
+	}
+	return e.update(hold, func(h *Hold) { h.Tx = tx })
+}
+
+// update applies change to a copy of the hold, saves it and only then
+// replaces the hold, so memory never runs ahead of the store
+func (e *Escrow) update(hold *Hold, change func(*Hold)) error {
+	next := *hold
+	change(&next)
+	next.Updated = time.Now().UTC()
+	if err := e.store.Save(&next); err != nil {
+		return fmt.Errorf("failed to save hold %s: %w", hold.ID, err)
+	}
+	*hold = next
+	return nil
+}
+
+// FileEscrowStore saves holds to a JSONL file, appending the new state of a
+// hold on every change
+type FileEscrowStore struct {
+	file *jsonlFile
+}
+
+// NewFileEscrowStore opens or creates a JSONL escrow file
+func NewFileEscrowStore(path string) (*FileEscrowStore, error) {
+	file, err := openJSONL(path, "escrow")
+	if err != nil {
+		return nil, err
+	}
+	return &FileEscrowStore{file: file}, nil
+}
+
+// Save writes the hold as a single line and syncs the file
+func (s *FileEscrowStore) Save(hold *Hold) error {
+	return s.file.append(hold)
+}
+
+// Load returns the last saved state of each hold in the file
+func (s *FileEscrowStore) Load() ([]Hold, error) {
+	return readLatest(s.file, "hold", func(hold *Hold) string { return hold.ID })
+}
+
+// Close closes the escrow file
+func (s *FileEscrowStore) Close() error {
+	return s.file.close()
+}
@@ -0,0 +1,231 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+func newEscrow(t *testing.T, client *walletsdk.Client, path string) *walletsdk.Escrow {
+	t.Helper()
+	store, err := walletsdk.NewFileEscrowStore(path)
+	if err != nil {
+		t.Fatalf("NewFileEscrowStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	escrow, err := walletsdk.NewEscrow(client, store, walletsdk.EscrowOptions{})
+	if err != nil {
+		t.Fatalf("NewEscrow: %v", err)
+	}
+	return escrow
+}
+
+func TestEscrow(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(10), "solver": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	path := filepath.Join(t.TempDir(), "escrow.jsonl")
+	escrow := newEscrow(t, owner, path)
+	ctx := context.Background()
+
+	if _, err := escrow.Reserve(ctx, "task-1", "creator", tokens(6), 0); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := escrow.Reserve(ctx, "task-2", "creator", tokens(5), 0); !errors.Is(err, walletsdk.ErrInsufficientStake) {
+		t.Fatalf("reservation above the available stake: %v", err)
+	}
+	if _, err := escrow.Reserve(ctx, "task-2", "creator", tokens(3), 0); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := escrow.Reserve(ctx, "task-1", "creator", tokens(6), 0); err != nil {
+		t.Fatalf("repeated reservation: %v", err)
+	}
+	if _, err := escrow.Reserve(ctx, "task-1", "creator", tokens(1), 0); err == nil {
+		t.Fatal("changed reservation accepted under the same ID")
+	}
+	if available, _ := escrow.Available(ctx, "creator"); available.Cmp(tokens(1)) != 0 {
+		t.Fatalf("available = %s", available)
+	}
+
+	// Cancelling and timing out free the reserved stake
+	if hold, err := escrow.Cancel("task-2"); err != nil || hold.Status != walletsdk.HoldReleased {
+		t.Fatalf("Cancel: %+v, %v", hold, err)
+	}
+	if _, err := escrow.Reserve(ctx, "task-3", "creator", tokens(4), 50*time.Millisecond); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if expired, err := escrow.Expire(); err != nil || len(expired) != 1 || expired[0].ID != "task-3" {
+		t.Fatalf("Expire: %+v, %v", expired, err)
+	}
+	if _, err := escrow.Complete(ctx, "task-3", "solver"); err == nil {
+		t.Fatal("expired hold paid")
+	}
+
+	hold, err := escrow.Complete(ctx, "task-1", "solver")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if hold.Status != walletsdk.HoldSettled || hold.Tx == nil {
+		t.Fatalf("completed hold: %+v", hold)
+	}
+	expectStake(t, owner, "creator", tokens(4))
+	expectStake(t, owner, "solver", tokens(7))
+	if _, err := escrow.Cancel("task-1"); err == nil {
+		t.Fatal("settled hold cancelled")
+	}
+
+	// A failed payment leaves the hold reserved for another solver
+	if _, err := escrow.Reserve(ctx, "task-4", "creator", tokens(2), 0); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if hold, err := escrow.Complete(ctx, "task-4", "missing"); err == nil || hold.Status != walletsdk.HoldActive {
+		t.Fatalf("payment to missing solver: %+v, %v", hold, err)
+	}
+	if hold, err := escrow.Complete(ctx, "task-4", "solver"); err != nil || hold.Status != walletsdk.HoldSettled {
+		t.Fatalf("Complete: %+v, %v", hold, err)
+	}
+
+	// A restarted escrow keeps every hold, even after a crash halfway
+	// through saving one
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":"task-5","creator":"creator","amou`)
+	file.Close()
+	restarted := newEscrow(t, owner, path)
+	for id, want := range map[string]string{
+		"task-1": walletsdk.HoldSettled,
+		"task-2": walletsdk.HoldReleased,
+		"task-3": walletsdk.HoldExpired,
+		"task-4": walletsdk.HoldSettled,
+	} {
+		if hold, ok := restarted.Hold(id); !ok || hold.Status != want {
+			t.Errorf("hold %s after restart: %+v", id, hold)
+		}
+	}
+	if hold, err := restarted.Complete(ctx, "task-1", "solver"); err != nil || hold.Status != walletsdk.HoldSettled {
+		t.Fatalf("Complete after restart: %+v, %v", hold, err)
+	}
+	expectStake(t, owner, "creator", tokens(2))
+
+	// The torn line was cut off, so new holds are saved on lines of their own
+	if _, err := restarted.Reserve(ctx, "task-5", "creator", tokens(1), 0); err != nil {
+		t.Fatalf("Reserve after restart: %v", err)
+	}
+	if hold, ok := newEscrow(t, owner, path).Hold("task-5"); !ok || hold.Status != walletsdk.HoldActive {
+		t.Fatalf("hold task-5 after restart: %+v", hold)
+	}
+}
+
+func TestEscrowRestartPending(t *testing.T) {
+	opts := simulated.DefaultOptions()
+	opts.ManualCommit = true
+	chain, err := simulated.New(opts)
+	if err != nil {
+		t.Fatalf("failed to start simulated chain: %v", err)
+	}
+	t.Cleanup(func() { chain.Close() })
+
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				chain.Commit()
+			}
+		}
+	}()
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(2), "solver": tokens(1)})
+	close(stop)
+
+	owner := newClient(t, chain, chain.Owner)
+	path := filepath.Join(t.TempDir(), "escrow.jsonl")
+	escrow := newEscrow(t, owner, path)
+	if _, err := escrow.Reserve(context.Background(), "task", "creator", tokens(1), 0); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	pending, err := escrow.Complete(ctx, "task", "solver")
+	if err == nil || pending.Status != walletsdk.HoldSettling || pending.Tx == nil {
+		t.Fatalf("unmined payment: %+v, %v", pending, err)
+	}
+
+	// The restarted escrow waits for the saved transaction instead of paying again
+	restarted := newEscrow(t, owner, path)
+	if available, _ := restarted.Available(context.Background(), "creator"); available.Cmp(tokens(1)) != 0 {
+		t.Fatalf("available while settling = %s", available)
+	}
+	chain.Commit()
+	hold, err := restarted.Complete(context.Background(), "task", "solver")
+	if err != nil || hold.Status != walletsdk.HoldSettled || hold.Tx.Hash() != pending.Tx.Hash() {
+		t.Fatalf("resumed payment: %+v, %v", hold, err)
+	}
+	expectStake(t, owner, "creator", tokens(1))
+}
+
+func TestEscrowUnsentKeepsTx(t *testing.T) {
+	chain := newChain(t)
+	creator := newClient(t, chain, chain.Accounts[0])
+	tx, err := creator.AddFunds(tokens(5), "creator")
+	mined(t, chain, tx, err)
+	tx, err = newClient(t, chain, chain.Accounts[1]).AddFunds(tokens(1), "solver")
+	mined(t, chain, tx, err)
+
+	backend := &flakyBackend{Backend: chain.Backend.Client()}
+	dropping, err := walletsdk.NewClientWithBackend(backend, chain.Config(chain.Owner))
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	escrow := newEscrow(t, dropping, filepath.Join(t.TempDir(), "escrow.jsonl"))
+	ctx := context.Background()
+	if _, err := escrow.Reserve(ctx, "task", "creator", tokens(2), 0); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	// The signed payment is lost and another transaction takes its nonce
+	backend.fail(errors.New("connection reset"))
+	lost, err := escrow.Complete(ctx, "task", "solver")
+	if err == nil || lost.Status != walletsdk.HoldSettling || lost.Tx == nil {
+		t.Fatalf("lost payment: %+v, %v", lost, err)
+	}
+	backend.fail(nil)
+	tx, err = newClient(t, chain, chain.Owner).Mint(chain.Owner.Address, tokens(1))
+	mined(t, chain, tx, err)
+
+	// Resending fails before signing, so the hold keeps settling under the
+	// same attempt rather than starting a new payment
+	tx, _, err = creator.WithdrawAll("creator")
+	mined(t, chain, tx, err)
+	hold, err := escrow.Complete(ctx, "task", "solver")
+	if !errors.Is(err, walletsdk.ErrInsufficientStake) {
+		t.Fatalf("unfunded payment: %v", err)
+	}
+	if hold.Status != walletsdk.HoldSettling || hold.Attempt != lost.Attempt || hold.Tx.Hash() != lost.Tx.Hash() {
+		t.Fatalf("hold after unsent payment: %+v", hold)
+	}
+	if _, err := escrow.Cancel("task"); err == nil {
+		t.Fatal("settling hold cancelled")
+	}
+
+	tx, err = creator.AddFunds(tokens(5), "creator")
+	mined(t, chain, tx, err)
+	hold, err = escrow.Complete(ctx, "task", "solver")
+	if err != nil || hold.Status != walletsdk.HoldSettled || hold.Attempt != lost.Attempt {
+		t.Fatalf("completed hold: %+v, %v", hold, err)
+	}
+	expectStake(t, creator, "creator", tokens(3))
+	expectStake(t, creator, "solver", tokens(3))
+}
@@ -0,0 +1,587 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Endpoint is an RPC node used by a failover backend
+type Endpoint struct {
+	URL string
+	// Priority orders healthy endpoints, lower values are tried first
+	Priority int
+}
+
+// FailoverOptions configures a failover backend. Zero values use the
+// defaults noted on each field.
+type FailoverOptions struct {
+	// HealthInterval is the time between health probes, 15s by default.
+	// A negative interval disables background probing.
+	HealthInterval time.Duration
+	// ProbeTimeout bounds a single probe, 5s by default
+	ProbeTimeout time.Duration
+	// MaxBlockLag is how many blocks an endpoint may trail the highest one
+	// before it is considered unhealthy, 5 by default
+	MaxBlockLag uint64
+	// MaxLatency marks endpoints with slower probes unhealthy when set
+	MaxLatency time.Duration
+	// HedgeReads sends every read to the two fastest healthy endpoints and
+	// returns the first answer
+	HedgeReads bool
+	// ChainID is the chain every endpoint must serve. When zero, the first
+	// endpoint that answers decides.
+	ChainID int64
+	// Logger receives endpoint health changes and failovers
+	Logger *slog.Logger
+}
+
+func (o FailoverOptions) withDefaults() FailoverOptions {
+	if o.HealthInterval == 0 {
+		o.HealthInterval = 15 * time.Second
+	}
+	if o.ProbeTimeout == 0 {
+		o.ProbeTimeout = 5 * time.Second
+	}
+	if o.MaxBlockLag == 0 {
+		o.MaxBlockLag = 5
+	}
+	o.Logger = discardLogger(o.Logger)
+	return o
+}
+
+// EndpointStatus is the health of an endpoint as last observed
+type EndpointStatus struct {
+	Endpoint
+	Healthy     bool
+	Latency     time.Duration
+	BlockNumber uint64
+	// LastError is the error that last marked the endpoint unhealthy
+	LastError error
+	// Failures counts failed probes and requests since the last success
+	Failures int
+	// Quarantined endpoints serve another chain and are never used
+	Quarantined bool
+}
+
+type endpointState struct {
+	EndpointStatus
+	backend Backend
+	// verified is set once the endpoint reported the expected chain ID
+	verified bool
+}
+
+// FailoverBackend spreads requests over several RPC endpoints. Reads go to
+// the preferred healthy endpoint and fail over to the next one when the
+// endpoint itself fails. Transactions are broadcast to every endpoint.
+type FailoverBackend struct {
+	*middlewareBackend
+	options   FailoverOptions
+	endpoints []*endpointState
+
+	mu sync.RWMutex
+	// chainID is the chain of the endpoints, nil until one has answered
+	chainID   *big.Int
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DialFailover connects to every endpoint, checks that they serve the same
+// chain and starts health probing. Endpoints that cannot be reached yet are
+// kept and have their chain checked when they are first reached; those on
+// another chain are quarantined.
+func DialFailover(ctx context.Context, endpoints []Endpoint, options FailoverOptions) (*FailoverBackend, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no RPC endpoints configured")
+	}
+	f := &FailoverBackend{
+		options: options.withDefaults(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	f.middlewareBackend = &middlewareBackend{handle: f.handle, subscriber: f.subscriber}
+	if f.options.ChainID != 0 {
+		f.chainID = big.NewInt(f.options.ChainID)
+	}
+
+	for _, endpoint := range endpoints {
+		f.options.Logger.Info("connecting to RPC endpoint", "url", redactURL(endpoint.URL), "priority", endpoint.Priority)
+		client, err := ethclient.DialContext(ctx, endpoint.URL)
+		if err != nil {
+			f.closeEndpoints()
+			return nil, fmt.Errorf("failed to connect to %s: %w", redactURL(endpoint.URL), err)
+		}
+		f.endpoints = append(f.endpoints, &endpointState{
+			EndpointStatus: EndpointStatus{Endpoint: endpoint},
+			backend:        client,
+		})
+	}
+
+	if err := f.checkChainIDs(ctx); err != nil {
+		f.closeEndpoints()
+		return nil, err
+	}
+	f.Probe(ctx)
+
+	if f.options.HealthInterval > 0 {
+		go f.probeLoop()
+	} else {
+		close(f.done)
+	}
+	return f, nil
+}
+
+// checkChainIDs fails when reachable endpoints report different chains, or
+// another chain than FailoverOptions.ChainID
+func (f *FailoverBackend) checkChainIDs(ctx context.Context) error {
+	var first *endpointState
+	for _, ep := range f.endpoints {
+		probeCtx, cancel := context.WithTimeout(ctx, f.options.ProbeTimeout)
+		id, err := ep.backend.ChainID(probeCtx)
+		cancel()
+		if err != nil {
+			continue
+		}
+		switch {
+		case f.chainID == nil:
+			f.chainID = id
+		case id.Cmp(f.chainID) != 0 && first != nil:
+			return fmt.Errorf("endpoint %s serves chain %s but %s serves chain %s", redactURL(ep.URL), id, redactURL(first.URL), f.chainID)
+		case id.Cmp(f.chainID) != 0:
+			return fmt.Errorf("endpoint %s serves chain %s, expected chain %s", redactURL(ep.URL), id, f.chainID)
+		}
+		if first == nil {
+			first = ep
+		}
+		ep.verified = true
+	}
+	return nil
+}
+
+// verify checks the chain of an endpoint the first time it is reached and
+// quarantines it when the chain is wrong
+func (f *FailoverBackend) verify(ctx context.Context, ep *endpointState) error {
+	f.mu.RLock()
+	verified, quarantined, lastErr := ep.verified, ep.Quarantined, ep.LastError
+	f.mu.RUnlock()
+	switch {
+	case verified:
+		return nil
+	case quarantined:
+		return lastErr
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, f.options.ProbeTimeout)
+	id, err := ep.backend.ChainID(probeCtx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.chainID == nil {
+		f.chainID = id
+	}
+	if id.Cmp(f.chainID) != 0 {
+		err := fmt.Errorf("endpoint serves chain %s, expected chain %s", id, f.chainID)
+		f.fail(ep, err)
+		if !ep.Quarantined {
+			f.options.Logger.Error("RPC endpoint quarantined", "url", redactURL(ep.URL), "error", err)
+		}
+		ep.Quarantined = true
+		return err
+	}
+	ep.verified = true
+	return nil
+}
+
+// Probe checks the latency and block height of every endpoint now. Probes
+// also run every HealthInterval in the background.
+func (f *FailoverBackend) Probe(ctx context.Context) {
+	type probe struct {
+		height  uint64
+		latency time.Duration
+		err     error
+	}
+	probes := make([]probe, len(f.endpoints))
+
+	var wg sync.WaitGroup
+	for i, ep := range f.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpointState) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, f.options.ProbeTimeout)
+			defer cancel()
+			if err := f.verify(probeCtx, ep); err != nil {
+				probes[i].err = err
+				return
+			}
+			start := time.Now()
+			header, err := ep.backend.HeaderByNumber(probeCtx, nil)
+			probes[i].latency = time.Since(start)
+			if err != nil {
+				probes[i].err = err
+				return
+			}
+			probes[i].height = header.Number.Uint64()
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var highest uint64
+	for _, p := range probes {
+		if p.err == nil && p.height > highest {
+			highest = p.height
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, ep := range f.endpoints {
+		p := probes[i]
+		switch {
+		case ep.Quarantined:
+			continue
+		case p.err != nil:
+			f.fail(ep, fmt.Errorf("health probe failed: %w", p.err))
+			continue
+		case highest-p.height > f.options.MaxBlockLag:
+			f.fail(ep, fmt.Errorf("block %d trails highest block %d", p.height, highest))
+		case f.options.MaxLatency > 0 && p.latency > f.options.MaxLatency:
+			f.fail(ep, fmt.Errorf("probe took %s, limit is %s", p.latency, f.options.MaxLatency))
+		default:
+			if !ep.Healthy && ep.LastError != nil {
+				f.options.Logger.Info("RPC endpoint recovered", "url", redactURL(ep.URL), "block", p.height, "latency", p.latency)
+			}
+			ep.Healthy = true
+			ep.LastError = nil
+			ep.Failures = 0
+		}
+		ep.Latency = p.latency
+		ep.BlockNumber = p.height
+	}
+}
+
+// fail marks ep unhealthy. f.mu must be held.
+func (f *FailoverBackend) fail(ep *endpointState, err error) {
+	if ep.Healthy || ep.LastError == nil {
+		f.options.Logger.Warn("RPC endpoint unhealthy", "url", redactURL(ep.URL), "error", err)
+	}
+	ep.Healthy = false
+	ep.LastError = err
+	ep.Failures++
+}
+
+func (f *FailoverBackend) probeLoop() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.options.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-f.stop:
+				case <-ctx.Done():
+				}
+				cancel()
+			}()
+			f.Probe(ctx)
+			cancel()
+		}
+	}
+}
+
+// Status returns the health of every endpoint in preference order, followed
+// by quarantined endpoints
+func (f *FailoverBackend) Status() []EndpointStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	status := make([]EndpointStatus, 0, len(f.endpoints))
+	for _, ep := range f.ordered() {
+		status = append(status, ep.EndpointStatus)
+	}
+	for _, ep := range f.endpoints {
+		if ep.Quarantined {
+			status = append(status, ep.EndpointStatus)
+		}
+	}
+	return status
+}
+
+// Close stops health probing and closes every endpoint connection
+func (f *FailoverBackend) Close() {
+	f.closeOnce.Do(func() {
+		close(f.stop)
+		<-f.done
+		f.closeEndpoints()
+	})
+}
+
+func (f *FailoverBackend) closeEndpoints() {
+	for _, ep := range f.endpoints {
+		if closer, ok := ep.backend.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
+
+// ordered returns healthy endpoints by priority and latency, followed by
+// unhealthy ones as a last resort. Quarantined endpoints are left out.
+// f.mu must be held.
+func (f *FailoverBackend) ordered() []*endpointState {
+	var eps []*endpointState
+	for _, ep := range f.endpoints {
+		if !ep.Quarantined {
+			eps = append(eps, ep)
+		}
+	}
+	sort.SliceStable(eps, func(i, j int) bool {
+		a, b := eps[i], eps[j]
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Latency < b.Latency
+	})
+	return eps
+}
+
+// fastest returns up to n healthy endpoints with the lowest latency.
+// f.mu must be held.
+func (f *FailoverBackend) fastest(n int) []*endpointState {
+	var eps []*endpointState
+	for _, ep := range f.endpoints {
+		if ep.Healthy {
+			eps = append(eps, ep)
+		}
+	}
+	sort.SliceStable(eps, func(i, j int) bool { return eps[i].Latency < eps[j].Latency })
+	if len(eps) > n {
+		eps = eps[:n]
+	}
+	return eps
+}
+
+func (f *FailoverBackend) markFailed(ep *endpointState, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail(ep, err)
+}
+
+// noSubscriber fails log subscriptions when no endpoint can serve them
+type noSubscriber struct {
+	Backend
+	err error
+}
+
+func (s noSubscriber) SubscribeFilterLogs(context.Context, ethereum.FilterQuery, chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, s.err
+}
+
+func (f *FailoverBackend) subscriber() Backend {
+	f.mu.RLock()
+	ordered := f.ordered()
+	f.mu.RUnlock()
+
+	var errs []error
+	for _, ep := range ordered {
+		err := f.verify(context.Background(), ep)
+		if err == nil {
+			return ep.backend
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(ep.URL), err))
+	}
+	return noSubscriber{err: fmt.Errorf("no RPC endpoint can subscribe: %w", errors.Join(errs...))}
+}
+
+func (f *FailoverBackend) handle(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error) {
+	if req.Write {
+		return f.broadcast(ctx, call)
+	}
+
+	f.mu.RLock()
+	ordered := f.ordered()
+	var hedged []*endpointState
+	if f.options.HedgeReads {
+		hedged = f.fastest(2)
+	}
+	f.mu.RUnlock()
+
+	var errs []error
+	if len(hedged) > 1 {
+		v, err, answered := f.hedge(ctx, call, hedged)
+		if answered {
+			return v, err
+		}
+		errs = append(errs, err)
+		ordered = without(ordered, hedged)
+	}
+
+	for _, ep := range ordered {
+		if err := f.verify(ctx, ep); err != nil {
+			f.markFailed(ep, err)
+			errs = append(errs, fmt.Errorf("%s: %w", redactURL(ep.URL), err))
+			continue
+		}
+		v, err := call(ctx, ep.backend)
+		if err == nil || !isEndpointFailure(err) {
+			return v, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		f.markFailed(ep, err)
+		f.options.Logger.Warn("failing over RPC request", "method", req.Method, "url", redactURL(ep.URL), "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(ep.URL), err))
+	}
+	return nil, fmt.Errorf("all RPC endpoints failed: %w", errors.Join(errs...))
+}
+
+// hedge sends a read to every endpoint in eps at once and returns the first
+// answer. answered is false when every endpoint failed.
+func (f *FailoverBackend) hedge(ctx context.Context, call backendCall, eps []*endpointState) (v interface{}, err error, answered bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		ep  *endpointState
+		v   interface{}
+		err error
+	}
+	results := make(chan result, len(eps))
+	for _, ep := range eps {
+		go func(ep *endpointState) {
+			if err := f.verify(ctx, ep); err != nil {
+				results <- result{ep: ep, err: err}
+				return
+			}
+			v, err := call(ctx, ep.backend)
+			results <- result{ep: ep, v: v, err: err}
+		}(ep)
+	}
+
+	var errs []error
+	for range eps {
+		r := <-results
+		if r.err == nil || !isEndpointFailure(r.err) || ctx.Err() != nil {
+			return r.v, r.err, true
+		}
+		f.markFailed(r.ep, r.err)
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(r.ep.URL), r.err))
+	}
+	return nil, errors.Join(errs...), false
+}
+
+// broadcast sends a transaction through every endpoint and succeeds when at
+// least one accepts it
+func (f *FailoverBackend) broadcast(ctx context.Context, call backendCall) (interface{}, error) {
+	f.mu.RLock()
+	ordered := f.ordered()
+	f.mu.RUnlock()
+
+	errs := make([]error, len(ordered))
+	var wg sync.WaitGroup
+	for i, ep := range ordered {
+		wg.Add(1)
+		go func(i int, ep *endpointState) {
+			defer wg.Done()
+			if errs[i] = f.verify(ctx, ep); errs[i] == nil {
+				_, errs[i] = call(ctx, ep.backend)
+			}
+		}(i, ep)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return struct{}{}, nil
+		}
+	}
+	// Prefer a rejection by a node, such as nonce too low, over
+	// connection failures
+	for _, err := range errs {
+		if !isEndpointFailure(err) {
+			return nil, err
+		}
+	}
+	for i, ep := range ordered {
+		f.markFailed(ep, errs[i])
+		errs[i] = fmt.Errorf("%s: %w", redactURL(ep.URL), errs[i])
+	}
+	return nil, fmt.Errorf("all RPC endpoints failed: %w", errors.Join(errs...))
+}
+
+func without(eps, remove []*endpointState) []*endpointState {
+	var kept []*endpointState
+outer:
+	for _, ep := range eps {
+		for _, r := range remove {
+			if ep == r {
+				continue outer
+			}
+		}
+		kept = append(kept, ep)
+	}
+	return kept
+}
+
+// answerErrors are messages of JSON-RPC errors that are answers from the
+// chain rather than faults of the node that returned them
+var answerErrors = []string{
+	"execution reverted",
+	"invalid opcode",
+	"out of gas",
+	"gas required exceeds",
+	"insufficient funds",
+	"nonce too low",
+	"already known",
+	"replacement transaction underpriced",
+	"intrinsic gas too low",
+}
+
+// isEndpointFailure reports whether err is a fault of the endpoint, such as
+// a connection error or an overloaded node, after which another endpoint may
+// answer differently. Reverts, invalid params and missing results are the
+// same on every endpoint.
+func isEndpointFailure(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case 3, -32602:
+			return false
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, answer := range answerErrors {
+		if strings.Contains(msg, answer) {
+			return false
+		}
+	}
+	return true
+}
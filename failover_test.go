@@ -0,0 +1,353 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+// stubNode is an httptest stand-in for an RPC node serving the few methods
+// the failover and retry tests need
+type stubNode struct {
+	URL       string
+	chainID   uint64
+	code      []byte
+	codeDelay time.Duration
+	height    atomic.Uint64
+	failing   atomic.Bool
+	reverting atomic.Bool
+	codeCalls atomic.Int32
+	sent      atomic.Int32
+	// throttle answers this many HTTP requests with 429
+	throttle atomic.Int32
+	// codeErrors fail this many getCode calls with codeErr
+	codeErrors atomic.Int32
+	codeErr    error
+
+	mu       sync.Mutex
+	sendErrs []error
+	raw      [][]byte
+}
+
+func newStubNode(t *testing.T, code string, height uint64) *stubNode {
+	t.Helper()
+	node := &stubNode{chainID: simulated.ChainID, code: []byte(code)}
+	node.height.Store(height)
+	node.start(t)
+	return node
+}
+
+func (n *stubNode) start(t *testing.T) {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &stubEth{node: n}); err != nil {
+		t.Fatalf("failed to register stub service: %v", err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.throttle.Add(-1) >= 0 {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	n.URL = httpServer.URL
+}
+
+type stubEth struct {
+	node *stubNode
+}
+
+var errStubDown = errors.New("stub node unavailable")
+
+// stubRevert is a JSON-RPC revert as returned by geth for eth_call
+type stubRevert struct{}
+
+func (stubRevert) Error() string          { return "execution reverted" }
+func (stubRevert) ErrorCode() int         { return 3 }
+func (stubRevert) ErrorData() interface{} { return "0x" }
+
+func (s *stubEth) ChainId() (hexutil.Uint64, error) {
+	if s.node.failing.Load() {
+		return 0, errStubDown
+	}
+	return hexutil.Uint64(s.node.chainID), nil
+}
+
+func (s *stubEth) GetBlockByNumber(number string, full bool) (*types.Header, error) {
+	if s.node.failing.Load() {
+		return nil, errStubDown
+	}
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(s.node.height.Load()),
+		Difficulty: new(big.Int),
+	}, nil
+}
+
+func (s *stubEth) GetCode(ctx context.Context, addr common.Address, block string) (hexutil.Bytes, error) {
+	s.node.codeCalls.Add(1)
+	if s.node.failing.Load() {
+		return nil, errStubDown
+	}
+	if s.node.reverting.Load() {
+		return nil, stubRevert{}
+	}
+	if s.node.codeErrors.Add(-1) >= 0 {
+		return nil, s.node.codeErr
+	}
+	select {
+	case <-time.After(s.node.codeDelay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.node.code, nil
+}
+
+func (s *stubEth) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	if s.node.failing.Load() {
+		return common.Hash{}, errStubDown
+	}
+	s.node.sent.Add(1)
+	s.node.mu.Lock()
+	defer s.node.mu.Unlock()
+	s.node.raw = append(s.node.raw, raw)
+	if len(s.node.sendErrs) > 0 {
+		err := s.node.sendErrs[0]
+		s.node.sendErrs = s.node.sendErrs[1:]
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(raw), nil
+}
+
+func dialFailover(t *testing.T, options walletsdk.FailoverOptions, nodes ...*stubNode) *walletsdk.FailoverBackend {
+	t.Helper()
+	var endpoints []walletsdk.Endpoint
+	for i, node := range nodes {
+		endpoints = append(endpoints, walletsdk.Endpoint{URL: node.URL, Priority: i})
+	}
+	// Probe on demand so tests control when health changes
+	options.HealthInterval = -1
+	backend, err := walletsdk.DialFailover(context.Background(), endpoints, options)
+	if err != nil {
+		t.Fatalf("DialFailover: %v", err)
+	}
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// signedTx returns a signed transfer for the stub nodes to accept
+func signedTx(t *testing.T) *types.Transaction {
+	t.Helper()
+	key, _ := crypto.GenerateKey()
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.LatestSignerForChainID(big.NewInt(simulated.ChainID)), key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return tx
+}
+
+func expectCode(t *testing.T, backend walletsdk.Backend, want string) {
+	t.Helper()
+	code, err := backend.CodeAt(context.Background(), common.Address{}, nil)
+	if err != nil {
+		t.Fatalf("CodeAt: %v", err)
+	}
+	if string(code) != want {
+		t.Fatalf("CodeAt served by %q, want %q", code, want)
+	}
+}
+
+func TestFailoverPrefersPriority(t *testing.T) {
+	primary := newStubNode(t, "primary", 100)
+	secondary := newStubNode(t, "secondary", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, primary, secondary)
+
+	expectCode(t, backend, "primary")
+	if calls := secondary.codeCalls.Load(); calls != 0 {
+		t.Fatalf("secondary served %d reads, want 0", calls)
+	}
+}
+
+func TestFailoverOnError(t *testing.T) {
+	primary := newStubNode(t, "primary", 100)
+	secondary := newStubNode(t, "secondary", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, primary, secondary)
+
+	primary.failing.Store(true)
+	expectCode(t, backend, "secondary")
+
+	status := backend.Status()
+	if status[0].URL != secondary.URL || status[1].Healthy || status[1].LastError == nil {
+		t.Fatalf("failed primary not demoted: %+v", status)
+	}
+
+	// The next probe restores the primary
+	primary.failing.Store(false)
+	backend.Probe(context.Background())
+	expectCode(t, backend, "primary")
+}
+
+func TestFailoverSkipsLaggingEndpoint(t *testing.T) {
+	primary := newStubNode(t, "primary", 90)
+	secondary := newStubNode(t, "secondary", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{MaxBlockLag: 5}, primary, secondary)
+
+	expectCode(t, backend, "secondary")
+	if calls := primary.codeCalls.Load(); calls != 0 {
+		t.Fatalf("lagging primary served %d reads, want 0", calls)
+	}
+
+	primary.height.Store(98)
+	backend.Probe(context.Background())
+	expectCode(t, backend, "primary")
+}
+
+func TestFailoverDoesNotRetryReverts(t *testing.T) {
+	primary := newStubNode(t, "primary", 100)
+	secondary := newStubNode(t, "secondary", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, primary, secondary)
+
+	primary.reverting.Store(true)
+	_, err := backend.CodeAt(context.Background(), common.Address{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("expected revert, got %v", err)
+	}
+	if calls := secondary.codeCalls.Load(); calls != 0 {
+		t.Fatalf("revert was failed over to secondary")
+	}
+	if !backend.Status()[0].Healthy {
+		t.Fatalf("revert marked the primary unhealthy")
+	}
+}
+
+func TestFailoverAllEndpointsDown(t *testing.T) {
+	primary := newStubNode(t, "primary", 100)
+	secondary := newStubNode(t, "secondary", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, primary, secondary)
+
+	primary.failing.Store(true)
+	secondary.failing.Store(true)
+	_, err := backend.CodeAt(context.Background(), common.Address{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "all RPC endpoints failed") {
+		t.Fatalf("expected all endpoints to fail, got %v", err)
+	}
+}
+
+func TestFailoverHedgedReads(t *testing.T) {
+	slow := newStubNode(t, "slow", 100)
+	slow.codeDelay = 5 * time.Second
+	fast := newStubNode(t, "fast", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{HedgeReads: true}, slow, fast)
+
+	start := time.Now()
+	expectCode(t, backend, "fast")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("hedged read waited %s for the slow endpoint", elapsed)
+	}
+	if slow.codeCalls.Load() != 1 {
+		t.Fatalf("read was not hedged to the preferred endpoint")
+	}
+}
+
+func TestFailoverBroadcastsWrites(t *testing.T) {
+	first := newStubNode(t, "first", 100)
+	second := newStubNode(t, "second", 100)
+	third := newStubNode(t, "third", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, first, second, third)
+
+	tx := signedTx(t)
+	second.failing.Store(true)
+	if err := backend.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	if first.sent.Load() != 1 || third.sent.Load() != 1 {
+		t.Fatalf("transaction not broadcast to every healthy endpoint: %d, %d", first.sent.Load(), third.sent.Load())
+	}
+}
+
+func TestDialFailoverRejectsMixedChains(t *testing.T) {
+	mainnet := newStubNode(t, "mainnet", 100)
+	other := &stubNode{chainID: 5, code: []byte("other")}
+	other.start(t)
+
+	_, err := walletsdk.DialFailover(context.Background(), []walletsdk.Endpoint{{URL: mainnet.URL}, {URL: other.URL}}, walletsdk.FailoverOptions{HealthInterval: -1})
+	if err == nil || !strings.Contains(err.Error(), "serves chain") {
+		t.Fatalf("expected chain mismatch, got %v", err)
+	}
+}
+
+func TestFailoverQuarantinesLateWrongChain(t *testing.T) {
+	wrong := &stubNode{chainID: 5, code: []byte("wrong")}
+	wrong.height.Store(100)
+	wrong.start(t)
+	wrong.failing.Store(true)
+	good := newStubNode(t, "good", 100)
+	backend := dialFailover(t, walletsdk.FailoverOptions{}, wrong, good)
+
+	// Comes up on another chain after dialing; the first request checks it
+	wrong.failing.Store(false)
+	if err := backend.SendTransaction(context.Background(), signedTx(t)); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	if wrong.sent.Load() != 0 || good.sent.Load() != 1 {
+		t.Fatalf("broadcast to %d wrong-chain and %d good endpoints", wrong.sent.Load(), good.sent.Load())
+	}
+	backend.Probe(context.Background())
+	expectCode(t, backend, "good")
+
+	status := backend.Status()
+	if last := status[len(status)-1]; last.URL != wrong.URL || !last.Quarantined || last.Healthy {
+		t.Fatalf("wrong-chain endpoint status = %+v", last)
+	}
+	if wrong.codeCalls.Load() != 0 {
+		t.Fatal("read served by the wrong chain")
+	}
+}
+
+func TestNewClientWithEndpoints(t *testing.T) {
+	chain := newChain(t)
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	config := chain.Config(chain.Accounts[0])
+	config.RPCURL = ""
+	config.Endpoints = []walletsdk.Endpoint{
+		{URL: down.URL, Priority: 0},
+		{URL: chain.RPCURL(), Priority: 1},
+	}
+	config.Failover.HealthInterval = -1
+	client, err := walletsdk.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	recipient := chain.Accounts[1]
+	before, err := client.GetBalance(recipient.Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	tx, err := client.Transfer(recipient.Address, tokens(5))
+	mined(t, chain, tx, err)
+	expectBalance(t, client, new(big.Int).Add(before, tokens(5)), recipient)
+}
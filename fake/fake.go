@@ -0,0 +1,469 @@
+// Package fake provides an in-memory implementation of the SDK token and
+// stake services for tests that do not need a chain
+package fake
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// Default addresses of the fake contracts
+var (
+	TokenAddress = common.HexToAddress("0x00000000000000000000000000000000000070c1")
+	StakeAddress = common.HexToAddress("0x00000000000000000000000000000000000057a1")
+)
+
+var (
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	tokenABI   = mustParseABI(walletsdk.ParityTokenABI)
+	stakeABI   = mustParseABI(walletsdk.StakeWalletContractABI)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// RevertError mirrors the error a node returns when gas estimation of a
+// reverting call fails. Like rpc.DataError, ErrorData returns the hex encoded
+// revert data.
+type RevertError struct {
+	Reason string
+	Data   []byte
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+// ErrorData returns the revert data
+func (e *RevertError) ErrorData() interface{} {
+	return hexutil.Encode(e.Data)
+}
+
+// revert returns the error of a require(false, reason)
+func revert(reason string) error {
+	data := crypto.Keccak256([]byte("Error(string)"))[:4]
+	packed, _ := abi.Arguments{{Type: mustType("string")}}.Pack(reason)
+	return &RevertError{Reason: reason, Data: append(data, packed...)}
+}
+
+// revertAddress returns the error of a custom error taking an address. The
+// node does not decode custom errors, so the message carries no reason.
+func revertAddress(signature string, addr common.Address) error {
+	data := crypto.Keccak256([]byte(signature))[:4]
+	return &RevertError{Data: append(data, common.LeftPadBytes(addr.Bytes(), 32)...)}
+}
+
+func mustType(name string) abi.Type {
+	typ, err := abi.NewType(name, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+// wallet is a registered device wallet
+type wallet struct {
+	balance *big.Int
+	address common.Address
+}
+
+// Ledger holds the state of the fake token and stake contracts. Clients
+// created from the same ledger see each other's writes.
+type Ledger struct {
+	TokenAddress common.Address
+	StakeAddress common.Address
+
+	mu          sync.Mutex
+	tokenOwner  common.Address
+	stakeOwner  common.Address
+	totalSupply *big.Int
+	balances    map[common.Address]*big.Int
+	allowances  map[common.Address]map[common.Address]*big.Int
+	wallets     map[string]*wallet
+	nonces      map[common.Address]uint64
+}
+
+// NewLedger returns an empty ledger whose token and stake contracts are owned
+// by owner
+func NewLedger(owner common.Address) *Ledger {
+	return &Ledger{
+		TokenAddress: TokenAddress,
+		StakeAddress: StakeAddress,
+		tokenOwner:   owner,
+		stakeOwner:   owner,
+		totalSupply:  new(big.Int),
+		balances:     make(map[common.Address]*big.Int),
+		allowances:   make(map[common.Address]map[common.Address]*big.Int),
+		wallets:      make(map[string]*wallet),
+		nonces:       make(map[common.Address]uint64),
+	}
+}
+
+// Fund mints amount to addr without an owner check, for seeding test state
+func (l *Ledger) Fund(addr common.Address, amount *big.Int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.totalSupply.Add(l.totalSupply, amount)
+	l.balances[addr] = new(big.Int).Add(l.balance(addr), amount)
+}
+
+// TokenOwner returns the owner of the token contract
+func (l *Ledger) TokenOwner() common.Address {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokenOwner
+}
+
+// StakeOwner returns the owner of the stake contract
+func (l *Ledger) StakeOwner() common.Address {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stakeOwner
+}
+
+// Client returns a client that sends transactions from addr
+func (l *Ledger) Client(addr common.Address) *Client {
+	return &Client{ledger: l, address: addr}
+}
+
+func (l *Ledger) balance(addr common.Address) *big.Int {
+	if balance, ok := l.balances[addr]; ok {
+		return balance
+	}
+	return new(big.Int)
+}
+
+func (l *Ledger) allowance(owner, spender common.Address) *big.Int {
+	if allowance, ok := l.allowances[owner][spender]; ok {
+		return allowance
+	}
+	return new(big.Int)
+}
+
+func (l *Ledger) setAllowance(owner, spender common.Address, amount *big.Int) {
+	if l.allowances[owner] == nil {
+		l.allowances[owner] = make(map[common.Address]*big.Int)
+	}
+	l.allowances[owner][spender] = new(big.Int).Set(amount)
+}
+
+// transfer moves tokens like the token contract's internal _transfer
+func (l *Ledger) transfer(from, to common.Address, amount *big.Int) error {
+	if to == (common.Address{}) {
+		return revert("ERC20: transfer to zero address")
+	}
+	balance := l.balance(from)
+	if balance.Cmp(amount) < 0 {
+		return revert("ERC20: amount exceeds balance")
+	}
+	l.balances[from] = new(big.Int).Sub(balance, amount)
+	l.balances[to] = new(big.Int).Add(l.balance(to), amount)
+	return nil
+}
+
+// transferFrom spends the allowance of spender, leaving unlimited allowances
+// untouched
+func (l *Ledger) transferFrom(spender, from, to common.Address, amount *big.Int) error {
+	allowance := l.allowance(from, spender)
+	if allowance.Cmp(maxUint256) != 0 {
+		if allowance.Cmp(amount) < 0 {
+			return revert("ERC20: insufficient allowance")
+		}
+		if err := l.transfer(from, to, amount); err != nil {
+			return err
+		}
+		l.setAllowance(from, spender, new(big.Int).Sub(allowance, amount))
+		return nil
+	}
+	return l.transfer(from, to, amount)
+}
+
+// tx returns the transaction the real client would have sent for a call
+func (l *Ledger) tx(from, to common.Address, contract abi.ABI, method string, args ...interface{}) (*types.Transaction, error) {
+	data, err := contract.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	nonce := l.nonces[from]
+	l.nonces[from]++
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: new(big.Int),
+		To:       &to,
+		Value:    new(big.Int),
+		Data:     data,
+	}), nil
+}
+
+// Client is a fake of walletsdk.Client backed by a Ledger. Writes take effect
+// immediately and return unsigned transactions with the real calldata.
+type Client struct {
+	ledger  *Ledger
+	address common.Address
+}
+
+var (
+	_ walletsdk.TokenService = (*Client)(nil)
+	_ walletsdk.StakeService = (*Client)(nil)
+)
+
+// Address returns the address the client sends from
+func (c *Client) Address() common.Address {
+	return c.address
+}
+
+// GetBalance returns the token balance for an address
+func (c *Client) GetBalance(address common.Address) (*big.Int, error) {
+	c.ledger.mu.Lock()
+	defer c.ledger.mu.Unlock()
+	return new(big.Int).Set(c.ledger.balance(address)), nil
+}
+
+// GetTokenInfo returns token information
+func (c *Client) GetTokenInfo() (name string, symbol string, decimals uint8, err error) {
+	return "Parity Token", "PRTY", 18, nil
+}
+
+// GetAllowance returns the token allowance for owner and spender
+func (c *Client) GetAllowance(owner, spender common.Address) (*big.Int, error) {
+	c.ledger.mu.Lock()
+	defer c.ledger.mu.Unlock()
+	return new(big.Int).Set(c.ledger.allowance(owner, spender)), nil
+}
+
+// GetTotalSupply returns the total token supply
+func (c *Client) GetTotalSupply() (*big.Int, error) {
+	c.ledger.mu.Lock()
+	defer c.ledger.mu.Unlock()
+	return new(big.Int).Set(c.ledger.totalSupply), nil
+}
+
+// Transfer transfers tokens to an address
+func (c *Client) Transfer(to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return c.transfer("transfer", to, amount, to, amount)
+}
+
+// TransferWithData transfers tokens with additional data
+func (c *Client) TransferWithData(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error) {
+	return c.transfer("transferWithData", to, amount, to, amount, data)
+}
+
+// TransferWithDataAndCallback transfers tokens with data and callback
+func (c *Client) TransferWithDataAndCallback(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error) {
+	return c.transfer("transferWithDataAndCallback", to, amount, to, amount, data)
+}
+
+func (c *Client) transfer(method string, to common.Address, amount *big.Int, args ...interface{}) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.transfer(c.address, to, amount); err != nil {
+		return nil, err
+	}
+	return l.tx(c.address, l.TokenAddress, tokenABI, method, args...)
+}
+
+// Approve approves tokens for a spender
+func (c *Client) Approve(spender common.Address, amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if spender == (common.Address{}) {
+		return nil, revert("ERC20: approve to zero address")
+	}
+	l.setAllowance(c.address, spender, amount)
+	return l.tx(c.address, l.TokenAddress, tokenABI, "approve", spender, amount)
+}
+
+// TransferFrom transfers tokens from one address to another
+func (c *Client) TransferFrom(from, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.transferFrom(c.address, from, to, amount); err != nil {
+		return nil, err
+	}
+	return l.tx(c.address, l.TokenAddress, tokenABI, "transferFrom", from, to, amount)
+}
+
+// Mint mints new tokens. Only the token owner may mint.
+func (c *Client) Mint(to common.Address, amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c.address != l.tokenOwner {
+		return nil, revertAddress("OwnableUnauthorizedAccount(address)", c.address)
+	}
+	if to == (common.Address{}) {
+		return nil, revert("ERC20: mint to zero address")
+	}
+	supply := new(big.Int).Add(l.totalSupply, amount)
+	if supply.Cmp(maxUint256) > 0 {
+		return nil, revert("ERC20: total supply overflow")
+	}
+	l.totalSupply = supply
+	l.balances[to] = new(big.Int).Add(l.balance(to), amount)
+	return l.tx(c.address, l.TokenAddress, tokenABI, "mint", to, amount)
+}
+
+// Burn burns tokens
+func (c *Client) Burn(amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	balance := l.balance(c.address)
+	if balance.Cmp(amount) < 0 {
+		return nil, revert("ERC20: burn exceeds balance")
+	}
+	l.balances[c.address] = new(big.Int).Sub(balance, amount)
+	l.totalSupply = new(big.Int).Sub(l.totalSupply, amount)
+	return l.tx(c.address, l.TokenAddress, tokenABI, "burn", amount)
+}
+
+// GetStakeInfo retrieves stake information for a device ID
+func (c *Client) GetStakeInfo(deviceID string) (walletsdk.StakeInfo, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.wallets[deviceID]
+	if !ok {
+		return walletsdk.StakeInfo{Amount: new(big.Int)}, nil
+	}
+	return walletsdk.StakeInfo{
+		Amount:        new(big.Int).Set(w.balance),
+		DeviceID:      deviceID,
+		WalletAddress: w.address,
+		Exists:        true,
+	}, nil
+}
+
+// GetStakeBalance returns the stake balance for a device ID
+func (c *Client) GetStakeBalance(deviceID string) (*big.Int, error) {
+	info, err := c.GetStakeInfo(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return info.Amount, nil
+}
+
+// AddFunds adds funds to a device's wallet. Like the real client it first
+// approves the stake contract, and the approval stands if adding fails.
+func (c *Client) AddFunds(amount *big.Int, deviceID string) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setAllowance(c.address, l.StakeAddress, amount)
+	if _, err := l.tx(c.address, l.TokenAddress, tokenABI, "approve", l.StakeAddress, amount); err != nil {
+		return nil, err
+	}
+
+	if amount.Sign() <= 0 {
+		return nil, revert("Amount must be greater than 0")
+	}
+	if err := l.transferFrom(l.StakeAddress, c.address, l.StakeAddress, amount); err != nil {
+		return nil, err
+	}
+	w, ok := l.wallets[deviceID]
+	if !ok {
+		w = &wallet{balance: new(big.Int), address: c.address}
+		l.wallets[deviceID] = w
+	}
+	w.balance = new(big.Int).Add(w.balance, amount)
+	return l.tx(c.address, l.StakeAddress, stakeABI, "addFunds", amount, deviceID, c.address)
+}
+
+// TransferPayment transfers stake between devices. Only the stake owner may
+// settle payments.
+func (c *Client) TransferPayment(creatorDeviceID, solverDeviceID string, amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c.address != l.stakeOwner {
+		return nil, revertAddress("OwnableUnauthorizedAccount(address)", c.address)
+	}
+	if amount.Sign() <= 0 {
+		return nil, revert("Amount must be greater than 0")
+	}
+	creator, ok := l.wallets[creatorDeviceID]
+	if !ok {
+		return nil, revert("Creator device not found")
+	}
+	solver, ok := l.wallets[solverDeviceID]
+	if !ok {
+		return nil, revert("Solver device not found")
+	}
+	if creator.balance.Cmp(amount) < 0 {
+		return nil, revert("Insufficient balance")
+	}
+	creator.balance = new(big.Int).Sub(creator.balance, amount)
+	solver.balance = new(big.Int).Add(solver.balance, amount)
+	return l.tx(c.address, l.StakeAddress, stakeABI, "transferPayment", creatorDeviceID, solverDeviceID, amount)
+}
+
+// WithdrawFunds withdraws staked tokens to the device wallet address
+func (c *Client) WithdrawFunds(deviceID string, amount *big.Int) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if amount.Sign() <= 0 {
+		return nil, revert("Amount must be greater than 0")
+	}
+	w, err := c.authorizedWallet(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if w.balance.Cmp(amount) < 0 {
+		return nil, revert("Insufficient balance")
+	}
+	if err := l.transfer(l.StakeAddress, w.address, amount); err != nil {
+		return nil, err
+	}
+	w.balance = new(big.Int).Sub(w.balance, amount)
+	return l.tx(c.address, l.StakeAddress, stakeABI, "withdrawFunds", deviceID, amount)
+}
+
+// UpdateWalletAddress updates the wallet address for a device ID
+func (c *Client) UpdateWalletAddress(deviceID string, newWalletAddr common.Address) (*types.Transaction, error) {
+	l := c.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if newWalletAddr == (common.Address{}) {
+		return nil, revert("Invalid wallet address")
+	}
+	w, err := c.authorizedWallet(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	w.address = newWalletAddr
+	return l.tx(c.address, l.StakeAddress, stakeABI, "updateWalletAddress", deviceID, newWalletAddr)
+}
+
+// authorizedWallet returns the device wallet if the client may manage it
+func (c *Client) authorizedWallet(deviceID string) (*wallet, error) {
+	w, ok := c.ledger.wallets[deviceID]
+	if !ok {
+		return nil, revert("Device not found")
+	}
+	if c.address != w.address && c.address != c.ledger.stakeOwner {
+		return nil, revert("Not authorized")
+	}
+	return w, nil
+}
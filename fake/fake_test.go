@@ -0,0 +1,212 @@
+package fake_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/fake"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+type service interface {
+	walletsdk.TokenService
+	walletsdk.StakeService
+}
+
+type step struct {
+	name string
+	as   int // index into the accounts, 0 is the owner
+	run  func(s service, accounts []common.Address) (*types.Transaction, error)
+}
+
+func tokens(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+// scenario exercises the success and revert paths of both contracts
+var scenario = []step{
+	{"transfer", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Transfer(a[2], tokens(10))
+	}},
+	{"transfer exceeds balance", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Transfer(a[2], tokens(5000))
+	}},
+	{"transfer to zero", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Transfer(common.Address{}, tokens(1))
+	}},
+	{"approve", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Approve(a[2], tokens(5))
+	}},
+	{"transferFrom", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferFrom(a[1], a[2], tokens(4))
+	}},
+	{"transferFrom over allowance", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferFrom(a[1], a[2], tokens(4))
+	}},
+	{"mint by non-owner", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Mint(a[1], tokens(1))
+	}},
+	{"mint", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Mint(a[1], tokens(1))
+	}},
+	{"burn exceeds balance", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Burn(tokens(5000))
+	}},
+	{"burn", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.Burn(tokens(3))
+	}},
+	{"add funds zero", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.AddFunds(new(big.Int), "creator")
+	}},
+	{"add funds exceeds balance", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.AddFunds(tokens(5000), "creator")
+	}},
+	{"add funds creator", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.AddFunds(tokens(100), "creator")
+	}},
+	{"add funds solver", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.AddFunds(tokens(1), "solver")
+	}},
+	{"payment by non-owner", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferPayment("creator", "solver", tokens(1))
+	}},
+	{"payment unknown creator", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferPayment("missing", "solver", tokens(1))
+	}},
+	{"payment unknown solver", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferPayment("creator", "missing", tokens(1))
+	}},
+	{"payment exceeds balance", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferPayment("creator", "solver", tokens(101))
+	}},
+	{"payment", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.TransferPayment("creator", "solver", tokens(30))
+	}},
+	{"withdraw unknown device", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.WithdrawFunds("missing", tokens(1))
+	}},
+	{"withdraw other device", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.WithdrawFunds("creator", tokens(1))
+	}},
+	{"withdraw exceeds balance", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.WithdrawFunds("solver", tokens(32))
+	}},
+	{"withdraw", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.WithdrawFunds("solver", tokens(31))
+	}},
+	{"update wallet to zero", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.UpdateWalletAddress("creator", common.Address{})
+	}},
+	{"update other wallet", 2, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.UpdateWalletAddress("creator", a[2])
+	}},
+	{"update wallet", 1, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.UpdateWalletAddress("creator", a[2])
+	}},
+	{"withdraw by owner pays wallet", 0, func(s service, a []common.Address) (*types.Transaction, error) {
+		return s.WithdrawFunds("creator", tokens(70))
+	}},
+}
+
+// state summarises everything a scenario can change
+func state(t *testing.T, s service, accounts []common.Address) string {
+	t.Helper()
+	var out string
+	for i, addr := range accounts {
+		balance, err := s.GetBalance(addr)
+		if err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		allowance, err := s.GetAllowance(accounts[1], addr)
+		if err != nil {
+			t.Fatalf("GetAllowance: %v", err)
+		}
+		out += fmt.Sprintf("account %d: balance %s allowance %s\n", i, balance, allowance)
+	}
+	supply, err := s.GetTotalSupply()
+	if err != nil {
+		t.Fatalf("GetTotalSupply: %v", err)
+	}
+	out += fmt.Sprintf("supply %s\n", supply)
+	for _, device := range []string{"creator", "solver", "missing"} {
+		info, err := s.GetStakeInfo(device)
+		if err != nil {
+			t.Fatalf("GetStakeInfo: %v", err)
+		}
+		wallet := -1
+		for i, addr := range accounts {
+			if addr == info.WalletAddress {
+				wallet = i
+			}
+		}
+		out += fmt.Sprintf("device %s: exists %v balance %s wallet %d\n", device, info.Exists, info.Amount, wallet)
+	}
+	return out
+}
+
+// TestMatchesContracts runs the scenario against the simulated contracts and
+// the fake and compares errors and resulting state
+func TestMatchesContracts(t *testing.T) {
+	opts := simulated.DefaultOptions()
+	opts.Accounts = 2
+	chain, err := simulated.New(opts)
+	if err != nil {
+		t.Fatalf("simulated.New: %v", err)
+	}
+	defer chain.Close()
+
+	accounts := []simulated.Account{chain.Owner, chain.Accounts[0], chain.Accounts[1]}
+	addresses := make([]common.Address, len(accounts))
+	real := make([]service, len(accounts))
+	fakes := make([]service, len(accounts))
+	ledger := fake.NewLedger(chain.Owner.Address)
+	ledger.Fund(chain.Owner.Address, new(big.Int).Sub(opts.InitialSupply, new(big.Int).Mul(opts.TokenFunding, big.NewInt(2))))
+	for i, account := range accounts {
+		addresses[i] = account.Address
+		client, err := chain.Client(account)
+		if err != nil {
+			t.Fatalf("Client: %v", err)
+		}
+		real[i] = client
+		fakes[i] = ledger.Client(account.Address)
+		if i > 0 {
+			ledger.Fund(account.Address, opts.TokenFunding)
+		}
+	}
+
+	for _, step := range scenario {
+		realTx, realErr := step.run(real[step.as], addresses)
+		if realErr == nil {
+			if _, err := chain.WaitMined(realTx); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		fakeTx, fakeErr := step.run(fakes[step.as], addresses)
+
+		if fmt.Sprint(realErr) != fmt.Sprint(fakeErr) {
+			t.Fatalf("%s: contract error %v, fake error %v", step.name, realErr, fakeErr)
+		}
+		if realErr == nil && (*realTx.To() != chainAddress(chain, ledger, *fakeTx.To()) || string(realTx.Data()) != string(fakeTx.Data())) {
+			t.Fatalf("%s: fake transaction does not match contract call", step.name)
+		}
+		if realState, fakeState := state(t, real[0], addresses), state(t, fakes[0], addresses); realState != fakeState {
+			t.Fatalf("%s: state differs\ncontract:\n%sfake:\n%s", step.name, realState, fakeState)
+		}
+	}
+}
+
+// chainAddress maps a fake contract address to the simulated deployment
+func chainAddress(chain *simulated.Chain, ledger *fake.Ledger, addr common.Address) common.Address {
+	switch addr {
+	case ledger.TokenAddress:
+		return chain.TokenAddress
+	case ledger.StakeAddress:
+		return chain.StakeAddress
+	}
+	return addr
+}
@@ -0,0 +1,78 @@
+package walletsdk
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FeePolicy fixes or caps the fees of transactions the client signs. Unset
+// fees are suggested by the node.
+type FeePolicy struct {
+	// GasPrice, when set, sends legacy transactions at this price
+	GasPrice *big.Int
+	// GasTipCap sets the priority fee of dynamic fee transactions
+	GasTipCap *big.Int
+	// GasFeeCap sets the maximum fee per gas of dynamic fee transactions
+	GasFeeCap *big.Int
+	// MaxGasPrice rejects transactions whose gas price or fee cap exceeds
+	// it, which guards against signing during fee spikes
+	MaxGasPrice *big.Int
+}
+
+// Validate checks that the fees are consistent
+func (p *FeePolicy) Validate() error {
+	fees := []struct {
+		name string
+		fee  *big.Int
+	}{
+		{"gas price", p.GasPrice},
+		{"gas tip cap", p.GasTipCap},
+		{"gas fee cap", p.GasFeeCap},
+		{"max gas price", p.MaxGasPrice},
+	}
+	for _, f := range fees {
+		if f.fee != nil && f.fee.Sign() < 0 {
+			return fmt.Errorf("%s must not be negative", f.name)
+		}
+	}
+	if p.GasPrice != nil && (p.GasTipCap != nil || p.GasFeeCap != nil) {
+		return fmt.Errorf("gas price cannot be combined with gas tip cap or gas fee cap")
+	}
+	if p.GasTipCap != nil && p.GasFeeCap != nil && p.GasTipCap.Cmp(p.GasFeeCap) > 0 {
+		return fmt.Errorf("gas tip cap %s exceeds gas fee cap %s", p.GasTipCap, p.GasFeeCap)
+	}
+	if p.MaxGasPrice != nil {
+		for _, fee := range []*big.Int{p.GasPrice, p.GasFeeCap, p.GasTipCap} {
+			if fee != nil && fee.Cmp(p.MaxGasPrice) > 0 {
+				return fmt.Errorf("fee %s exceeds max gas price %s", fee, p.MaxGasPrice)
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the fixed fees on opts and wraps its signer with the cap
+func (p *FeePolicy) apply(opts *bind.TransactOpts) {
+	if p.GasPrice != nil {
+		opts.GasPrice = p.GasPrice
+	}
+	if p.GasTipCap != nil {
+		opts.GasTipCap = p.GasTipCap
+	}
+	if p.GasFeeCap != nil {
+		opts.GasFeeCap = p.GasFeeCap
+	}
+	if p.MaxGasPrice != nil {
+		signer := opts.Signer
+		opts.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if tx.GasFeeCap().Cmp(p.MaxGasPrice) > 0 {
+				return nil, fmt.Errorf("gas price %s exceeds max gas price %s", tx.GasFeeCap(), p.MaxGasPrice)
+			}
+			return signer(from, tx)
+		}
+	}
+}
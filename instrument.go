@@ -0,0 +1,342 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Metric names reported to Metrics, with the labels each one carries
+const (
+	// MetricRPCRequests counts requests by method and status (ok, error)
+	MetricRPCRequests = "walletsdk_rpc_requests_total"
+	// MetricRPCDuration observes request seconds by method
+	MetricRPCDuration = "walletsdk_rpc_duration_seconds"
+	// MetricTxSubmitted counts broadcasts by kind and status
+	MetricTxSubmitted = "walletsdk_tx_submitted_total"
+	// MetricTxConfirmation observes seconds from broadcast to the first
+	// receipt by kind
+	MetricTxConfirmation = "walletsdk_tx_confirmation_seconds"
+	// MetricTxGasUsed observes the gas used by mined transactions by kind
+	MetricTxGasUsed = "walletsdk_tx_gas_used"
+	// MetricReverts counts reverts by kind and stage (eth_call,
+	// eth_estimateGas, receipt)
+	MetricReverts = "walletsdk_reverts_total"
+	// MetricNonceErrors counts broadcasts rejected for their nonce, such as
+	// nonce too low
+	MetricNonceErrors = "walletsdk_nonce_errors_total"
+	// MetricNonceResyncs counts pending nonces fetched again after a signed
+	// transaction lost its nonce, by source (settlement, outbox)
+	MetricNonceResyncs = "walletsdk_nonce_resyncs_total"
+	// MetricCacheRequests counts read cache lookups by result (hit, miss)
+	MetricCacheRequests = "walletsdk_cache_requests_total"
+)
+
+// Span attributes set by the SDK
+const (
+	AttrRPCMethod      = "rpc.method"
+	AttrContract       = "walletsdk.contract"
+	AttrContractMethod = "walletsdk.method"
+	// AttrDeviceID is the device of a stake call, or the creator device of
+	// a payment
+	AttrDeviceID = "walletsdk.device_id"
+	// AttrSolverDeviceID is the receiving device of a payment
+	AttrSolverDeviceID = "walletsdk.solver_device_id"
+	AttrTxHash         = "walletsdk.tx_hash"
+)
+
+// Metrics receives counters and histogram observations. Adapters for
+// Prometheus or OpenTelemetry map names and labels onto their own types.
+type Metrics interface {
+	// Add increments the counter name by value
+	Add(name string, value float64, labels map[string]string)
+	// Observe records value in the histogram name
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// Tracer starts spans around Client operations, such as Transfer, and around
+// the RPC requests made for them, which are children of the operation span
+type Tracer interface {
+	Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer
+type Span interface {
+	SetAttribute(key, value string)
+	// End finishes the span, marking it failed when err is not nil
+	End(err error)
+}
+
+func metricsOrNop(metrics Metrics) Metrics {
+	if metrics == nil {
+		return nopMetrics{}
+	}
+	return metrics
+}
+
+func tracerOrNop(tracer Tracer) Tracer {
+	if tracer == nil {
+		return nopTracer{}
+	}
+	return tracer
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, float64, map[string]string)     {}
+func (nopMetrics) Observe(string, float64, map[string]string) {}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ map[string]string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, string) {}
+func (nopSpan) End(error)                   {}
+
+// traceTx runs a write operation in a span named after it. send gets a copy
+// of c whose transaction options carry the span context, so the RPC requests
+// of the operation are its children.
+func (c *Client) traceTx(name string, send func(c *Client) (*types.Transaction, error)) (*types.Transaction, error) {
+	if c.tracer == nil {
+		return send(c)
+	}
+	parent := c.opCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, span := c.tracer.Start(parent, "Client."+name, map[string]string{})
+	traced := c.derive()
+	traced.opCtx = ctx
+	tx, err := send(traced)
+	if tx != nil {
+		span.SetAttribute(AttrTxHash, tx.Hash().Hex())
+	}
+	span.End(err)
+	return tx, err
+}
+
+// maxPendingSubmissions bounds the broadcasts remembered for confirmation
+// latency, in case receipts are never fetched
+const maxPendingSubmissions = 4096
+
+type submission struct {
+	kind string
+	sent time.Time
+}
+
+// instrumentedBackend reports every request to Metrics and Tracer. It names
+// requests to the SDK contracts by contract method, so spans and transaction
+// metrics read "StakeWallet.addFunds" rather than eth_sendRawTransaction.
+type instrumentedBackend struct {
+	*middlewareBackend
+	backend   Backend
+	metrics   Metrics
+	tracer    Tracer
+	logger    *slog.Logger
+	contracts map[common.Address]string
+
+	mu      sync.Mutex
+	pending map[common.Hash]submission
+}
+
+func newInstrumentedBackend(backend Backend, metrics Metrics, tracer Tracer, logger *slog.Logger, contracts map[common.Address]string) *instrumentedBackend {
+	i := &instrumentedBackend{
+		backend:   backend,
+		metrics:   metrics,
+		tracer:    tracer,
+		logger:    logger,
+		contracts: contracts,
+		pending:   make(map[common.Hash]submission),
+	}
+	i.middlewareBackend = &middlewareBackend{handle: i.handle, subscriber: i.subscriber}
+	return i
+}
+
+// Close closes the wrapped backend if it supports closing
+func (i *instrumentedBackend) Close() {
+	if closer, ok := i.backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (i *instrumentedBackend) subscriber() Backend {
+	return i.backend
+}
+
+func (i *instrumentedBackend) handle(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error) {
+	attrs := map[string]string{AttrRPCMethod: req.Method}
+	kind := i.describe(req, attrs)
+
+	ctx, span := i.tracer.Start(ctx, req.Method, attrs)
+	start := time.Now()
+	v, err := call(ctx, i.backend)
+	elapsed := time.Since(start)
+	span.End(err)
+
+	if i.logger.Enabled(ctx, slog.LevelDebug) {
+		args := []any{"method", req.Method, "elapsed", elapsed}
+		for key, value := range attrs {
+			if key != AttrRPCMethod {
+				args = append(args, key, value)
+			}
+		}
+		if err != nil {
+			args = append(args, "error", err)
+		}
+		i.logger.Debug("RPC request", args...)
+	}
+
+	i.metrics.Add(MetricRPCRequests, 1, map[string]string{"method": req.Method, "status": status(err)})
+	i.metrics.Observe(MetricRPCDuration, elapsed.Seconds(), map[string]string{"method": req.Method})
+
+	switch {
+	case req.Write:
+		i.submitted(req.Tx, kind, err)
+	case err != nil && isRevert(err):
+		i.metrics.Add(MetricReverts, 1, map[string]string{"kind": kind, "stage": req.Method})
+	case err == nil && req.Method == "eth_getTransactionReceipt":
+		i.confirmed(v.(*types.Receipt))
+	}
+	return v, err
+}
+
+// describe adds the contract call attributes of req and returns its kind
+func (i *instrumentedBackend) describe(req *backendRequest, attrs map[string]string) string {
+	var to *common.Address
+	var data []byte
+	switch {
+	case req.Write:
+		attrs[AttrTxHash] = req.Tx.Hash().Hex()
+		to, data = req.Tx.To(), req.Tx.Data()
+	case req.Method == "eth_call" || req.Method == "eth_estimateGas":
+		args, ok := req.Args[0].(callArgKey)
+		if !ok {
+			return req.Method
+		}
+		to, data = &args.To, []byte(args.Data)
+	case req.Method == "eth_getTransactionReceipt" || req.Method == "eth_getTransactionByHash":
+		attrs[AttrTxHash] = req.Args[0].(common.Hash).Hex()
+		return req.Method
+	default:
+		return req.Method
+	}
+
+	if to == nil {
+		return "deploy"
+	}
+	contract, ok := i.contracts[*to]
+	if !ok {
+		return "unknown"
+	}
+	attrs[AttrContract] = contract
+	method, values, err := decodeCall(contract, data)
+	if err != nil {
+		return contract
+	}
+	attrs[AttrContractMethod] = method.Name
+	for n, input := range method.Inputs {
+		id, ok := values[n].(string)
+		if !ok {
+			continue
+		}
+		switch input.Name {
+		case "_deviceId", "_creatorDeviceId":
+			attrs[AttrDeviceID] = id
+		case "_solverDeviceId":
+			attrs[AttrSolverDeviceID] = id
+		}
+	}
+	return contract + "." + method.Name
+}
+
+func (i *instrumentedBackend) submitted(tx *types.Transaction, kind string, err error) {
+	i.metrics.Add(MetricTxSubmitted, 1, map[string]string{"kind": kind, "status": status(err)})
+	if err != nil {
+		if isNonceError(err) {
+			i.metrics.Add(MetricNonceErrors, 1, map[string]string{})
+		}
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.pending[tx.Hash()]; ok {
+		return
+	}
+	if len(i.pending) >= maxPendingSubmissions {
+		var oldest common.Hash
+		var oldestSent time.Time
+		for hash, s := range i.pending {
+			if oldestSent.IsZero() || s.sent.Before(oldestSent) {
+				oldest, oldestSent = hash, s.sent
+			}
+		}
+		delete(i.pending, oldest)
+	}
+	i.pending[tx.Hash()] = submission{kind: kind, sent: time.Now()}
+}
+
+// confirmed reports the first receipt of a transaction broadcast through
+// this backend
+func (i *instrumentedBackend) confirmed(receipt *types.Receipt) {
+	i.mu.Lock()
+	s, ok := i.pending[receipt.TxHash]
+	delete(i.pending, receipt.TxHash)
+	i.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	labels := map[string]string{"kind": s.kind}
+	i.metrics.Observe(MetricTxConfirmation, time.Since(s.sent).Seconds(), labels)
+	i.metrics.Observe(MetricTxGasUsed, float64(receipt.GasUsed), labels)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		i.metrics.Add(MetricReverts, 1, map[string]string{"kind": s.kind, "stage": "receipt"})
+	}
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// isRevert reports whether err is an EVM revert
+func isRevert(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// isNonceError reports whether a broadcast was rejected for its nonce
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") || strings.Contains(msg, "nonce too high")
+}
+
+// isNonceTooLow reports whether a broadcast was rejected because the
+// account's confirmed nonce has passed the transaction's, so it can never be
+// mined
+func isNonceTooLow(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// isAlreadyKnown reports whether a broadcast was rejected because the node
+// already has the transaction
+func isAlreadyKnown(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "already known")
+}
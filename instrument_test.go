@@ -0,0 +1,180 @@
+package walletsdk_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+type sample struct {
+	name   string
+	value  float64
+	labels map[string]string
+}
+
+// recorder implements Metrics and Tracer by remembering everything
+type recorder struct {
+	mu           sync.Mutex
+	counters     []sample
+	observations []sample
+	spans        []*recordedSpan
+}
+
+func (r *recorder) Add(name string, value float64, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters = append(r.counters, sample{name, value, labels})
+}
+
+func (r *recorder) Observe(name string, value float64, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations = append(r.observations, sample{name, value, labels})
+}
+
+func (r *recorder) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, walletsdk.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	span := &recordedSpan{name: name, attributes: attributes}
+	span.parent, _ = ctx.Value(spanKey{}).(*recordedSpan)
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+type spanKey struct{}
+
+// count sums the counter name over samples whose labels include match
+func (r *recorder) count(name string, match map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total float64
+	for _, s := range r.counters {
+		if s.name == name && includes(s.labels, match) {
+			total += s.value
+		}
+	}
+	return total
+}
+
+func (r *recorder) observed(name string, match map[string]string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, s := range r.observations {
+		if s.name == name && includes(s.labels, match) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *recorder) span(name string, match map[string]string) *recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, span := range r.spans {
+		if span.name == name && includes(span.attributes, match) {
+			return span
+		}
+	}
+	return nil
+}
+
+func includes(labels, match map[string]string) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type recordedSpan struct {
+	parent     *recordedSpan
+	name       string
+	attributes map[string]string
+	ended      bool
+	err        error
+}
+
+func (s *recordedSpan) SetAttribute(key, value string) { s.attributes[key] = value }
+func (s *recordedSpan) End(err error)                  { s.ended, s.err = true, err }
+
+func TestInstrumentation(t *testing.T) {
+	chain := newChain(t)
+	rec := &recorder{}
+	config := chain.Config(chain.Accounts[0])
+	config.Metrics = rec
+	config.Tracer = rec
+	config.Cache = &walletsdk.CacheOptions{HeadInterval: -1}
+	client, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+
+	// Stake approves, waits for the approval through the client and adds funds
+	tx, err := client.AddFunds(tokens(5), "device-1")
+	if err != nil {
+		t.Fatalf("AddFunds: %v", err)
+	}
+	if _, err := bind.WaitMined(context.Background(), client, tx); err != nil {
+		t.Fatalf("WaitMined: %v", err)
+	}
+
+	for _, kind := range []string{"ParityToken.approve", "StakeWallet.addFunds"} {
+		if rec.count(walletsdk.MetricTxSubmitted, map[string]string{"kind": kind, "status": "ok"}) != 1 {
+			t.Errorf("no successful %s submission counted", kind)
+		}
+		if rec.observed(walletsdk.MetricTxConfirmation, map[string]string{"kind": kind}) != 1 {
+			t.Errorf("no confirmation latency observed for %s", kind)
+		}
+		if rec.observed(walletsdk.MetricTxGasUsed, map[string]string{"kind": kind}) != 1 {
+			t.Errorf("no gas observed for %s", kind)
+		}
+	}
+	if rec.count(walletsdk.MetricRPCRequests, map[string]string{"method": "eth_sendRawTransaction"}) != 2 {
+		t.Errorf("RPC requests not counted by method")
+	}
+
+	span := rec.span("eth_sendRawTransaction", map[string]string{
+		walletsdk.AttrContractMethod: "addFunds",
+		walletsdk.AttrDeviceID:       "device-1",
+		walletsdk.AttrTxHash:         tx.Hash().Hex(),
+	})
+	if span == nil || !span.ended || span.err != nil {
+		t.Fatalf("missing or unfinished addFunds span: %+v", span)
+	}
+	// The requests of the operation, including waiting for the approval, are
+	// children of its span
+	operation := rec.span("Client.AddFunds", map[string]string{walletsdk.AttrTxHash: tx.Hash().Hex()})
+	if operation == nil || !operation.ended || span.parent != operation {
+		t.Fatalf("addFunds request is not a child of the AddFunds operation: %+v", operation)
+	}
+	if receipt := rec.span("eth_getTransactionReceipt", nil); receipt == nil || receipt.parent != operation {
+		t.Errorf("approval wait is not a child of the AddFunds operation")
+	}
+
+	// A withdrawal beyond the balance reverts during gas estimation
+	if _, err := client.WithdrawFunds("device-1", tokens(50)); err == nil {
+		t.Fatalf("expected withdrawal to revert")
+	}
+	if rec.count(walletsdk.MetricReverts, map[string]string{"kind": "StakeWallet.withdrawFunds", "stage": "eth_estimateGas"}) != 1 {
+		t.Errorf("revert not counted")
+	}
+	if span := rec.span("Client.WithdrawFunds", nil); span == nil || span.err == nil {
+		t.Errorf("failed WithdrawFunds operation span: %+v", span)
+	}
+
+	// Cache lookups are reported too
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetStakeBalance("device-1"); err != nil {
+			t.Fatalf("GetStakeBalance: %v", err)
+		}
+	}
+	if rec.count(walletsdk.MetricCacheRequests, map[string]string{"result": "hit"}) != 1 {
+		t.Errorf("cache hit not counted")
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Memory layout shared by both contracts. The first 0x80 bytes are scratch
+// space for hashing and return values.
+const (
+	memLocal0  = 0x80
+	memLocal1  = 0xa0
+	memLocal2  = 0xc0
+	memLocal3  = 0xe0
+	memLocal4  = 0x100
+	memLocal5  = 0x120
+	memLocal6  = 0x140
+	memCall    = 0x200
+	memOut     = 0x300
+	memString1 = 0x400
+	memString2 = 0x4000
+	maxString  = 0x3000
+)
+
+// assembler builds EVM bytecode with symbolic jump labels
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	fixups map[int]string
+	unique int
+}
+
+func newAssembler() *assembler {
+	return &assembler{labels: make(map[string]int), fixups: make(map[int]string)}
+}
+
+// op appends opcodes
+func (a *assembler) op(ops ...vm.OpCode) {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+}
+
+// push appends the smallest PUSH for v
+func (a *assembler) push(v uint64) {
+	a.pushBig(new(big.Int).SetUint64(v))
+}
+
+// pushBig appends the smallest PUSH for v
+func (a *assembler) pushBig(v *big.Int) {
+	b := v.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	a.pushBytes(b)
+}
+
+// pushBytes appends a PUSH of the given bytes
+func (a *assembler) pushBytes(b []byte) {
+	if len(b) == 0 || len(b) > 32 {
+		panic("invalid push size")
+	}
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(b)-1))
+	a.code = append(a.code, b...)
+}
+
+// pushLabel appends a PUSH2 of a label resolved at assembly time
+func (a *assembler) pushLabel(name string) {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.fixups[len(a.code)] = name
+	a.code = append(a.code, 0, 0)
+}
+
+// label marks a jump destination
+func (a *assembler) label(name string) {
+	if _, ok := a.labels[name]; ok {
+		panic("duplicate label " + name)
+	}
+	a.labels[name] = len(a.code)
+	a.op(vm.JUMPDEST)
+}
+
+// newLabel returns a unique label name
+func (a *assembler) newLabel(prefix string) string {
+	a.unique++
+	return fmt.Sprintf("%s_%d", prefix, a.unique)
+}
+
+func (a *assembler) jump(name string) {
+	a.pushLabel(name)
+	a.op(vm.JUMP)
+}
+
+// jumpi jumps to name if the top of the stack is non-zero
+func (a *assembler) jumpi(name string) {
+	a.pushLabel(name)
+	a.op(vm.JUMPI)
+}
+
+// assemble resolves labels and returns the bytecode
+func (a *assembler) assemble() []byte {
+	code := append([]byte(nil), a.code...)
+	for pos, name := range a.fixups {
+		target, ok := a.labels[name]
+		if !ok {
+			panic("undefined label " + name)
+		}
+		code[pos] = byte(target >> 8)
+		code[pos+1] = byte(target)
+	}
+	return code
+}
+
+// selector returns the 4 byte selector of a function or error signature
+func selector(signature string) uint64 {
+	return new(big.Int).SetBytes(crypto.Keccak256([]byte(signature))[:4]).Uint64()
+}
+
+// topic returns the topic of an event signature
+func topic(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))
+}
+
+// mstoreConst stores a constant word in memory
+func (a *assembler) mstoreConst(offset uint64, value uint64) {
+	a.push(value)
+	a.push(offset)
+	a.op(vm.MSTORE)
+}
+
+// store pops the top of the stack into memory
+func (a *assembler) store(offset uint64) {
+	a.push(offset)
+	a.op(vm.MSTORE)
+}
+
+// load pushes a word from memory
+func (a *assembler) load(offset uint64) {
+	a.push(offset)
+	a.op(vm.MLOAD)
+}
+
+// arg pushes the i-th static calldata argument
+func (a *assembler) arg(i uint64) {
+	a.push(4 + 32*i)
+	a.op(vm.CALLDATALOAD)
+}
+
+// argAddress pushes the i-th calldata argument masked to an address
+func (a *assembler) argAddress(i uint64) {
+	a.arg(i)
+	a.maskAddress()
+}
+
+func (a *assembler) maskAddress() {
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+	a.pushBig(mask)
+	a.op(vm.AND)
+}
+
+// selectorWord pushes a selector left aligned in a word
+func (a *assembler) selectorWord(sel uint64) {
+	a.pushBig(new(big.Int).Lsh(new(big.Int).SetUint64(sel), 224))
+}
+
+// revertString reverts with Error(string). The message must fit in a word.
+func (a *assembler) revertString(msg string) {
+	if len(msg) > 32 {
+		panic("revert message too long: " + msg)
+	}
+	word := make([]byte, 32)
+	copy(word, msg)
+
+	a.selectorWord(selector("Error(string)"))
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.mstoreConst(0x04, 0x20)
+	a.mstoreConst(0x24, uint64(len(msg)))
+	a.pushBytes(word)
+	a.push(0x44)
+	a.op(vm.MSTORE)
+	a.push(0x64)
+	a.push(0)
+	a.op(vm.REVERT)
+}
+
+// revertAddressError reverts with a custom error taking the address on top
+// of the stack
+func (a *assembler) revertAddressError(signature string) {
+	a.selectorWord(selector(signature))
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.push(0x04)
+	a.op(vm.MSTORE)
+	a.push(0x24)
+	a.push(0)
+	a.op(vm.REVERT)
+}
+
+// revertEmpty reverts without data
+func (a *assembler) revertEmpty() {
+	a.push(0)
+	a.push(0)
+	a.op(vm.REVERT)
+}
+
+// returnWord returns the word on top of the stack
+func (a *assembler) returnWord() {
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.RETURN)
+}
+
+// returnString returns a constant ABI encoded string
+func (a *assembler) returnString(s string) {
+	if len(s) > 32 {
+		panic("string too long")
+	}
+	word := make([]byte, 32)
+	copy(word, s)
+	a.mstoreConst(0x00, 0x20)
+	a.mstoreConst(0x20, uint64(len(s)))
+	a.pushBytes(word)
+	a.push(0x40)
+	a.op(vm.MSTORE)
+	a.push(0x60)
+	a.push(0)
+	a.op(vm.RETURN)
+}
+
+// mappingSlot replaces the key on top of the stack with keccak(key . slot)
+func (a *assembler) mappingSlot(slot uint64) {
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.mstoreConst(0x20, slot)
+	a.push(0x40)
+	a.push(0)
+	a.op(vm.KECCAK256)
+}
+
+// nested replaces the key on top of the stack with keccak(key . base) where
+// base is the word below it
+func (a *assembler) nested() {
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.push(0x20)
+	a.op(vm.MSTORE)
+	a.push(0x40)
+	a.push(0)
+	a.op(vm.KECCAK256)
+}
+
+// nonPayable reverts if the call carries value
+func (a *assembler) nonPayable() {
+	ok := a.newLabel("nonpayable")
+	a.op(vm.CALLVALUE)
+	a.op(vm.ISZERO)
+	a.jumpi(ok)
+	a.revertEmpty()
+	a.label(ok)
+}
+
+// onlyOwner reverts with OwnableUnauthorizedAccount unless the caller is the
+// owner stored in slot 0
+func (a *assembler) onlyOwner() {
+	ok := a.newLabel("owner")
+	a.op(vm.CALLER)
+	a.push(0)
+	a.op(vm.SLOAD)
+	a.op(vm.EQ)
+	a.jumpi(ok)
+	a.op(vm.CALLER)
+	a.revertAddressError("OwnableUnauthorizedAccount(address)")
+	a.label(ok)
+}
+
+// require reverts with msg unless the top of the stack is non-zero
+func (a *assembler) require(msg string) {
+	ok := a.newLabel("require")
+	a.jumpi(ok)
+	a.revertString(msg)
+	a.label(ok)
+}
+
+// dispatch emits the function selector jump table
+func (a *assembler) dispatch(functions map[string]string) {
+	a.push(4)
+	a.op(vm.CALLDATASIZE)
+	a.op(vm.LT)
+	a.jumpi("fallback")
+	a.push(0)
+	a.op(vm.CALLDATALOAD)
+	a.push(224)
+	a.op(vm.SHR)
+	for _, signature := range sortedKeys(functions) {
+		a.op(vm.DUP1)
+		a.pushBytes(uint32Bytes(selector(signature)))
+		a.op(vm.EQ)
+		a.jumpi(functions[signature])
+	}
+	a.label("fallback")
+	a.revertEmpty()
+}
+
+// ownable emits owner, transferOwnership and renounceOwnership
+func (a *assembler) ownable() {
+	ownershipTransferred := topic("OwnershipTransferred(address,address)")
+
+	a.label("owner")
+	a.push(0)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("transferOwnership")
+	a.onlyOwner()
+	a.argAddress(0)
+	a.op(vm.DUP1)
+	a.store(memLocal0)
+	valid := a.newLabel("valid_owner")
+	a.jumpi(valid)
+	a.push(0)
+	a.revertAddressError("OwnableInvalidOwner(address)")
+	a.label(valid)
+	a.load(memLocal0)
+	a.push(0)
+	a.op(vm.SLOAD)
+	a.pushBytes(ownershipTransferred)
+	a.push(0)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.load(memLocal0)
+	a.push(0)
+	a.op(vm.SSTORE)
+	a.op(vm.STOP)
+
+	a.label("renounceOwnership")
+	a.onlyOwner()
+	a.push(0)
+	a.push(0)
+	a.op(vm.SLOAD)
+	a.pushBytes(ownershipTransferred)
+	a.push(0)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.push(0)
+	a.push(0)
+	a.op(vm.SSTORE)
+	a.op(vm.STOP)
+}
+
+// constructorOwner sets the deployer as owner and emits OwnershipTransferred
+func (a *assembler) constructorOwner() {
+	a.op(vm.CALLER)
+	a.push(0)
+	a.op(vm.SSTORE)
+	a.op(vm.CALLER)
+	a.push(0)
+	a.pushBytes(topic("OwnershipTransferred(address,address)"))
+	a.push(0)
+	a.push(0)
+	a.op(vm.LOG3)
+}
+
+// constructorArg pushes the single constructor argument appended to the
+// creation code
+func (a *assembler) constructorArg() {
+	a.push(0x20)
+	a.push(0x20)
+	a.op(vm.CODESIZE)
+	a.op(vm.SUB)
+	a.push(0)
+	a.op(vm.CODECOPY)
+	a.push(0)
+	a.op(vm.MLOAD)
+}
+
+// deploy finishes creation code by returning the runtime code appended to it.
+// The creation code must be fully emitted before calling deploy.
+func deploy(creation *assembler, runtime []byte) []byte {
+	// PUSH2 len PUSH2 offset PUSH1 0 CODECOPY PUSH2 len PUSH1 0 RETURN
+	const tail = 3 + 3 + 2 + 1 + 3 + 2 + 1
+	offset := len(creation.code) + tail
+	creation.code = append(creation.code, byte(vm.PUSH2), byte(len(runtime)>>8), byte(len(runtime)))
+	creation.code = append(creation.code, byte(vm.PUSH2), byte(offset>>8), byte(offset))
+	creation.push(0)
+	creation.op(vm.CODECOPY)
+	creation.code = append(creation.code, byte(vm.PUSH2), byte(len(runtime)>>8), byte(len(runtime)))
+	creation.push(0)
+	creation.op(vm.RETURN)
+	return append(creation.assemble(), runtime...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func uint32Bytes(v uint64) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
@@ -0,0 +1,42 @@
+// Command contractgen assembles the EVM bytecode of the ParityToken and
+// StakeWallet contracts and writes it to contract_bin.go in the SDK package.
+//
+// The contracts implement ParityTokenABI and StakeWalletContractABI closely
+// enough for devnets and the simulated test backend; they are not the audited
+// production deployments. This generator is a stand-in until the compiled
+// artifacts of the production Solidity sources are vendored into the
+// repository, at which point contract_bin.go should be built from those
+// instead.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func main() {
+	out := flag.String("out", "contract_bin.go", "output file")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by internal/contractgen. DO NOT EDIT.\n\n")
+	buf.WriteString("package walletsdk\n\n")
+	buf.WriteString("// ParityTokenBin is the creation bytecode of the ParityToken contract\n")
+	fmt.Fprintf(&buf, "const ParityTokenBin = %q\n\n", hexutil.Encode(parityToken()))
+	buf.WriteString("// StakeWalletContractBin is the creation bytecode of the StakeWallet contract\n")
+	fmt.Fprintf(&buf, "const StakeWalletContractBin = %q\n", hexutil.Encode(stakeWallet()))
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
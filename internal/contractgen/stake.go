@@ -0,0 +1,445 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// StakeWallet storage layout. A device wallet lives at keccak(deviceId . 2)
+// and spans the fields below, followed by the device ID words.
+const (
+	stakeSlotOwner   = 0
+	stakeSlotToken   = 1
+	stakeSlotWallets = 2
+
+	walletBalance  = 0
+	walletAddress  = 1
+	walletExists   = 2
+	walletIDLength = 3
+	walletIDData   = 4
+)
+
+// stakeWallet returns the creation code of the StakeWallet contract. The
+// deployer becomes the owner and _tokenAddress the staked token.
+func stakeWallet() []byte {
+	runtime := stakeWalletRuntime()
+
+	a := newAssembler()
+	a.nonPayable()
+	a.constructorOwner()
+	a.constructorArg()
+	a.maskAddress()
+	a.op(vm.DUP1)
+	a.require("Invalid token address")
+	a.push(stakeSlotToken)
+	a.op(vm.SSTORE)
+	return deploy(a, runtime)
+}
+
+func stakeWalletRuntime() []byte {
+	a := newAssembler()
+	a.nonPayable()
+	a.dispatch(map[string]string{
+		"addFunds(uint256,string,address)":       "addFunds",
+		"getBalance(string)":                     "getBalance",
+		"getWalletInfo(string)":                  "getWalletInfo",
+		"wallets(string)":                        "getWalletInfo",
+		"token()":                                "token",
+		"recoverTokens(address,uint256)":         "recoverTokens",
+		"transferPayment(string,string,uint256)": "transferPayment",
+		"updateWalletAddress(string,address)":    "updateWalletAddress",
+		"withdrawFunds(string,uint256)":          "withdrawFunds",
+		"owner()":                                "owner",
+		"transferOwnership(address)":             "transferOwnership",
+		"renounceOwnership()":                    "renounceOwnership",
+	})
+
+	a.label("token")
+	a.push(stakeSlotToken)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("getBalance")
+	a.loadDevice(0, memString1, memLocal0, memLocal2)
+	a.load(memLocal2)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("getWalletInfo")
+	a.loadDevice(0, memString1, memLocal0, memLocal2)
+	a.walletInfo(memLocal2)
+
+	// addFunds(amount, deviceId, walletAddress)
+	a.label("addFunds")
+	a.arg(0)
+	a.op(vm.DUP1)
+	a.store(memLocal4)
+	a.require("Amount must be greater than 0")
+	a.argAddress(2)
+	a.op(vm.DUP1)
+	a.store(memLocal5)
+	a.require("Invalid wallet address")
+	a.loadDevice(1, memString1, memLocal0, memLocal2)
+	a.callToken("transferFrom(address,address,uint256)", func() {
+		a.op(vm.CALLER)
+		a.store(memCall + 0x04)
+		a.op(vm.ADDRESS)
+		a.store(memCall + 0x24)
+		a.load(memLocal4)
+		a.store(memCall + 0x44)
+	}, 0x64)
+	a.load(memLocal2)
+	a.push(walletExists)
+	a.op(vm.ADD)
+	a.op(vm.SLOAD)
+	a.jumpi("addFunds_credit")
+	a.load(memLocal5)
+	a.walletField(memLocal2, walletAddress)
+	a.op(vm.SSTORE)
+	a.push(1)
+	a.walletField(memLocal2, walletExists)
+	a.op(vm.SSTORE)
+	a.storeDeviceID(memString1, memLocal0, memLocal2)
+	a.label("addFunds_credit")
+	a.load(memLocal2)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.load(memLocal4)
+	a.op(vm.ADD)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+	a.load(memLocal4)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.op(vm.CALLER)
+	a.deviceTopic(memString1, memLocal0)
+	a.pushBytes(topic("FundsAdded(string,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.op(vm.STOP)
+
+	// transferPayment(creatorDeviceId, solverDeviceId, amount)
+	a.label("transferPayment")
+	a.onlyOwner()
+	a.arg(2)
+	a.op(vm.DUP1)
+	a.store(memLocal4)
+	a.require("Amount must be greater than 0")
+	a.loadDevice(0, memString1, memLocal0, memLocal2)
+	a.loadDevice(1, memString2, memLocal1, memLocal3)
+	a.walletField(memLocal2, walletExists)
+	a.op(vm.SLOAD)
+	a.require("Creator device not found")
+	a.walletField(memLocal3, walletExists)
+	a.op(vm.SLOAD)
+	a.require("Solver device not found")
+	a.debit(memLocal2, memLocal4)
+	a.load(memLocal3)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.load(memLocal4)
+	a.op(vm.ADD)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+	a.load(memLocal4)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.deviceTopic(memString2, memLocal1)
+	a.deviceTopic(memString1, memLocal0)
+	a.pushBytes(topic("TaskPayment(string,string,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.op(vm.STOP)
+
+	// withdrawFunds(deviceId, amount) pays out to the device wallet
+	a.label("withdrawFunds")
+	a.arg(1)
+	a.op(vm.DUP1)
+	a.store(memLocal4)
+	a.require("Amount must be greater than 0")
+	a.loadDevice(0, memString1, memLocal0, memLocal2)
+	a.requireWalletAuthority(memLocal2)
+	a.debit(memLocal2, memLocal4)
+	a.callToken("transfer(address,uint256)", func() {
+		a.load(memLocal5)
+		a.store(memCall + 0x04)
+		a.load(memLocal4)
+		a.store(memCall + 0x24)
+	}, 0x44)
+	a.load(memLocal4)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.load(memLocal5)
+	a.deviceTopic(memString1, memLocal0)
+	a.pushBytes(topic("FundsWithdrawn(string,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.op(vm.STOP)
+
+	// updateWalletAddress(deviceId, newWalletAddress)
+	a.label("updateWalletAddress")
+	a.argAddress(1)
+	a.op(vm.DUP1)
+	a.store(memLocal4)
+	a.require("Invalid wallet address")
+	a.loadDevice(0, memString1, memLocal0, memLocal2)
+	a.requireWalletAuthority(memLocal2)
+	a.load(memLocal4)
+	a.walletField(memLocal2, walletAddress)
+	a.op(vm.SSTORE)
+	a.op(vm.STOP)
+
+	// recoverTokens(tokenAddress, amount) sends tokens held by the contract
+	// to the owner
+	a.label("recoverTokens")
+	a.onlyOwner()
+	a.argAddress(0)
+	a.store(memLocal5)
+	a.arg(1)
+	a.store(memLocal4)
+	a.callContract(memLocal5, "transfer(address,uint256)", func() {
+		a.push(stakeSlotOwner)
+		a.op(vm.SLOAD)
+		a.store(memCall + 0x04)
+		a.load(memLocal4)
+		a.store(memCall + 0x24)
+	}, 0x44)
+	a.load(memLocal4)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.load(memLocal5)
+	a.pushBytes(topic("TokenRecovered(address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG2)
+	a.op(vm.STOP)
+
+	a.ownable()
+	return a.assemble()
+}
+
+// loadDevice copies the string argument at index into buf, stores its length
+// in lenMem and the wallet base slot in baseMem
+func (a *assembler) loadDevice(index uint64, buf, lenMem, baseMem uint64) {
+	// position of the length word
+	a.arg(index)
+	a.push(4)
+	a.op(vm.ADD)
+	a.op(vm.DUP1)
+	a.op(vm.CALLDATALOAD)
+	a.op(vm.DUP1)
+	a.store(lenMem)
+	a.op(vm.DUP1)
+	a.push(maxString)
+	a.op(vm.GT)
+	a.require("Device ID too long")
+	a.op(vm.SWAP1)
+	a.push(0x20)
+	a.op(vm.ADD)
+	a.push(buf)
+	a.op(vm.CALLDATACOPY)
+
+	// keccak(deviceId . slot), then clear the slot word again so the buffer
+	// stays zero padded
+	a.push(stakeSlotWallets)
+	a.load(lenMem)
+	a.push(buf)
+	a.op(vm.ADD)
+	a.op(vm.MSTORE)
+	a.load(lenMem)
+	a.push(0x20)
+	a.op(vm.ADD)
+	a.push(buf)
+	a.op(vm.KECCAK256)
+	a.store(baseMem)
+	a.push(0)
+	a.load(lenMem)
+	a.push(buf)
+	a.op(vm.ADD)
+	a.op(vm.MSTORE)
+}
+
+// deviceTopic pushes keccak(deviceId), the topic of an indexed string
+func (a *assembler) deviceTopic(buf, lenMem uint64) {
+	a.load(lenMem)
+	a.push(buf)
+	a.op(vm.KECCAK256)
+}
+
+// walletField pushes the storage slot of a wallet field
+func (a *assembler) walletField(baseMem uint64, field uint64) {
+	a.load(baseMem)
+	a.push(field)
+	a.op(vm.ADD)
+}
+
+// storeDeviceID writes the device ID length and words into wallet storage
+func (a *assembler) storeDeviceID(buf, lenMem, baseMem uint64) {
+	loop := a.newLabel("store_id")
+	done := a.newLabel("store_id_done")
+
+	a.load(lenMem)
+	a.walletField(baseMem, walletIDLength)
+	a.op(vm.SSTORE)
+	a.push(0)
+	a.label(loop)
+	a.load(lenMem)
+	a.op(vm.DUP2)
+	a.op(vm.LT)
+	a.op(vm.ISZERO)
+	a.jumpi(done)
+	a.op(vm.DUP1)
+	a.push(buf)
+	a.op(vm.ADD)
+	a.op(vm.MLOAD)
+	a.op(vm.DUP2)
+	a.push(5)
+	a.op(vm.SHR)
+	a.walletField(baseMem, walletIDData)
+	a.op(vm.ADD)
+	a.op(vm.SSTORE)
+	a.push(0x20)
+	a.op(vm.ADD)
+	a.jump(loop)
+	a.label(done)
+	a.op(vm.POP)
+}
+
+// walletInfo returns (balance, deviceId, walletAddress, exists) of a wallet
+func (a *assembler) walletInfo(baseMem uint64) {
+	loop := a.newLabel("info_id")
+	done := a.newLabel("info_id_done")
+
+	a.walletField(baseMem, walletBalance)
+	a.op(vm.SLOAD)
+	a.store(memOut)
+	a.mstoreConst(memOut+0x20, 0x80)
+	a.walletField(baseMem, walletAddress)
+	a.op(vm.SLOAD)
+	a.store(memOut + 0x40)
+	a.walletField(baseMem, walletExists)
+	a.op(vm.SLOAD)
+	a.store(memOut + 0x60)
+	a.walletField(baseMem, walletIDLength)
+	a.op(vm.SLOAD)
+	a.store(memOut + 0x80)
+
+	a.push(0)
+	a.label(loop)
+	a.load(memOut + 0x80)
+	a.op(vm.DUP2)
+	a.op(vm.LT)
+	a.op(vm.ISZERO)
+	a.jumpi(done)
+	a.op(vm.DUP1)
+	a.push(5)
+	a.op(vm.SHR)
+	a.walletField(baseMem, walletIDData)
+	a.op(vm.ADD)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP2)
+	a.push(memOut + 0xa0)
+	a.op(vm.ADD)
+	a.op(vm.MSTORE)
+	a.push(0x20)
+	a.op(vm.ADD)
+	a.jump(loop)
+	a.label(done)
+
+	// the loop counter is the padded length of the device ID
+	a.push(0xa0)
+	a.op(vm.ADD)
+	a.push(memOut)
+	a.op(vm.RETURN)
+}
+
+// requireWalletAuthority checks that the wallet exists and that the caller is
+// its wallet address or the owner. It leaves the wallet address in local5.
+func (a *assembler) requireWalletAuthority(baseMem uint64) {
+	ok := a.newLabel("authorized")
+
+	a.walletField(baseMem, walletExists)
+	a.op(vm.SLOAD)
+	a.require("Device not found")
+	a.walletField(baseMem, walletAddress)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP1)
+	a.store(memLocal5)
+	a.op(vm.CALLER)
+	a.op(vm.EQ)
+	a.op(vm.CALLER)
+	a.push(stakeSlotOwner)
+	a.op(vm.SLOAD)
+	a.op(vm.EQ)
+	a.op(vm.OR)
+	a.jumpi(ok)
+	a.revertString("Not authorized")
+	a.label(ok)
+}
+
+// debit subtracts the amount in amountMem from the wallet balance
+func (a *assembler) debit(baseMem, amountMem uint64) {
+	a.load(baseMem)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP1)
+	a.load(amountMem)
+	a.op(vm.GT)
+	a.op(vm.ISZERO)
+	a.require("Insufficient balance")
+	a.load(amountMem)
+	a.op(vm.SWAP1)
+	a.op(vm.SUB)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+}
+
+// callToken calls the staked token, see callContract
+func (a *assembler) callToken(signature string, args func(), size uint64) {
+	a.push(stakeSlotToken)
+	a.op(vm.SLOAD)
+	a.store(memLocal6)
+	a.callContract(memLocal6, signature, args, size)
+}
+
+// callContract calls an ERC20 method on the address stored at addrMem. Reverts
+// are bubbled up and a false return value fails the call.
+func (a *assembler) callContract(addrMem uint64, signature string, args func(), size uint64) {
+	success := a.newLabel("call_ok")
+	done := a.newLabel("call_done")
+
+	a.selectorWord(selector(signature))
+	a.store(memCall)
+	args()
+
+	a.load(addrMem)
+	a.op(vm.EXTCODESIZE)
+	a.require("Token is not a contract")
+
+	a.push(0x20)
+	a.push(memCall)
+	a.push(size)
+	a.push(memCall)
+	a.push(0)
+	a.load(addrMem)
+	a.op(vm.GAS)
+	a.op(vm.CALL)
+	a.jumpi(success)
+	a.op(vm.RETURNDATASIZE)
+	a.push(0)
+	a.push(0)
+	a.op(vm.RETURNDATACOPY)
+	a.op(vm.RETURNDATASIZE)
+	a.push(0)
+	a.op(vm.REVERT)
+
+	a.label(success)
+	a.op(vm.RETURNDATASIZE)
+	a.op(vm.ISZERO)
+	a.jumpi(done)
+	a.load(memCall)
+	a.require("Token transfer failed")
+	a.label(done)
+}
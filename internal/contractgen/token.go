@@ -0,0 +1,293 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// ParityToken storage layout
+const (
+	tokenSlotOwner       = 0
+	tokenSlotTotalSupply = 1
+	tokenSlotBalances    = 2
+	tokenSlotAllowances  = 3
+)
+
+const (
+	tokenName     = "Parity Token"
+	tokenSymbol   = "PRTY"
+	tokenDecimals = 18
+)
+
+// parityToken returns the creation code of the ParityToken contract. The
+// constructor mints initialSupply to the deployer, who becomes the owner.
+func parityToken() []byte {
+	runtime := parityTokenRuntime()
+
+	a := newAssembler()
+	a.nonPayable()
+	a.constructorOwner()
+	a.constructorArg()
+	a.op(vm.DUP1)
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SSTORE)
+	a.op(vm.DUP1)
+	a.op(vm.CALLER)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.SSTORE)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.op(vm.CALLER)
+	a.push(0)
+	a.pushBytes(topic("Transfer(address,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	return deploy(a, runtime)
+}
+
+func parityTokenRuntime() []byte {
+	a := newAssembler()
+	a.nonPayable()
+	a.dispatch(map[string]string{
+		"name()":                                  "name",
+		"symbol()":                                "symbol",
+		"decimals()":                              "decimals",
+		"totalSupply()":                           "totalSupply",
+		"balanceOf(address)":                      "balanceOf",
+		"allowance(address,address)":              "allowance",
+		"transfer(address,uint256)":               "transfer",
+		"approve(address,uint256)":                "approve",
+		"transferFrom(address,address,uint256)":   "transferFrom",
+		"mint(address,uint256)":                   "mint",
+		"burn(uint256)":                           "burn",
+		"transferWithData(address,uint256,bytes)": "transfer",
+		"transferWithDataAndCallback(address,uint256,bytes)": "transfer",
+		"owner()":                    "owner",
+		"transferOwnership(address)": "transferOwnership",
+		"renounceOwnership()":        "renounceOwnership",
+	})
+
+	a.label("name")
+	a.returnString(tokenName)
+
+	a.label("symbol")
+	a.returnString(tokenSymbol)
+
+	a.label("decimals")
+	a.push(tokenDecimals)
+	a.returnWord()
+
+	a.label("totalSupply")
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("balanceOf")
+	a.argAddress(0)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("allowance")
+	a.argAddress(0)
+	a.mappingSlot(tokenSlotAllowances)
+	a.argAddress(1)
+	a.nested()
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	// transfer(to, value) and the data variants, which share its head
+	a.label("transfer")
+	a.op(vm.CALLER)
+	a.store(memLocal0)
+	a.argAddress(0)
+	a.store(memLocal1)
+	a.arg(1)
+	a.store(memLocal2)
+	a.tokenTransfer()
+	a.push(1)
+	a.returnWord()
+
+	a.label("approve")
+	a.argAddress(0)
+	a.op(vm.DUP1)
+	a.store(memLocal1)
+	a.require("ERC20: approve to zero address")
+	a.arg(1)
+	a.op(vm.DUP1)
+	a.store(memLocal2)
+	a.op(vm.CALLER)
+	a.mappingSlot(tokenSlotAllowances)
+	a.load(memLocal1)
+	a.nested()
+	a.op(vm.SSTORE)
+	a.load(memLocal2)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.load(memLocal1)
+	a.op(vm.CALLER)
+	a.pushBytes(topic("Approval(address,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.push(1)
+	a.returnWord()
+
+	a.label("transferFrom")
+	a.argAddress(0)
+	a.store(memLocal0)
+	a.argAddress(1)
+	a.store(memLocal1)
+	a.arg(2)
+	a.store(memLocal2)
+	// allowance slot of (from, caller)
+	a.load(memLocal0)
+	a.mappingSlot(tokenSlotAllowances)
+	a.op(vm.CALLER)
+	a.nested()
+	a.op(vm.DUP1)
+	a.store(memLocal3)
+	a.op(vm.SLOAD)
+	// unlimited allowances are not decreased
+	a.op(vm.DUP1)
+	a.op(vm.NOT)
+	a.op(vm.ISZERO)
+	a.jumpi("transferFrom_spend")
+	a.op(vm.DUP1)
+	a.load(memLocal2)
+	a.op(vm.GT)
+	a.op(vm.ISZERO)
+	a.require("ERC20: insufficient allowance")
+	a.load(memLocal2)
+	a.op(vm.SWAP1)
+	a.op(vm.SUB)
+	a.load(memLocal3)
+	a.op(vm.SSTORE)
+	a.push(0)
+	a.label("transferFrom_spend")
+	a.op(vm.POP)
+	a.tokenTransfer()
+	a.push(1)
+	a.returnWord()
+
+	a.label("mint")
+	a.onlyOwner()
+	a.argAddress(0)
+	a.op(vm.DUP1)
+	a.store(memLocal1)
+	a.require("ERC20: mint to zero address")
+	a.arg(1)
+	a.store(memLocal2)
+	// totalSupply += value, reverting on overflow
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP1)
+	a.load(memLocal2)
+	a.op(vm.ADD)
+	a.op(vm.DUP1)
+	a.op(vm.SWAP2)
+	a.op(vm.GT)
+	a.op(vm.ISZERO)
+	a.require("ERC20: total supply overflow")
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SSTORE)
+	a.load(memLocal1)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.load(memLocal2)
+	a.op(vm.ADD)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+	a.load(memLocal2)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.load(memLocal1)
+	a.push(0)
+	a.pushBytes(topic("Transfer(address,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.push(1)
+	a.returnWord()
+
+	a.label("burn")
+	a.arg(0)
+	a.store(memLocal2)
+	a.op(vm.CALLER)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP1)
+	a.load(memLocal2)
+	a.op(vm.GT)
+	a.op(vm.ISZERO)
+	a.require("ERC20: burn exceeds balance")
+	a.load(memLocal2)
+	a.op(vm.SWAP1)
+	a.op(vm.SUB)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+	a.load(memLocal2)
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SLOAD)
+	a.op(vm.SUB)
+	a.push(tokenSlotTotalSupply)
+	a.op(vm.SSTORE)
+	a.load(memLocal2)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.push(0)
+	a.op(vm.CALLER)
+	a.pushBytes(topic("Transfer(address,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+	a.push(1)
+	a.returnWord()
+
+	a.ownable()
+	return a.assemble()
+}
+
+// tokenTransfer moves local2 tokens from local0 to local1 and emits Transfer
+func (a *assembler) tokenTransfer() {
+	a.load(memLocal1)
+	a.require("ERC20: transfer to zero address")
+
+	// balances[from] -= value
+	a.load(memLocal0)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.op(vm.DUP1)
+	a.load(memLocal2)
+	a.op(vm.GT)
+	a.op(vm.ISZERO)
+	a.require("ERC20: amount exceeds balance")
+	a.load(memLocal2)
+	a.op(vm.SWAP1)
+	a.op(vm.SUB)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+
+	// balances[to] += value
+	a.load(memLocal1)
+	a.mappingSlot(tokenSlotBalances)
+	a.op(vm.DUP1)
+	a.op(vm.SLOAD)
+	a.load(memLocal2)
+	a.op(vm.ADD)
+	a.op(vm.SWAP1)
+	a.op(vm.SSTORE)
+
+	a.load(memLocal2)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.load(memLocal1)
+	a.load(memLocal0)
+	a.pushBytes(topic("Transfer(address,address,uint256)"))
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+}
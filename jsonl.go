@@ -0,0 +1,123 @@
+package walletsdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// jsonlFile appends records to a JSONL file, syncing after every line
+type jsonlFile struct {
+	path string
+	kind string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJSONL opens or creates a JSONL file of the given kind, used in errors.
+// A torn final line left by a crash during an append is cut off first, so
+// the next record starts on a line of its own.
+func openJSONL(path, kind string) (*jsonlFile, error) {
+	// Corruption before the final line is left for readers to report
+	size, err := scanJSONL(path, kind, "record", func(*json.RawMessage) {})
+	if info, statErr := os.Stat(path); err == nil && statErr == nil && info.Size() > size {
+		if err := os.Truncate(path, size); err != nil {
+			return nil, fmt.Errorf("failed to repair %s file: %w", kind, err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s file: %w", kind, err)
+	}
+	return &jsonlFile{path: path, kind: kind, file: file}, nil
+}
+
+// append writes v as a single line and syncs the file
+func (f *jsonlFile) append(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *jsonlFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// readLatest reads every record of the file and keeps the last one of each
+// key, in the order keys first appeared
+func readLatest[T any](f *jsonlFile, record string, key func(*T) string) ([]T, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var records []T
+	index := make(map[string]int)
+	_, err := scanJSONL(f.path, f.kind, record, func(r *T) {
+		if i, ok := index[key(r)]; ok {
+			records[i] = *r
+			return
+		}
+		index[key(r)] = len(records)
+		records = append(records, *r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// scanJSONL decodes every line of a JSONL file into a T and passes it to fn.
+// The final line is skipped if it has no newline or does not decode, since
+// a crash during an append leaves it torn; a bad line before it is
+// corruption. It returns the size of the file up to the last good line.
+func scanJSONL[T any](path, kind, record string, fn func(*T)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s file: %w", kind, err)
+	}
+	defer file.Close()
+
+	var (
+		size int64
+		torn error
+	)
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// An unterminated tail was never fully written
+			return size, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s file: %w", kind, err)
+		}
+		if torn != nil {
+			return 0, torn
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			size += int64(len(data))
+			continue
+		}
+		var r T
+		if err := json.Unmarshal(data, &r); err != nil {
+			torn = fmt.Errorf("invalid %s on line %d: %w", record, line, err)
+			continue
+		}
+		fn(&r)
+		size += int64(len(data))
+	}
+}
@@ -0,0 +1,205 @@
+package walletsdk
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultRedactedFields are log attribute keys whose values are always
+// replaced by "[REDACTED]". Keys are matched case-insensitively, including
+// inside groups. ClientConfig.LogRedact adds to them.
+var DefaultRedactedFields = []string{
+	"private_key",
+	"privatekey",
+	"signature",
+	"raw",
+	"raw_tx",
+	"password",
+	"secret",
+	"mnemonic",
+	"seed",
+	"authorization",
+}
+
+const redactedValue = "[REDACTED]"
+
+// discardLogger returns logger, or a logger dropping everything when it is nil
+func discardLogger(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return logger
+}
+
+// newLogger wraps logger so redacted fields never reach its handler. A nil
+// logger discards everything.
+func newLogger(logger *slog.Logger, redact []string) *slog.Logger {
+	if logger == nil {
+		return discardLogger(nil)
+	}
+	fields := make(map[string]bool)
+	for _, field := range DefaultRedactedFields {
+		fields[strings.ToLower(field)] = true
+	}
+	for _, field := range redact {
+		fields[strings.ToLower(field)] = true
+	}
+	return slog.New(&redactHandler{inner: logger.Handler(), fields: fields})
+}
+
+// discardHandler drops every record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// redactHandler replaces the values of sensitive attributes before passing
+// records on
+type redactHandler struct {
+	inner  slog.Handler
+	fields map[string]bool
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redact(attr))
+		return true
+	})
+	return h.inner.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redact(attr)
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(redacted), fields: h.fields}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name), fields: h.fields}
+}
+
+func (h *redactHandler) redact(attr slog.Attr) slog.Attr {
+	if h.fields[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redactedValue)
+	}
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = h.redact(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	}
+	return attr
+}
+
+// redactURL strips credentials from an RPC URL. Providers often put API keys
+// in the user info, the query or a long path segment.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "unparseable URL"
+	}
+	if u.Host == "" {
+		// IPC paths carry no credentials
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "REDACTED"
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if len(segment) >= 20 {
+			segments[i] = "REDACTED"
+		}
+	}
+	u.Path = strings.Join(segments, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// txKind names the contract method tx calls, such as "StakeWallet.addFunds"
+func (c *Client) txKind(tx *types.Transaction) string {
+	if tx.To() == nil {
+		return "deploy"
+	}
+	contract := c.contractName(*tx.To())
+	if contract == "" {
+		return "unknown"
+	}
+	method, _, err := decodeCall(contract, tx.Data())
+	if err != nil {
+		return contract
+	}
+	return contract + "." + method.Name
+}
+
+// logSigner wraps a signer so every signature is logged at debug level
+func (c *Client) logSigner(signer bind.SignerFn) bind.SignerFn {
+	return func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		signed, err := signer(from, tx)
+		if err != nil {
+			c.logger.Debug("signing failed", "from", from, "nonce", tx.Nonce(), "kind", c.txKind(tx), "error", err)
+			return nil, err
+		}
+		c.logger.Debug("signed transaction", "from", from, "nonce", tx.Nonce(), "kind", c.txKind(tx),
+			"tx", signed.Hash(), "gas", signed.Gas())
+		return signed, nil
+	}
+}
+
+// waitInterval is how often waitMined reports a transaction that is still
+// pending
+var waitInterval = 30 * time.Second
+
+// waitMined waits for tx like bind.WaitMined, logging the wait so a stuck
+// transaction shows up in the logs rather than as a silent hang
+func waitMined(ctx context.Context, backend bind.DeployBackend, logger *slog.Logger, tx *types.Transaction) (*types.Receipt, error) {
+	start := time.Now()
+	logger.Info("waiting for transaction", "tx", tx.Hash(), "nonce", tx.Nonce())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(waitInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				logger.Warn("transaction still pending", "tx", tx.Hash(), "nonce", tx.Nonce(),
+					"elapsed", time.Since(start).Round(time.Second))
+			}
+		}
+	}()
+
+	receipt, err := bind.WaitMined(ctx, backend, tx)
+	if err != nil {
+		logger.Error("waiting for transaction failed", "tx", tx.Hash(), "elapsed", time.Since(start), "error", err)
+		return nil, err
+	}
+	logger.Info("transaction mined", "tx", tx.Hash(), "block", receipt.BlockNumber,
+		"status", receipt.Status, "elapsed", time.Since(start))
+	return receipt, nil
+}
@@ -0,0 +1,150 @@
+package walletsdk_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// logBuffer collects JSON log records
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) logger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(b, &slog.HandlerOptions{Level: level}))
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// records returns the logged records with message msg
+func (b *logBuffer) records(t *testing.T, msg string) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(b.String()))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", scanner.Text(), err)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestLogging(t *testing.T) {
+	chain := newChain(t)
+	var logs logBuffer
+	config := chain.Config(chain.Accounts[0])
+	config.Logger = logs.logger(slog.LevelDebug)
+	config.LogRedact = []string{"From"}
+	client, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+
+	tx, err := client.AddFunds(tokens(5), "device-1")
+	if err != nil {
+		t.Fatalf("AddFunds: %v", err)
+	}
+	if _, err := bind.WaitMined(context.Background(), client, tx); err != nil {
+		t.Fatalf("WaitMined: %v", err)
+	}
+
+	if len(logs.records(t, "client ready")) != 1 {
+		t.Errorf("client ready not logged")
+	}
+	broadcasts := logs.records(t, "transaction broadcast")
+	if len(broadcasts) != 2 || broadcasts[0]["kind"] != "ParityToken.approve" || broadcasts[1]["kind"] != "StakeWallet.addFunds" {
+		t.Errorf("broadcasts logged as %v", broadcasts)
+	}
+	if mined := logs.records(t, "transaction mined"); len(mined) != 1 || mined[0]["level"] != "INFO" {
+		t.Errorf("approval wait logged as %v", mined)
+	}
+	if len(logs.records(t, "RPC request")) == 0 {
+		t.Errorf("no RPC requests logged at debug level")
+	}
+
+	signed := logs.records(t, "signed transaction")
+	if len(signed) != 2 {
+		t.Fatalf("logged %d signatures, want 2", len(signed))
+	}
+	for _, record := range signed {
+		if record["from"] != "[REDACTED]" {
+			t.Errorf("from not redacted: %v", record["from"])
+		}
+	}
+}
+
+func TestLoggingLevels(t *testing.T) {
+	chain := newChain(t)
+	var logs logBuffer
+	config := chain.Config(chain.Accounts[0])
+	config.Logger = logs.logger(slog.LevelInfo)
+	client, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	if _, err := client.Transfer(chain.Accounts[1].Address, tokens(1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	if len(logs.records(t, "transaction broadcast")) != 1 {
+		t.Errorf("broadcast not logged at info level")
+	}
+	for _, msg := range []string{"RPC request", "signed transaction"} {
+		if len(logs.records(t, msg)) != 0 {
+			t.Errorf("%q logged at info level", msg)
+		}
+	}
+}
+
+func TestLoggingRedactsEndpointURLs(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	var logs logBuffer
+	url := node.URL + "/v3/0123456789abcdef0123456789abcdef?apikey=hunter2"
+	backend, err := walletsdk.DialFailover(context.Background(), []walletsdk.Endpoint{{URL: url}},
+		walletsdk.FailoverOptions{HealthInterval: -1, Logger: logs.logger(slog.LevelDebug)})
+	if err != nil {
+		t.Fatalf("DialFailover: %v", err)
+	}
+	defer backend.Close()
+
+	node.failing.Store(true)
+	backend.Probe(context.Background())
+
+	output := logs.String()
+	if !strings.Contains(output, "RPC endpoint unhealthy") {
+		t.Fatalf("unhealthy endpoint not logged:\n%s", output)
+	}
+	for _, secret := range []string{"0123456789abcdef0123456789abcdef", "hunter2"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("log output leaks %q:\n%s", secret, output)
+		}
+	}
+	if status := backend.Status(); status[0].LastError != nil && strings.Contains(status[0].LastError.Error(), "hunter2") {
+		t.Errorf("endpoint error leaks the URL: %v", status[0].LastError)
+	}
+}
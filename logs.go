@@ -0,0 +1,76 @@
+package walletsdk
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// logIterator steps through the logs of a filter query. It backs the event
+// iterators of the contract bindings, which only add typed Event methods.
+type logIterator struct {
+	event    string
+	contract *bind.BoundContract
+	logs     []types.Log
+	started  bool
+	done     bool
+	fail     error
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *logIterator) Next() bool {
+	if it.fail != nil || it.done {
+		return false
+	}
+	// The first call positions the iterator on the first log
+	if it.started {
+		it.logs = it.logs[1:]
+	}
+	it.started = true
+	if len(it.logs) == 0 {
+		it.done = true
+		return false
+	}
+	return true
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *logIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *logIterator) Close() error {
+	it.done = true
+	return nil
+}
+
+// collectLogs drains a BoundContract.FilterLogs result. The log channel is
+// never closed, so the end of the subscription marks the last log.
+func collectLogs(logsChan chan types.Log, sub event.Subscription) ([]types.Log, error) {
+	defer sub.Unsubscribe()
+
+	logs := make([]types.Log, 0)
+	for {
+		select {
+		case log := <-logsChan:
+			logs = append(logs, log)
+		case err := <-sub.Err():
+			if err != nil {
+				return nil, err
+			}
+			// The channel is buffered, so logs may remain after the end
+			for {
+				select {
+				case log := <-logsChan:
+					logs = append(logs, log)
+				default:
+					return logs, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package walletsdk
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// backendRequest describes one request made through a middleware backend
+type backendRequest struct {
+	// Method is the JSON-RPC method the request maps to
+	Method string
+	// Args identify the request, e.g. for coalescing and caching
+	Args []interface{}
+	// Write is set for requests that broadcast a transaction
+	Write bool
+	// Tx is the signed transaction of a write
+	Tx *types.Transaction
+}
+
+// backendCall performs a request against a concrete backend
+type backendCall func(ctx context.Context, backend Backend) (interface{}, error)
+
+// backendHandler runs a request, typically by invoking call one or more times
+type backendHandler func(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error)
+
+// middlewareBackend implements Backend by routing every request except log
+// subscriptions through handle. Subscriptions are long lived and go straight
+// to subscriber.
+type middlewareBackend struct {
+	handle     backendHandler
+	subscriber func() Backend
+}
+
+// invoke runs a typed request through the handler
+func invoke[T any](m *middlewareBackend, ctx context.Context, req *backendRequest, call func(ctx context.Context, backend Backend) (T, error)) (T, error) {
+	v, err := m.handle(ctx, req, func(ctx context.Context, backend Backend) (interface{}, error) {
+		return call(ctx, backend)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// blockArg renders a block number the way JSON-RPC does
+func blockArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return number.String()
+}
+
+func (m *middlewareBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	req := &backendRequest{Method: "eth_getCode", Args: []interface{}{contract, blockArg(blockNumber)}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) ([]byte, error) {
+		return b.CodeAt(ctx, contract, blockNumber)
+	})
+}
+
+func (m *middlewareBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	req := &backendRequest{Method: "eth_call", Args: []interface{}{callArgs(call), blockArg(blockNumber)}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) ([]byte, error) {
+		return b.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (m *middlewareBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	req := &backendRequest{Method: "eth_getBlockByNumber", Args: []interface{}{blockArg(number)}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (*types.Header, error) {
+		return b.HeaderByNumber(ctx, number)
+	})
+}
+
+func (m *middlewareBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	req := &backendRequest{Method: "eth_getCode", Args: []interface{}{account, "pending"}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) ([]byte, error) {
+		return b.PendingCodeAt(ctx, account)
+	})
+}
+
+func (m *middlewareBackend) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	req := &backendRequest{Method: "eth_call", Args: []interface{}{callArgs(call), "pending"}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) ([]byte, error) {
+		return pendingCall(ctx, b, call)
+	})
+}
+
+// pendingCall runs call against the pending state of backend if it has one
+func pendingCall(ctx context.Context, backend Backend, call ethereum.CallMsg) ([]byte, error) {
+	pending, ok := backend.(bind.PendingContractCaller)
+	if !ok {
+		return nil, bind.ErrNoPendingState
+	}
+	return pending.PendingCallContract(ctx, call)
+}
+
+func (m *middlewareBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	req := &backendRequest{Method: "eth_getTransactionCount", Args: []interface{}{account, "pending"}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (uint64, error) {
+		return b.PendingNonceAt(ctx, account)
+	})
+}
+
+func (m *middlewareBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	req := &backendRequest{Method: "eth_gasPrice"}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (*big.Int, error) {
+		return b.SuggestGasPrice(ctx)
+	})
+}
+
+func (m *middlewareBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	req := &backendRequest{Method: "eth_maxPriorityFeePerGas"}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (*big.Int, error) {
+		return b.SuggestGasTipCap(ctx)
+	})
+}
+
+func (m *middlewareBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	req := &backendRequest{Method: "eth_estimateGas", Args: []interface{}{callArgs(call)}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (uint64, error) {
+		return b.EstimateGas(ctx, call)
+	})
+}
+
+func (m *middlewareBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	req := &backendRequest{Method: "eth_sendRawTransaction", Args: []interface{}{tx.Hash()}, Write: true, Tx: tx}
+	_, err := invoke(m, ctx, req, func(ctx context.Context, b Backend) (struct{}, error) {
+		return struct{}{}, b.SendTransaction(ctx, tx)
+	})
+	return err
+}
+
+func (m *middlewareBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	req := &backendRequest{Method: "eth_getLogs", Args: []interface{}{filterArgs(query)}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) ([]types.Log, error) {
+		return b.FilterLogs(ctx, query)
+	})
+}
+
+func (m *middlewareBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return m.subscriber().SubscribeFilterLogs(ctx, query, ch)
+}
+
+func (m *middlewareBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	req := &backendRequest{Method: "eth_getTransactionReceipt", Args: []interface{}{txHash}}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (*types.Receipt, error) {
+		return b.TransactionReceipt(ctx, txHash)
+	})
+}
+
+// txLookup is the result of TransactionByHash
+type txLookup struct {
+	tx      *types.Transaction
+	pending bool
+}
+
+func (m *middlewareBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	req := &backendRequest{Method: "eth_getTransactionByHash", Args: []interface{}{txHash}}
+	lookup, err := invoke(m, ctx, req, func(ctx context.Context, b Backend) (txLookup, error) {
+		tx, pending, err := b.TransactionByHash(ctx, txHash)
+		return txLookup{tx: tx, pending: pending}, err
+	})
+	return lookup.tx, lookup.pending, err
+}
+
+func (m *middlewareBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	req := &backendRequest{Method: "eth_chainId"}
+	return invoke(m, ctx, req, func(ctx context.Context, b Backend) (*big.Int, error) {
+		return b.ChainID(ctx)
+	})
+}
+
+// callArgKey is the comparable identity of a call message
+type callArgKey struct {
+	From      common.Address
+	To        common.Address
+	Gas       uint64
+	GasPrice  string
+	GasFeeCap string
+	GasTipCap string
+	Value     string
+	Data      string
+}
+
+func callArgs(call ethereum.CallMsg) callArgKey {
+	key := callArgKey{
+		From:      call.From,
+		Gas:       call.Gas,
+		GasPrice:  bigString(call.GasPrice),
+		GasFeeCap: bigString(call.GasFeeCap),
+		GasTipCap: bigString(call.GasTipCap),
+		Value:     bigString(call.Value),
+		Data:      string(call.Data),
+	}
+	if call.To != nil {
+		key.To = *call.To
+	}
+	return key
+}
+
+// filterArgs renders a filter query, which holds pointers and slices, as a
+// comparable string
+func filterArgs(query ethereum.FilterQuery) string {
+	var b strings.Builder
+	if query.BlockHash != nil {
+		fmt.Fprintf(&b, "hash=%s ", query.BlockHash.Hex())
+	}
+	fmt.Fprintf(&b, "from=%s to=%s addresses=%v topics=[", blockArg(query.FromBlock), blockArg(query.ToBlock), query.Addresses)
+	for _, topics := range query.Topics {
+		fmt.Fprintf(&b, "%v", topics)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func bigString(v *big.Int) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
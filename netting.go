@@ -0,0 +1,541 @@
+package walletsdk
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PaymentNetted is the trace status of payments cancelled out entirely by
+// payments in the opposite direction, which need no transaction
+const PaymentNetted = "netted"
+
+// PaymentDropped is the trace status of payments whose transfer failed
+// MaxAttempts times and is no longer retried
+const PaymentDropped = "dropped"
+
+// NetTransfer is one on-chain payment settling the net amount of every
+// instruction between its two devices
+type NetTransfer struct {
+	Payment Payment
+	// Instructions are the IDs of the instructions between the two devices,
+	// in either direction
+	Instructions []string
+	// Group identifies the transfers that together settle instructions
+	// joined by cycle cancellation. Each of those instructions is paid only
+	// once every transfer of its group is confirmed.
+	Group string
+}
+
+// NettingPlan is the result of netting a set of payment instructions
+type NettingPlan struct {
+	Transfers []NetTransfer
+	// Instructions maps each instruction ID to the IDs of the transfers that
+	// settle it. Cycle cancellation ties instructions to the transfers of
+	// every device pair in the cycle. An empty list means the instruction
+	// was cancelled out entirely.
+	Instructions map[string][]string
+}
+
+// NetPayments computes the net transfers settling payments. Instructions
+// between the same two devices are netted into at most one transfer. With
+// cancelCycles, amounts flowing around a cycle of devices, such as A to B,
+// B to C and C to A, are cancelled as well, which removes at least one
+// transfer per cycle. The plan is deterministic for a set of payments.
+func NetPayments(payments []Payment, cancelCycles bool) (*NettingPlan, error) {
+	type pair struct{ low, high string }
+	nets := make(map[pair]*big.Int)
+	members := make(map[pair][]string)
+	seen := make(map[string]bool)
+	for _, p := range payments {
+		if err := checkInstruction(p); err != nil {
+			return nil, err
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("duplicate payment ID %s", p.ID)
+		}
+		seen[p.ID] = true
+
+		// The net of a pair is positive when it flows from low to high
+		key, amount := pair{p.Creator, p.Solver}, new(big.Int).Set(p.Amount)
+		if p.Solver < p.Creator {
+			key, amount = pair{p.Solver, p.Creator}, amount.Neg(amount)
+		}
+		if nets[key] == nil {
+			nets[key] = new(big.Int)
+		}
+		nets[key].Add(nets[key], amount)
+		members[key] = append(members[key], p.ID)
+	}
+
+	keys := make([]pair, 0, len(nets))
+	for key := range nets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].low != keys[j].low {
+			return keys[i].low < keys[j].low
+		}
+		return keys[i].high < keys[j].high
+	})
+
+	// Directed edges carry the positive net of each pair
+	graph := newNetGraph()
+	for _, key := range keys {
+		switch net := nets[key]; net.Sign() {
+		case 1:
+			graph.add(key.low, key.high, net)
+		case -1:
+			graph.add(key.high, key.low, new(big.Int).Neg(net))
+		}
+	}
+
+	// groups joins pairs whose settlement depends on each other
+	groups := newUnionFind()
+	if cancelCycles {
+		for cycle := graph.cycle(); cycle != nil; cycle = graph.cycle() {
+			least := new(big.Int).Set(graph.amount(cycle[0], cycle[1]))
+			for i := 1; i < len(cycle)-1; i++ {
+				if a := graph.amount(cycle[i], cycle[i+1]); a.Cmp(least) < 0 {
+					least.Set(a)
+				}
+			}
+			for i := 0; i < len(cycle)-1; i++ {
+				graph.reduce(cycle[i], cycle[i+1], least)
+				groups.union(pairKey(cycle[0], cycle[1]), pairKey(cycle[i], cycle[i+1]))
+			}
+		}
+	}
+
+	plan := &NettingPlan{Instructions: make(map[string][]string)}
+	transfers := make(map[string][]string)
+	grouped := make(map[string][]string)
+	for _, key := range keys {
+		group := groups.find(pairKey(key.low, key.high))
+		grouped[group] = append(grouped[group], members[key]...)
+	}
+	for _, key := range keys {
+		from, to := key.low, key.high
+		amount := graph.amount(from, to)
+		if amount.Sign() == 0 {
+			from, to = to, from
+			amount = graph.amount(from, to)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		ids := append([]string(nil), members[key]...)
+		sort.Strings(ids)
+		group := groups.find(pairKey(key.low, key.high))
+		transfer := NetTransfer{
+			Payment:      Payment{ID: netTransferID(ids), Creator: from, Solver: to, Amount: new(big.Int).Set(amount)},
+			Instructions: ids,
+			Group:        netGroupID(grouped[group]),
+		}
+		plan.Transfers = append(plan.Transfers, transfer)
+		transfers[group] = append(transfers[group], transfer.Payment.ID)
+	}
+	for _, key := range keys {
+		settled := transfers[groups.find(pairKey(key.low, key.high))]
+		for _, id := range members[key] {
+			plan.Instructions[id] = settled
+		}
+	}
+	return plan, nil
+}
+
+func checkInstruction(p Payment) error {
+	switch {
+	case p.ID == "":
+		return fmt.Errorf("payment from %s to %s has no ID", p.Creator, p.Solver)
+	case p.Amount == nil || p.Amount.Sign() <= 0:
+		return fmt.Errorf("payment %s: amount must be positive", p.ID)
+	case p.Creator == "" || p.Solver == "":
+		return fmt.Errorf("payment %s: creator and solver devices are required", p.ID)
+	case p.Creator == p.Solver:
+		return fmt.Errorf("payment %s: creator and solver are the same device", p.ID)
+	}
+	return nil
+}
+
+// netTransferID derives a transfer ID from the instructions it settles, so
+// a retried plan reuses the IDs the settler remembers
+func netTransferID(instructions []string) string {
+	return "net-" + instructionsHash(instructions)
+}
+
+// netGroupID derives a group ID from the instructions of every pair in it
+func netGroupID(instructions []string) string {
+	ids := append([]string(nil), instructions...)
+	sort.Strings(ids)
+	return "group-" + instructionsHash(ids)
+}
+
+func instructionsHash(instructions []string) string {
+	hash := crypto.Keccak256([]byte(strings.Join(instructions, "\x00")))
+	return hexutil.Encode(hash[:8])[2:]
+}
+
+func pairKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "\x00" + b
+}
+
+// netGraph is a directed graph of positive amounts between devices
+type netGraph struct {
+	edges map[string]map[string]*big.Int
+}
+
+func newNetGraph() *netGraph {
+	return &netGraph{edges: make(map[string]map[string]*big.Int)}
+}
+
+func (g *netGraph) add(from, to string, amount *big.Int) {
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]*big.Int)
+	}
+	g.edges[from][to] = new(big.Int).Set(amount)
+}
+
+func (g *netGraph) amount(from, to string) *big.Int {
+	if a, ok := g.edges[from][to]; ok {
+		return a
+	}
+	return new(big.Int)
+}
+
+func (g *netGraph) reduce(from, to string, amount *big.Int) {
+	remaining := g.edges[from][to].Sub(g.edges[from][to], amount)
+	if remaining.Sign() == 0 {
+		delete(g.edges[from], to)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cycle returns a directed cycle as its devices with the first repeated at
+// the end, or nil when the graph is acyclic
+func (g *netGraph) cycle() []string {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = active
+		path = append(path, node)
+		for _, next := range sortedKeys(g.edges[node]) {
+			switch state[next] {
+			case active:
+				for i, n := range path {
+					if n == next {
+						return append(append([]string(nil), path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = done
+		return nil
+	}
+	for _, node := range sortedKeys(g.edges) {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+type unionFind map[string]string
+
+func newUnionFind() unionFind {
+	return make(unionFind)
+}
+
+func (u unionFind) find(x string) string {
+	for {
+		parent, ok := u[x]
+		if !ok || parent == x {
+			return x
+		}
+		x = parent
+	}
+}
+
+func (u unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u[rb] = ra
+	}
+}
+
+// NettingOptions configures a Netter
+type NettingOptions struct {
+	// Window is how often Run settles the buffered instructions, one
+	// minute by default
+	Window time.Duration
+	// CancelCycles cancels amounts flowing around cycles of devices
+	CancelCycles bool
+	// MaxAttempts is how many times a transfer is sent before it is
+	// dropped, 5 by default. Transfers whose transaction is pending are
+	// waited for and do not use up attempts.
+	MaxAttempts int
+	// OnFlush is called by Run after every settlement
+	OnFlush func(*NettingReport, error)
+}
+
+// NettingReport describes one settled window
+type NettingReport struct {
+	Instructions int
+	Transfers    []NetTransfer
+	// Results holds the settler result of every transfer of the window and
+	// of transfers retried from earlier windows
+	Results []PaymentResult
+	// Dropped holds the transfers that failed for the last time in this
+	// window. Their instructions are not paid, and other transfers of their
+	// groups may have been confirmed already.
+	Dropped []DroppedTransfer
+}
+
+// DroppedTransfer is a net transfer given up after MaxAttempts
+type DroppedTransfer struct {
+	Transfer NetTransfer
+	Result   PaymentResult
+	// Settled are the IDs of the confirmed transfers of the same group,
+	// which leave its instructions paid only in part
+	Settled []string
+}
+
+// PaymentTrace links a payment instruction to the transactions that settled
+// it
+type PaymentTrace struct {
+	Payment Payment
+	// Transfers are the IDs of the net transfers settling the payment
+	Transfers []string
+	// Status is PaymentNetted when no transfer was needed, PaymentConfirmed
+	// once every transfer is confirmed, PaymentDropped when a transfer was
+	// given up and otherwise the status of a transfer still outstanding
+	Status string
+	// Txs are the transactions sent for the transfers
+	Txs []*types.Transaction
+}
+
+// Netter buffers TransferPayment instructions and settles only their net
+// amounts. Transfers that fail are retried under the same ID with the next
+// window, so the instructions they settle are never paid twice, until they
+// run out of attempts.
+type Netter struct {
+	settler *Settler
+	options NettingOptions
+
+	mu       sync.Mutex
+	buffer   []Payment
+	buffered map[string]bool
+	retry    []NetTransfer
+	traces   map[string]PaymentTrace
+	// transfers holds the latest result of every transfer by ID
+	transfers map[string]PaymentResult
+	attempts  map[string]int
+	dropped   map[string]bool
+}
+
+// NewNetter returns a netter settling through settler
+func NewNetter(settler *Settler, options NettingOptions) *Netter {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 5
+	}
+	return &Netter{
+		settler:   settler,
+		options:   options,
+		buffered:  make(map[string]bool),
+		traces:    make(map[string]PaymentTrace),
+		transfers: make(map[string]PaymentResult),
+		attempts:  make(map[string]int),
+		dropped:   make(map[string]bool),
+	}
+}
+
+// Add buffers a payment instruction until the next flush
+func (n *Netter) Add(p Payment) error {
+	if err := checkInstruction(p); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.traces[p.ID]; ok || n.buffered[p.ID] {
+		return fmt.Errorf("duplicate payment ID %s", p.ID)
+	}
+	n.buffered[p.ID] = true
+	n.buffer = append(n.buffer, p)
+	return nil
+}
+
+// Pending returns the number of buffered instructions
+func (n *Netter) Pending() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.buffer)
+}
+
+// Flush nets the buffered instructions and settles the net transfers along
+// with the failed transfers of earlier windows. The netter is not locked
+// while the transfers are settled.
+func (n *Netter) Flush(ctx context.Context) (*NettingReport, error) {
+	n.mu.Lock()
+	plan, err := NetPayments(n.buffer, n.options.CancelCycles)
+	if err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	report := &NettingReport{Instructions: len(n.buffer), Transfers: plan.Transfers}
+	for _, p := range n.buffer {
+		n.traces[p.ID] = PaymentTrace{Payment: p, Transfers: plan.Instructions[p.ID]}
+	}
+	n.buffer, n.buffered = nil, make(map[string]bool)
+	transfers := append(n.retry, plan.Transfers...)
+	n.retry = nil
+	n.mu.Unlock()
+
+	if len(transfers) == 0 {
+		return report, nil
+	}
+	payments := make([]Payment, len(transfers))
+	for i, transfer := range transfers {
+		payments[i] = transfer.Payment
+	}
+	results, err := n.settler.Settle(ctx, payments)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.retry = append(n.retry, transfers...)
+		return report, err
+	}
+	report.Results = results
+	for _, result := range results {
+		n.transfers[result.Payment.ID] = result
+	}
+	for i, result := range results {
+		id := result.Payment.ID
+		switch {
+		case result.Status == PaymentConfirmed:
+			delete(n.attempts, id)
+		case result.Status == PaymentPending:
+			n.retry = append(n.retry, transfers[i])
+		case n.attempts[id]+1 >= n.options.MaxAttempts:
+			delete(n.attempts, id)
+			n.dropped[id] = true
+			dropped := DroppedTransfer{Transfer: transfers[i], Result: result, Settled: n.settledLegs(transfers[i])}
+			report.Dropped = append(report.Dropped, dropped)
+			n.settler.client.logger.Warn("dropped net transfer", "id", id, "group", transfers[i].Group, "status", result.Status,
+				"attempts", n.options.MaxAttempts, "settled", len(dropped.Settled), "error", result.Err)
+		default:
+			n.attempts[id]++
+			n.retry = append(n.retry, transfers[i])
+		}
+	}
+	n.settler.client.logger.Info("netted payments", "instructions", report.Instructions,
+		"transfers", len(plan.Transfers), "retried", len(transfers)-len(plan.Transfers), "dropped", len(report.Dropped))
+	return report, nil
+}
+
+// settledLegs returns the IDs of the confirmed transfers that share a group
+// with transfer
+func (n *Netter) settledLegs(transfer NetTransfer) []string {
+	if len(transfer.Instructions) == 0 {
+		return nil
+	}
+	// Every instruction of a transfer is settled by the whole group
+	var settled []string
+	for _, leg := range n.traces[transfer.Instructions[0]].Transfers {
+		if leg != transfer.Payment.ID && n.transfers[leg].Status == PaymentConfirmed {
+			settled = append(settled, leg)
+		}
+	}
+	return settled
+}
+
+// Run flushes every window until ctx ends, then flushes once more
+func (n *Netter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(n.options.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Give the final flush its own deadline, ctx is already done
+			final, cancel := context.WithTimeout(context.Background(), n.options.Window)
+			defer cancel()
+			n.flushAndReport(final)
+			return ctx.Err()
+		case <-ticker.C:
+			n.flushAndReport(ctx)
+		}
+	}
+}
+
+func (n *Netter) flushAndReport(ctx context.Context) {
+	report, err := n.Flush(ctx)
+	if n.options.OnFlush != nil {
+		n.options.OnFlush(report, err)
+	}
+}
+
+// Trace returns how the instruction with the given ID was settled. It is
+// false for unknown and still buffered instructions.
+func (n *Netter) Trace(id string) (PaymentTrace, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	trace, ok := n.traces[id]
+	if !ok {
+		return PaymentTrace{}, false
+	}
+	trace.Status = PaymentNetted
+	if len(trace.Transfers) > 0 {
+		trace.Status = PaymentConfirmed
+	}
+	for _, transfer := range trace.Transfers {
+		result, ok := n.transfers[transfer]
+		if !ok {
+			trace.Status = PaymentNotSent
+			continue
+		}
+		if result.Tx != nil {
+			trace.Txs = append(trace.Txs, result.Tx)
+		}
+		if n.dropped[transfer] {
+			trace.Status = PaymentDropped
+		} else if result.Status != PaymentConfirmed && trace.Status != PaymentDropped {
+			trace.Status = result.Status
+		}
+	}
+	return trace, true
+}
@@ -0,0 +1,267 @@
+package walletsdk_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func pay(id, creator, solver string, amount int64) walletsdk.Payment {
+	return walletsdk.Payment{ID: id, Creator: creator, Solver: solver, Amount: big.NewInt(amount)}
+}
+
+// transfersOf renders a plan as creator>solver:amount strings
+func transfersOf(plan *walletsdk.NettingPlan) map[string]int64 {
+	out := make(map[string]int64)
+	for _, transfer := range plan.Transfers {
+		out[transfer.Payment.Creator+">"+transfer.Payment.Solver] = transfer.Payment.Amount.Int64()
+	}
+	return out
+}
+
+func TestNetPayments(t *testing.T) {
+	payments := []walletsdk.Payment{
+		pay("1", "a", "b", 5),
+		pay("2", "b", "a", 3),
+		pay("3", "a", "b", 1),
+		pay("4", "c", "d", 2),
+		pay("5", "d", "c", 2),
+	}
+	plan, err := walletsdk.NetPayments(payments, false)
+	if err != nil {
+		t.Fatalf("NetPayments: %v", err)
+	}
+	if got := transfersOf(plan); !reflect.DeepEqual(got, map[string]int64{"a>b": 3}) {
+		t.Fatalf("transfers = %v", got)
+	}
+	id := plan.Transfers[0].Payment.ID
+	for _, instruction := range []string{"1", "2", "3"} {
+		if !reflect.DeepEqual(plan.Instructions[instruction], []string{id}) {
+			t.Errorf("instruction %s settled by %v, want %s", instruction, plan.Instructions[instruction], id)
+		}
+	}
+	if settled, ok := plan.Instructions["4"]; !ok || len(settled) != 0 {
+		t.Errorf("offsetting instruction settled by %v", settled)
+	}
+
+	// The plan does not depend on the order of instructions
+	rand.Shuffle(len(payments), func(i, j int) { payments[i], payments[j] = payments[j], payments[i] })
+	again, _ := walletsdk.NetPayments(payments, false)
+	if !reflect.DeepEqual(plan, again) {
+		t.Errorf("plan changed with instruction order:\n%+v\n%+v", plan, again)
+	}
+
+	if _, err := walletsdk.NetPayments([]walletsdk.Payment{pay("1", "a", "a", 1)}, false); err == nil {
+		t.Error("self payment accepted")
+	}
+}
+
+func TestNetPaymentsCycles(t *testing.T) {
+	payments := []walletsdk.Payment{
+		pay("ab", "a", "b", 5),
+		pay("bc", "b", "c", 3),
+		pay("ca", "c", "a", 4),
+		pay("de", "d", "e", 1),
+	}
+	plain, _ := walletsdk.NetPayments(payments, false)
+	if len(plain.Transfers) != 4 {
+		t.Fatalf("netted without cycle cancellation to %v", transfersOf(plain))
+	}
+
+	plan, err := walletsdk.NetPayments(payments, true)
+	if err != nil {
+		t.Fatalf("NetPayments: %v", err)
+	}
+	want := map[string]int64{"a>b": 2, "c>a": 1, "d>e": 1}
+	if got := transfersOf(plan); !reflect.DeepEqual(got, want) {
+		t.Fatalf("transfers = %v, want %v", got, want)
+	}
+	// The cancelled payment depends on the remaining transfers of its cycle
+	if settled := plan.Instructions["bc"]; len(settled) != 2 {
+		t.Errorf("cancelled instruction settled by %v", settled)
+	}
+	if settled := plan.Instructions["de"]; len(settled) != 1 {
+		t.Errorf("unrelated instruction settled by %v", settled)
+	}
+
+	// A perfect cycle needs no transfer at all
+	plan, _ = walletsdk.NetPayments([]walletsdk.Payment{pay("1", "a", "b", 2), pay("2", "b", "c", 2), pay("3", "c", "a", 2)}, true)
+	if len(plan.Transfers) != 0 || len(plan.Instructions["2"]) != 0 {
+		t.Errorf("perfect cycle netted to %v", transfersOf(plan))
+	}
+}
+
+func TestNetter(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"a": tokens(10), "b": tokens(10), "poor": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	netter := walletsdk.NewNetter(walletsdk.NewSettler(owner, walletsdk.SettlementOptions{}), walletsdk.NettingOptions{})
+
+	for _, p := range []walletsdk.Payment{
+		{ID: "1", Creator: "a", Solver: "b", Amount: tokens(4)},
+		{ID: "2", Creator: "b", Solver: "a", Amount: tokens(1)},
+		{ID: "3", Creator: "a", Solver: "b", Amount: tokens(2)},
+		{ID: "4", Creator: "poor", Solver: "a", Amount: tokens(5)},
+	} {
+		if err := netter.Add(p); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := netter.Add(walletsdk.Payment{ID: "1", Creator: "a", Solver: "b", Amount: tokens(1)}); err == nil {
+		t.Fatal("duplicate ID accepted")
+	}
+
+	report, err := netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if report.Instructions != 4 || len(report.Transfers) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	expectStake(t, owner, "a", tokens(5))
+	expectStake(t, owner, "b", tokens(15))
+
+	trace, ok := netter.Trace("2")
+	if !ok || trace.Status != walletsdk.PaymentConfirmed || len(trace.Txs) != 1 {
+		t.Fatalf("trace of netted instruction = %+v", trace)
+	}
+	first, _ := netter.Trace("1")
+	if first.Txs[0].Hash() != trace.Txs[0].Hash() {
+		t.Errorf("instructions of one pair traced to different transactions")
+	}
+	if trace, _ := netter.Trace("4"); trace.Status != walletsdk.PaymentNotSent {
+		t.Fatalf("unfunded instruction traced as %s", trace.Status)
+	}
+
+	// The failed transfer is retried with the next window once funded
+	client := newClient(t, chain, chain.Accounts[2])
+	tx, err := client.AddFunds(tokens(10), "poor")
+	mined(t, chain, tx, err)
+	if _, err := netter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if trace, _ := netter.Trace("4"); trace.Status != walletsdk.PaymentConfirmed || len(trace.Txs) != 1 {
+		t.Fatalf("retried instruction traced as %+v", trace)
+	}
+	expectStake(t, owner, "poor", tokens(6))
+
+	// Nothing is paid twice
+	if _, err := netter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	expectStake(t, owner, "a", tokens(10))
+	expectStake(t, owner, "b", tokens(15))
+}
+
+func TestNetterDropsTransfers(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"a": tokens(10), "b": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+
+	// The netter stays usable while its transfers are settled
+	var netter *walletsdk.Netter
+	settler := walletsdk.NewSettler(owner, walletsdk.SettlementOptions{
+		OnSigned: func(p walletsdk.Payment, _ *types.Transaction) error {
+			return netter.Add(walletsdk.Payment{ID: "during-" + p.ID, Creator: "a", Solver: "b", Amount: tokens(1)})
+		},
+	})
+	netter = walletsdk.NewNetter(settler, walletsdk.NettingOptions{MaxAttempts: 2})
+	for _, p := range []walletsdk.Payment{
+		{ID: "paid", Creator: "a", Solver: "b", Amount: tokens(2)},
+		{ID: "unfunded", Creator: "poor", Solver: "a", Amount: tokens(1)},
+	} {
+		if err := netter.Add(p); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	report, err := netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(report.Dropped) != 0 || netter.Pending() != 1 {
+		t.Fatalf("first window: dropped %d, buffered %d", len(report.Dropped), netter.Pending())
+	}
+	if trace, _ := netter.Trace("unfunded"); trace.Status != walletsdk.PaymentNotSent {
+		t.Fatalf("unfunded instruction traced as %s", trace.Status)
+	}
+
+	// The second failure uses up the attempts
+	report, err = netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Transfer.Payment.Creator != "poor" || report.Dropped[0].Result.Err == nil {
+		t.Fatalf("second window dropped %+v", report.Dropped)
+	}
+	if trace, _ := netter.Trace("unfunded"); trace.Status != walletsdk.PaymentDropped {
+		t.Fatalf("dropped instruction traced as %s", trace.Status)
+	}
+
+	report, err = netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	for _, result := range report.Results {
+		if result.Payment.Creator == "poor" {
+			t.Fatal("dropped transfer sent again")
+		}
+	}
+	expectStake(t, owner, "b", tokens(5))
+}
+
+func TestNetterDropsGroupLeg(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"a": tokens(10), "b": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	netter := walletsdk.NewNetter(walletsdk.NewSettler(owner, walletsdk.SettlementOptions{}),
+		walletsdk.NettingOptions{CancelCycles: true, MaxAttempts: 2})
+
+	// The cycle leaves a to b and b to c, and device c does not exist
+	for _, p := range []walletsdk.Payment{
+		{ID: "ab", Creator: "a", Solver: "b", Amount: tokens(5)},
+		{ID: "bc", Creator: "b", Solver: "c", Amount: tokens(3)},
+		{ID: "ca", Creator: "c", Solver: "a", Amount: tokens(1)},
+	} {
+		if err := netter.Add(p); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	report, err := netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(report.Transfers) != 2 || report.Transfers[0].Group != report.Transfers[1].Group {
+		t.Fatalf("transfers = %+v, want two in one group", report.Transfers)
+	}
+	legs := make(map[string]walletsdk.NetTransfer)
+	for _, transfer := range report.Transfers {
+		legs[transfer.Payment.Solver] = transfer
+	}
+
+	// The failing leg is dropped with its group, part of which is paid
+	report, err = netter.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(report.Dropped) != 1 {
+		t.Fatalf("second window dropped %+v", report.Dropped)
+	}
+	dropped := report.Dropped[0]
+	if dropped.Transfer.Payment.ID != legs["c"].Payment.ID || dropped.Transfer.Group != legs["b"].Group ||
+		len(dropped.Settled) != 1 || dropped.Settled[0] != legs["b"].Payment.ID {
+		t.Fatalf("dropped leg %+v, settled %v", dropped.Transfer, dropped.Settled)
+	}
+	for _, id := range []string{"ab", "bc", "ca"} {
+		if trace, _ := netter.Trace(id); trace.Status != walletsdk.PaymentDropped {
+			t.Errorf("instruction %s of a partly settled group traced as %s", id, trace.Status)
+		}
+	}
+	expectStake(t, owner, "b", tokens(5))
+}
@@ -0,0 +1,123 @@
+package walletsdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Network is a known deployment of the token and stake contracts
+type Network struct {
+	Name         string
+	ChainID      int64
+	TokenAddress common.Address
+	StakeAddress common.Address
+	// TokenStartBlock and StakeStartBlock are where indexers start looking
+	// for events, at or before the deployment blocks
+	TokenStartBlock uint64
+	StakeStartBlock uint64
+	// TokenCodeHash and StakeCodeHash are the expected runtime code hashes,
+	// checked by clients created for the network. Zero skips the check.
+	TokenCodeHash common.Hash
+	StakeCodeHash common.Hash
+}
+
+// networks holds the registered deployments. It starts empty: the SDK ships
+// no addresses it cannot verify, so applications register their own.
+var networks = struct {
+	sync.RWMutex
+	byName map[string]Network
+}{byName: map[string]Network{}}
+
+// RegisterNetwork adds a deployment, such as a private devnet, to the
+// registry. Names are unique and case-insensitive.
+func RegisterNetwork(network Network) error {
+	switch {
+	case network.Name == "":
+		return fmt.Errorf("network name is required")
+	case network.ChainID <= 0:
+		return fmt.Errorf("network %q: chain ID must be positive", network.Name)
+	case network.TokenAddress == (common.Address{}):
+		return fmt.Errorf("network %q: token address is required", network.Name)
+	}
+
+	networks.Lock()
+	defer networks.Unlock()
+	key := strings.ToLower(network.Name)
+	if _, ok := networks.byName[key]; ok {
+		return fmt.Errorf("network %q already registered", network.Name)
+	}
+	networks.byName[key] = network
+	return nil
+}
+
+// LookupNetwork returns the registered network with the given name
+func LookupNetwork(name string) (Network, bool) {
+	networks.RLock()
+	defer networks.RUnlock()
+	network, ok := networks.byName[strings.ToLower(name)]
+	return network, ok
+}
+
+// NetworksForChain returns the registered deployments on a chain, sorted by
+// name
+func NetworksForChain(chainID int64) []Network {
+	var found []Network
+	for _, network := range Networks() {
+		if network.ChainID == chainID {
+			found = append(found, network)
+		}
+	}
+	return found
+}
+
+// Networks returns every registered network sorted by name
+func Networks() []Network {
+	networks.RLock()
+	defer networks.RUnlock()
+	list := make([]Network, 0, len(networks.byName))
+	for _, network := range networks.byName {
+		list = append(list, network)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// networkNames lists the registered names for error messages
+func networkNames() string {
+	var names []string
+	for _, network := range Networks() {
+		names = append(names, network.Name)
+	}
+	if len(names) == 0 {
+		return "none registered"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Config returns a client configuration for the network that verifies the
+// chain and contracts on creation
+func (n Network) Config(rpcURL, privateKey string) ClientConfig {
+	return ClientConfig{
+		RPCURL:       rpcURL,
+		ChainID:      n.ChainID,
+		TokenAddress: n.TokenAddress,
+		StakeAddress: n.StakeAddress,
+		PrivateKey:   privateKey,
+		Verify:       &VerifyOptions{TokenCodeHash: n.TokenCodeHash, StakeCodeHash: n.StakeCodeHash},
+	}
+}
+
+// NewClientForNetwork creates a client for a registered network. signer is
+// the hex private key, or empty for a read-only client. The node's chain ID
+// and the contract code are checked before the client is returned.
+func NewClientForNetwork(name, rpcURL, signer string) (*Client, error) {
+	network, ok := LookupNetwork(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q, have %s", name, networkNames())
+	}
+	return NewClient(network.Config(rpcURL, signer))
+}
@@ -0,0 +1,94 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+func TestNewClientForNetwork(t *testing.T) {
+	chain := newChain(t)
+	codeHash := func(addr common.Address) common.Hash {
+		t.Helper()
+		code, err := chain.Backend.Client().CodeAt(context.Background(), addr, nil)
+		if err != nil {
+			t.Fatalf("CodeAt: %v", err)
+		}
+		return crypto.Keccak256Hash(code)
+	}
+	network := walletsdk.Network{
+		Name:          "sim-" + chain.TokenAddress.Hex(),
+		ChainID:       simulated.ChainID,
+		TokenAddress:  chain.TokenAddress,
+		StakeAddress:  chain.StakeAddress,
+		TokenCodeHash: codeHash(chain.TokenAddress),
+		StakeCodeHash: codeHash(chain.StakeAddress),
+	}
+	if err := walletsdk.RegisterNetwork(network); err != nil {
+		t.Fatalf("RegisterNetwork: %v", err)
+	}
+	if err := walletsdk.RegisterNetwork(network); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("duplicate registration not rejected: %v", err)
+	}
+
+	client, err := walletsdk.NewClientForNetwork(network.Name, chain.RPCURL(), chain.Accounts[0].PrivateKeyHex())
+	if err != nil {
+		t.Fatalf("NewClientForNetwork: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Transfer(chain.Accounts[1].Address, tokens(1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	// A deployment with other code is refused
+	other := network
+	other.Name += "-other"
+	other.StakeCodeHash = common.Hash{1}
+	if err := walletsdk.RegisterNetwork(other); err != nil {
+		t.Fatalf("RegisterNetwork: %v", err)
+	}
+	_, err = walletsdk.NewClientForNetwork(other.Name, chain.RPCURL(), "")
+	var verifyErr *walletsdk.VerificationError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+
+	if _, err := walletsdk.NewClientForNetwork("nowhere", chain.RPCURL(), ""); err == nil || !strings.Contains(err.Error(), `unknown network "nowhere"`) {
+		t.Fatalf("unknown network not rejected: %v", err)
+	}
+}
+
+func TestConfigNetwork(t *testing.T) {
+	devnet := walletsdk.Network{
+		Name:         "config-devnet",
+		ChainID:      31337,
+		TokenAddress: common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3"),
+		StakeAddress: common.HexToAddress("0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"),
+	}
+	if err := walletsdk.RegisterNetwork(devnet); err != nil {
+		t.Fatalf("RegisterNetwork: %v", err)
+	}
+
+	data := "profiles:\n  local:\n    network: config-devnet\n    rpc_url: http://localhost:8545\n"
+	config, err := walletsdk.ParseConfig([]byte(data), walletsdk.FormatYAML, walletsdk.LoadOptions{LookupEnv: envOf(nil)})
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if config.ChainID != devnet.ChainID || config.TokenAddress != devnet.TokenAddress ||
+		config.StakeAddress != devnet.StakeAddress || config.Verify == nil {
+		t.Errorf("network not applied: %+v", config)
+	}
+
+	_, err = walletsdk.ParseConfig([]byte(data), walletsdk.FormatYAML,
+		walletsdk.LoadOptions{LookupEnv: envOf(map[string]string{"PARITY_CHAIN_ID": "1"})})
+	if err == nil || !strings.Contains(err.Error(), `PARITY_CHAIN_ID: 1 differs from chain 31337 of network "config-devnet"`) {
+		t.Errorf("chain mismatch not reported: %v", err)
+	}
+}
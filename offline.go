@@ -0,0 +1,493 @@
+package walletsdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// BundleVersion is the version of the offline bundle format written by this SDK
+const BundleVersion = 1
+
+// Contract names used in call intents
+const (
+	ContractParityToken = "ParityToken"
+	ContractStakeWallet = "StakeWallet"
+)
+
+// CallArg is a single decoded argument of a contract call
+type CallArg struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// CallIntent is the human readable form of a contract call
+type CallIntent struct {
+	Contract string    `json:"contract"`
+	Method   string    `json:"method"`
+	Args     []CallArg `json:"args"`
+}
+
+// String renders the intent as a single line, e.g. ParityToken.transfer(to=0x.., value=1)
+func (i *CallIntent) String() string {
+	args := make([]string, len(i.Args))
+	for n, arg := range i.Args {
+		args[n] = arg.Name + "=" + arg.Value
+	}
+	return fmt.Sprintf("%s.%s(%s)", i.Contract, i.Method, strings.Join(args, ", "))
+}
+
+// UnsignedBundle is a portable, reviewable description of a transaction that
+// still has to be signed. It is produced on an online machine and signed on an
+// offline one.
+type UnsignedBundle struct {
+	Version   int            `json:"version"`
+	ChainID   *big.Int       `json:"chainId"`
+	From      common.Address `json:"from"`
+	To        common.Address `json:"to"`
+	Nonce     uint64         `json:"nonce"`
+	Gas       uint64         `json:"gas"`
+	GasPrice  *big.Int       `json:"gasPrice,omitempty"`
+	GasTipCap *big.Int       `json:"maxPriorityFeePerGas,omitempty"`
+	GasFeeCap *big.Int       `json:"maxFeePerGas,omitempty"`
+	Value     *big.Int       `json:"value"`
+	Data      hexutil.Bytes  `json:"data"`
+	Intent    *CallIntent    `json:"intent"`
+}
+
+// SignedBundle is an UnsignedBundle together with its signed RLP encoding
+type SignedBundle struct {
+	UnsignedBundle
+	Hash  common.Hash   `json:"hash"`
+	RawTx hexutil.Bytes `json:"rawTransaction"`
+}
+
+// OfflineOptions controls how an unsigned bundle is built. Zero values are
+// filled in from the node.
+type OfflineOptions struct {
+	From      common.Address
+	Nonce     *uint64
+	GasLimit  uint64
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+}
+
+// offlineTransactOpts returns transaction options that resolve nonce, fees and
+// gas against the node but return the transaction unsigned and unsent
+func (c *Client) offlineTransactOpts(options OfflineOptions) (*bind.TransactOpts, error) {
+	if options.From == (common.Address{}) {
+		return nil, fmt.Errorf("offline bundle requires a sender address")
+	}
+	opts := &bind.TransactOpts{
+		From: options.From,
+		Signer: func(_ common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return tx, nil
+		},
+		GasLimit:  options.GasLimit,
+		GasPrice:  options.GasPrice,
+		GasTipCap: options.GasTipCap,
+		GasFeeCap: options.GasFeeCap,
+		NoSend:    true,
+	}
+	if options.Nonce != nil {
+		opts.Nonce = new(big.Int).SetUint64(*options.Nonce)
+	}
+	return opts, nil
+}
+
+// BuildUnsigned builds an unsigned bundle for an arbitrary write on the token
+// or stake contract, e.g. BuildUnsigned(opts, ContractParityToken, "mint", to, amount)
+func (c *Client) BuildUnsigned(options OfflineOptions, contract string, method string, args ...interface{}) (*UnsignedBundle, error) {
+	opts, err := c.offlineTransactOpts(options)
+	if err != nil {
+		return nil, err
+	}
+
+	bound, err := c.boundContract(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := bound.Transact(opts, method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s.%s: %w", contract, method, err)
+	}
+	return NewUnsignedBundle(tx, options.From, c.chainID, contract)
+}
+
+// boundContract returns the binding used to transact with the named contract
+func (c *Client) boundContract(contract string) (*bind.BoundContract, error) {
+	switch contract {
+	case ContractParityToken:
+		return c.token.ParityTokenTransactor.contract, nil
+	case ContractStakeWallet:
+		if c.stakeWallet == nil {
+			return nil, fmt.Errorf("stake wallet not initialized")
+		}
+		return c.stakeWallet.contract.StakeWalletContractTransactor.contract, nil
+	default:
+		return nil, fmt.Errorf("unknown contract %q", contract)
+	}
+}
+
+// BuildUnsignedTransfer builds an unsigned bundle for a token transfer
+func (c *Client) BuildUnsignedTransfer(options OfflineOptions, to common.Address, amount *big.Int) (*UnsignedBundle, error) {
+	return c.BuildUnsigned(options, ContractParityToken, "transfer", to, amount)
+}
+
+// BuildUnsignedMint builds an unsigned bundle for minting tokens
+func (c *Client) BuildUnsignedMint(options OfflineOptions, to common.Address, amount *big.Int) (*UnsignedBundle, error) {
+	return c.BuildUnsigned(options, ContractParityToken, "mint", to, amount)
+}
+
+// BuildUnsignedAddFunds builds an unsigned bundle for adding funds to a device.
+// The stake contract must already be approved to spend amount, so a matching
+// approve bundle is normally built and signed first.
+func (c *Client) BuildUnsignedAddFunds(options OfflineOptions, amount *big.Int, deviceID string, walletAddress common.Address) (*UnsignedBundle, error) {
+	return c.BuildUnsigned(options, ContractStakeWallet, "addFunds", amount, deviceID, walletAddress)
+}
+
+// BuildUnsignedRecoverTokens builds an unsigned bundle for recovering tokens
+// held by the stake contract
+func (c *Client) BuildUnsignedRecoverTokens(options OfflineOptions, tokenAddress common.Address, amount *big.Int) (*UnsignedBundle, error) {
+	return c.BuildUnsigned(options, ContractStakeWallet, "recoverTokens", tokenAddress, amount)
+}
+
+// BroadcastSigned sends a signed bundle produced by SignBundle. The
+// transaction must call the bundle's contract at the client's address for it,
+// and it is checked against the client policy, which SignBundle cannot apply
+// offline.
+func (c *Client) BroadcastSigned(signed *SignedBundle) (*types.Transaction, error) {
+	tx, err := signed.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	if tx.ChainId().Cmp(c.chainID) != 0 {
+		return nil, fmt.Errorf("bundle chain ID %v does not match client chain ID %v", tx.ChainId(), c.chainID)
+	}
+	if contract := c.contractName(signed.To); contract != signed.Intent.Contract {
+		return nil, fmt.Errorf("bundle for %s is sent to %s, which is not the client's %s", signed.Intent.Contract, signed.To.Hex(), signed.Intent.Contract)
+	}
+	if c.policy != nil {
+		req, err := c.policyRequest(signed.From, tx)
+		if err != nil {
+			c.policy.report(req, err)
+			return nil, err
+		}
+		record, err := c.policy.reserve(req)
+		if err != nil {
+			return nil, err
+		}
+		c.policy.signed(record, tx.Hash())
+	}
+	if err := c.SendTransaction(context.Background(), tx); err != nil {
+		return nil, fmt.Errorf("failed to broadcast transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// NewUnsignedBundle describes an unsigned transaction to the named contract as
+// a bundle, decoding its calldata into a call intent
+func NewUnsignedBundle(tx *types.Transaction, from common.Address, chainID *big.Int, contract string) (*UnsignedBundle, error) {
+	if tx.To() == nil {
+		return nil, fmt.Errorf("contract creation is not supported in offline bundles")
+	}
+	intent, err := DecodeCallIntent(contract, tx.Data())
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &UnsignedBundle{
+		Version: BundleVersion,
+		ChainID: new(big.Int).Set(chainID),
+		From:    from,
+		To:      *tx.To(),
+		Nonce:   tx.Nonce(),
+		Gas:     tx.Gas(),
+		Value:   tx.Value(),
+		Data:    tx.Data(),
+		Intent:  intent,
+	}
+	if tx.Type() == types.LegacyTxType {
+		bundle.GasPrice = tx.GasPrice()
+	} else {
+		bundle.GasTipCap = tx.GasTipCap()
+		bundle.GasFeeCap = tx.GasFeeCap()
+	}
+	return bundle, nil
+}
+
+// contractABI returns the parsed ABI of a known contract
+func contractABI(contract string) (abi.ABI, error) {
+	switch contract {
+	case ContractParityToken:
+		return abi.JSON(strings.NewReader(ParityTokenABI))
+	case ContractStakeWallet:
+		return abi.JSON(strings.NewReader(StakeWalletContractABI))
+	default:
+		return abi.ABI{}, fmt.Errorf("unknown contract %q", contract)
+	}
+}
+
+// decodeCall unpacks calldata for the named contract
+func decodeCall(contract string, data []byte) (*abi.Method, []interface{}, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("calldata too short")
+	}
+	parsed, err := contractABI(contract)
+	if err != nil {
+		return nil, nil, err
+	}
+	method, err := parsed.MethodById(data[:4])
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown %s method: %w", contract, err)
+	}
+	values, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode %s arguments: %w", method.Name, err)
+	}
+	return method, values, nil
+}
+
+// DecodeCallIntent decodes calldata for the named contract into a human
+// readable call intent
+func DecodeCallIntent(contract string, data []byte) (*CallIntent, error) {
+	method, values, err := decodeCall(contract, data)
+	if err != nil {
+		return nil, err
+	}
+
+	intent := &CallIntent{Contract: contract, Method: method.Name, Args: make([]CallArg, len(values))}
+	for i, value := range values {
+		intent.Args[i] = CallArg{
+			Name:  method.Inputs[i].Name,
+			Type:  method.Inputs[i].Type.String(),
+			Value: formatArg(value),
+		}
+	}
+	return intent, nil
+}
+
+// formatArg renders a decoded ABI value for human review
+func formatArg(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Verify checks that the bundle is well formed and that its intent matches
+// the calldata, so a reviewer can trust the decoded form. Bundles move no
+// ether. The destination can only be checked against known contract
+// addresses, which VerifyFor and BroadcastSigned do.
+func (b *UnsignedBundle) Verify() error {
+	if b.Version != BundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if b.ChainID == nil || b.ChainID.Sign() <= 0 {
+		return fmt.Errorf("bundle has no chain ID")
+	}
+	if b.Intent == nil {
+		return fmt.Errorf("bundle has no intent")
+	}
+	if b.GasPrice == nil && (b.GasTipCap == nil || b.GasFeeCap == nil) {
+		return fmt.Errorf("bundle has no fees")
+	}
+	if b.Value != nil && b.Value.Sign() != 0 {
+		return fmt.Errorf("bundle sends %s wei, contract calls send none", b.Value)
+	}
+
+	decoded, err := DecodeCallIntent(b.Intent.Contract, b.Data)
+	if err != nil {
+		return err
+	}
+	if decoded.String() != b.Intent.String() {
+		return fmt.Errorf("bundle intent %s does not match calldata %s", b.Intent, decoded)
+	}
+	return nil
+}
+
+// VerifyFor verifies the bundle and checks that it is sent to the intent's
+// contract of network on its chain
+func (b *UnsignedBundle) VerifyFor(network Network) error {
+	if err := b.Verify(); err != nil {
+		return err
+	}
+	if !b.ChainID.IsInt64() || b.ChainID.Int64() != network.ChainID {
+		return fmt.Errorf("bundle chain ID %v does not match network %s", b.ChainID, network.Name)
+	}
+	want := network.TokenAddress
+	if b.Intent.Contract == ContractStakeWallet {
+		want = network.StakeAddress
+	}
+	if b.To != want {
+		return fmt.Errorf("bundle is sent to %s, not the %s of network %s at %s", b.To.Hex(), b.Intent.Contract, network.Name, want.Hex())
+	}
+	return nil
+}
+
+// Transaction returns the unsigned transaction described by the bundle
+func (b *UnsignedBundle) Transaction() *types.Transaction {
+	to := b.To
+	value := b.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	if b.GasPrice != nil {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    b.Nonce,
+			GasPrice: b.GasPrice,
+			Gas:      b.Gas,
+			To:       &to,
+			Value:    value,
+			Data:     b.Data,
+		})
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   b.ChainID,
+		Nonce:     b.Nonce,
+		GasTipCap: b.GasTipCap,
+		GasFeeCap: b.GasFeeCap,
+		Gas:       b.Gas,
+		To:        &to,
+		Value:     value,
+		Data:      b.Data,
+	})
+}
+
+// SignBundle signs a verified bundle with the given key. It does not need
+// network access and is intended to run on the offline machine.
+func SignBundle(bundle *UnsignedBundle, key *ecdsa.PrivateKey) (*SignedBundle, error) {
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+	if signer := crypto.PubkeyToAddress(key.PublicKey); signer != bundle.From {
+		return nil, fmt.Errorf("key for %s cannot sign bundle from %s", signer.Hex(), bundle.From.Hex())
+	}
+
+	tx, err := types.SignTx(bundle.Transaction(), types.LatestSignerForChainID(bundle.ChainID), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignedBundle{UnsignedBundle: *bundle, Hash: tx.Hash(), RawTx: raw}, nil
+}
+
+// Transaction decodes the signed transaction and checks it against the bundle.
+// The bundle is verified and the signed transaction must be the one it
+// describes, so the reviewed intent is what gets broadcast.
+func (s *SignedBundle) Transaction() (*types.Transaction, error) {
+	if err := s.UnsignedBundle.Verify(); err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(s.RawTx); err != nil {
+		return nil, fmt.Errorf("invalid signed transaction: %w", err)
+	}
+	if tx.Hash() != s.Hash {
+		return nil, fmt.Errorf("signed transaction hash %s does not match bundle hash %s", tx.Hash().Hex(), s.Hash.Hex())
+	}
+	if err := matchTransaction(s.UnsignedBundle.Transaction(), tx); err != nil {
+		return nil, fmt.Errorf("signed transaction does not match bundle: %w", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender: %w", err)
+	}
+	if sender != s.From {
+		return nil, fmt.Errorf("transaction signed by %s, bundle expects %s", sender.Hex(), s.From.Hex())
+	}
+	return tx, nil
+}
+
+// matchTransaction compares the fields of a signed transaction with the
+// unsigned one it should have been made from
+func matchTransaction(want, got *types.Transaction) error {
+	switch {
+	case got.Type() != want.Type():
+		return fmt.Errorf("type %d, want %d", got.Type(), want.Type())
+	case got.To() == nil || *got.To() != *want.To():
+		return fmt.Errorf("to %v, want %s", got.To(), want.To().Hex())
+	case !bytes.Equal(got.Data(), want.Data()):
+		return fmt.Errorf("calldata differs")
+	case got.Value().Cmp(want.Value()) != 0:
+		return fmt.Errorf("value %s, want %s", got.Value(), want.Value())
+	case got.Nonce() != want.Nonce():
+		return fmt.Errorf("nonce %d, want %d", got.Nonce(), want.Nonce())
+	case got.Gas() != want.Gas():
+		return fmt.Errorf("gas %d, want %d", got.Gas(), want.Gas())
+	case got.GasPrice().Cmp(want.GasPrice()) != 0:
+		return fmt.Errorf("gas price %s, want %s", got.GasPrice(), want.GasPrice())
+	case got.GasTipCap().Cmp(want.GasTipCap()) != 0:
+		return fmt.Errorf("tip cap %s, want %s", got.GasTipCap(), want.GasTipCap())
+	case got.GasFeeCap().Cmp(want.GasFeeCap()) != 0:
+		return fmt.Errorf("fee cap %s, want %s", got.GasFeeCap(), want.GasFeeCap())
+	}
+	return nil
+}
+
+// SignBundleFile reads an unsigned bundle from inPath, signs it with the hex
+// encoded private key and writes the signed bundle to outPath
+func SignBundleFile(inPath, outPath, privateKey string) error {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	var bundle UnsignedBundle
+	if err := ReadBundle(inPath, &bundle); err != nil {
+		return err
+	}
+	signed, err := SignBundle(&bundle, key)
+	if err != nil {
+		return err
+	}
+	return WriteBundle(outPath, signed)
+}
+
+// WriteBundle writes an unsigned or signed bundle as indented JSON
+func WriteBundle(path string, bundle interface{}) error {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// ReadBundle reads an unsigned or signed bundle written by WriteBundle
+func ReadBundle(path string, bundle interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return fmt.Errorf("failed to decode bundle: %w", err)
+	}
+	return nil
+}
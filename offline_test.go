@@ -0,0 +1,209 @@
+package walletsdk_test
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+func TestSignBundleOffline(t *testing.T) {
+	alice, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(alice.PublicKey)
+	token := common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3")
+	bob := common.HexToAddress("0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB")
+
+	parsed, err := abi.JSON(strings.NewReader(walletsdk.ParityTokenABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Pack("transfer", bob, big.NewInt(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     7,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Gas:       60000,
+		To:        &token,
+		Value:     new(big.Int),
+		Data:      data,
+	})
+	bundle, err := walletsdk.NewUnsignedBundle(tx, from, big.NewInt(1337), walletsdk.ContractParityToken)
+	if err != nil {
+		t.Fatalf("NewUnsignedBundle: %v", err)
+	}
+	if got, want := bundle.Intent.String(), "ParityToken.transfer(to="+bob.Hex()+", value=25)"; got != want {
+		t.Fatalf("Intent = %s, want %s", got, want)
+	}
+
+	dir := t.TempDir()
+	unsignedPath := filepath.Join(dir, "unsigned.json")
+	signedPath := filepath.Join(dir, "signed.json")
+	if err := walletsdk.WriteBundle(unsignedPath, bundle); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	if err := walletsdk.SignBundleFile(unsignedPath, signedPath, hexutil.Encode(crypto.FromECDSA(mallory))); err == nil {
+		t.Fatal("SignBundleFile accepted a key for the wrong sender")
+	}
+	if err := walletsdk.SignBundleFile(unsignedPath, signedPath, hexutil.Encode(crypto.FromECDSA(alice))); err != nil {
+		t.Fatalf("SignBundleFile: %v", err)
+	}
+
+	var signed walletsdk.SignedBundle
+	if err := walletsdk.ReadBundle(signedPath, &signed); err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	decoded, err := signed.Transaction()
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+	if decoded.Nonce() != 7 || *decoded.To() != token || decoded.Hash() != signed.Hash {
+		t.Fatalf("signed transaction does not match the bundle: %+v", decoded)
+	}
+
+	// A transaction signed by another key is refused
+	other, err := types.SignTx(bundle.Transaction(), types.LatestSignerForChainID(bundle.ChainID), mallory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := other.MarshalBinary()
+	swapped := signed
+	swapped.RawTx, swapped.Hash = raw, other.Hash()
+	if _, err := swapped.Transaction(); err == nil {
+		t.Fatal("transaction signed by another key accepted")
+	}
+
+	// So is an intent that no longer matches the calldata
+	bundle.Intent.Args[1].Value = "1000"
+	if _, err := walletsdk.SignBundle(bundle, alice); err == nil {
+		t.Fatal("SignBundle signed a tampered bundle")
+	}
+}
+
+func TestOfflineBundleRoundTrip(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+
+	// The online client only needs the sender address
+	online := newClient(t, chain, chain.Owner)
+	bundle, err := online.BuildUnsignedTransfer(walletsdk.OfflineOptions{From: alice.Address}, bob.Address, tokens(25))
+	if err != nil {
+		t.Fatalf("BuildUnsignedTransfer: %v", err)
+	}
+	if got := bundle.Intent.String(); !strings.HasPrefix(got, "ParityToken.transfer(") {
+		t.Fatalf("Intent = %s", got)
+	}
+
+	dir := t.TempDir()
+	unsignedPath := filepath.Join(dir, "unsigned.json")
+	signedPath := filepath.Join(dir, "signed.json")
+	if err := walletsdk.WriteBundle(unsignedPath, bundle); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	if err := walletsdk.SignBundleFile(unsignedPath, signedPath, chain.Owner.PrivateKeyHex()); err == nil {
+		t.Fatal("SignBundleFile accepted a key for the wrong sender")
+	}
+	if err := walletsdk.SignBundleFile(unsignedPath, signedPath, alice.PrivateKeyHex()); err != nil {
+		t.Fatalf("SignBundleFile: %v", err)
+	}
+
+	var signed walletsdk.SignedBundle
+	if err := walletsdk.ReadBundle(signedPath, &signed); err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	tx, err := online.BroadcastSigned(&signed)
+	mined(t, chain, tx, err)
+	expectBalance(t, online, tokens(1025), bob)
+}
+
+func TestOfflineBundleTamperedIntent(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	bundle, err := client.BuildUnsignedTransfer(walletsdk.OfflineOptions{From: alice.Address}, bob.Address, tokens(1))
+	if err != nil {
+		t.Fatalf("BuildUnsignedTransfer: %v", err)
+	}
+	bundle.Intent.Args[1].Value = tokens(1000).String()
+	if err := bundle.Verify(); err == nil {
+		t.Fatal("Verify accepted an intent that does not match the calldata")
+	}
+	if _, err := walletsdk.SignBundle(bundle, alice.Key); err == nil {
+		t.Fatal("SignBundle signed a tampered bundle")
+	}
+}
+
+func TestOfflineBundleTamperedPayload(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, chain.Owner)
+	sign := func(amount int64, edit func(*walletsdk.UnsignedBundle)) *walletsdk.SignedBundle {
+		t.Helper()
+		bundle, err := client.BuildUnsignedTransfer(walletsdk.OfflineOptions{From: alice.Address}, bob.Address, tokens(amount))
+		if err != nil {
+			t.Fatalf("BuildUnsignedTransfer: %v", err)
+		}
+		edit(bundle)
+		signed, err := walletsdk.SignBundle(bundle, alice.Key)
+		if err != nil {
+			t.Fatalf("SignBundle: %v", err)
+		}
+		return signed
+	}
+	keep := func(*walletsdk.UnsignedBundle) {}
+
+	// The reviewed bundle shows 1 token, the payload pays 1000
+	shown, paid := sign(1, keep), sign(1000, keep)
+	shown.RawTx, shown.Hash = paid.RawTx, paid.Hash
+	if _, err := client.BroadcastSigned(shown); err == nil {
+		t.Error("broadcast a payload that differs from the bundle")
+	}
+
+	elsewhere := sign(1, func(b *walletsdk.UnsignedBundle) { b.To = bob.Address })
+	if _, err := client.BroadcastSigned(elsewhere); err == nil {
+		t.Error("broadcast a transfer to another contract")
+	}
+
+	bundle, err := client.BuildUnsignedTransfer(walletsdk.OfflineOptions{From: alice.Address}, bob.Address, tokens(1))
+	if err != nil {
+		t.Fatalf("BuildUnsignedTransfer: %v", err)
+	}
+	network := walletsdk.Network{Name: "sim", ChainID: simulated.ChainID, TokenAddress: chain.TokenAddress, StakeAddress: chain.StakeAddress}
+	if err := bundle.VerifyFor(network); err != nil {
+		t.Errorf("VerifyFor: %v", err)
+	}
+	network.TokenAddress = bob.Address
+	if err := bundle.VerifyFor(network); err == nil {
+		t.Error("VerifyFor accepted a bundle for another token")
+	}
+	bundle.Value = tokens(1)
+	if err := bundle.Verify(); err == nil {
+		t.Error("Verify accepted a bundle sending ether")
+	}
+
+	// Offline signing cannot apply the policy, so broadcasting does
+	client.SetPolicy(&walletsdk.Policy{Denylist: []common.Address{bob.Address}})
+	if _, err := client.BroadcastSigned(sign(1, keep)); err == nil {
+		t.Error("broadcast a transfer the policy denies")
+	}
+}
@@ -0,0 +1,379 @@
+package walletsdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Outbox entry states
+const (
+	// OutboxPending entries were recorded but not signed yet
+	OutboxPending = "pending"
+	// OutboxSigned entries were signed and may have been broadcast
+	OutboxSigned = "signed"
+	// OutboxConfirmed entries were mined successfully
+	OutboxConfirmed = "confirmed"
+	// OutboxReverted entries were mined and reverted
+	OutboxReverted = "reverted"
+	// OutboxFailed entries could not be signed, or their nonce was
+	// confirmed for another transaction. Nothing was mined, so submitting
+	// the key again retries them.
+	OutboxFailed = "failed"
+)
+
+// OutboxEntry is one operation recorded in an outbox under its idempotency
+// key
+type OutboxEntry struct {
+	Key      string         `json:"key"`
+	Contract string         `json:"contract"`
+	Method   string         `json:"method"`
+	Data     hexutil.Bytes  `json:"data"`
+	Intent   *CallIntent    `json:"intent,omitempty"`
+	Status   string         `json:"status"`
+	From     common.Address `json:"from"`
+	Nonce    uint64         `json:"nonce"`
+	// Tx is the signed transaction, stored before it is broadcast
+	Tx      *types.Transaction `json:"tx,omitempty"`
+	Block   uint64             `json:"block,omitempty"`
+	Error   string             `json:"error,omitempty"`
+	Created time.Time          `json:"created"`
+	Updated time.Time          `json:"updated"`
+}
+
+// final reports whether the entry was mined
+func (e *OutboxEntry) final() bool {
+	return e.Status == OutboxConfirmed || e.Status == OutboxReverted
+}
+
+// OutboxStore persists outbox entries across restarts
+type OutboxStore interface {
+	// Save durably stores the latest state of the entry
+	Save(entry *OutboxEntry) error
+	// Load returns the latest state of every saved entry
+	Load() ([]OutboxEntry, error)
+}
+
+// Outbox records every operation under a caller-supplied idempotency key
+// before signing it, and the signed transaction before broadcasting it. A
+// key submitted again returns its existing transaction, and Recover
+// finishes what a crashed process left behind, so an operation is carried
+// out at most once.
+type Outbox struct {
+	client *Client
+	store  OutboxStore
+
+	// mu serializes submissions, which share the account nonce
+	mu      sync.Mutex
+	entries map[string]*OutboxEntry
+}
+
+// NewOutbox returns an outbox signing with client and loads the entries
+// saved in store. Call Recover to finish the entries left unmined.
+func NewOutbox(client *Client, store OutboxStore) (*Outbox, error) {
+	saved, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %w", err)
+	}
+	o := &Outbox{client: client, store: store, entries: make(map[string]*OutboxEntry, len(saved))}
+	for i := range saved {
+		o.entries[saved[i].Key] = &saved[i]
+	}
+	return o, nil
+}
+
+// Submit records a call of method on the named SDK contract under key, then
+// signs and broadcasts it without waiting for it to be mined. Submitting a
+// key again with the same call returns its transaction instead of sending
+// another, and fails if the key was used for a different call.
+func (o *Outbox) Submit(ctx context.Context, key, contract, method string, args ...interface{}) (*types.Transaction, error) {
+	if key == "" {
+		return nil, fmt.Errorf("idempotency key is required")
+	}
+	parsed, err := contractABI(contract)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s.%s: %w", contract, method, err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[key]
+	if !ok {
+		now := time.Now().UTC()
+		entry = &OutboxEntry{
+			Key:      key,
+			Contract: contract,
+			Method:   method,
+			Data:     data,
+			Status:   OutboxPending,
+			From:     o.client.address,
+			Created:  now,
+			Updated:  now,
+		}
+		entry.Intent, _ = DecodeCallIntent(contract, data)
+		if err := o.store.Save(entry); err != nil {
+			return nil, fmt.Errorf("failed to save outbox entry: %w", err)
+		}
+		o.entries[key] = entry
+		return o.send(ctx, entry)
+	}
+
+	if entry.Contract != contract || !bytes.Equal(entry.Data, data) {
+		return nil, fmt.Errorf("idempotency key %s was used for %s.%s", key, entry.Contract, entry.Method)
+	}
+	return o.process(ctx, entry)
+}
+
+// TransferPayment submits a TransferPayment under key
+func (o *Outbox) TransferPayment(ctx context.Context, key, creatorDeviceID, solverDeviceID string, amount *big.Int) (*types.Transaction, error) {
+	return o.Submit(ctx, key, ContractStakeWallet, "transferPayment", creatorDeviceID, solverDeviceID, amount)
+}
+
+// Recover finishes every entry that is not mined: pending entries are signed
+// and sent, and signed ones are reconciled against their receipt or
+// broadcast again. Signed entries go first, in nonce order. It returns the
+// state of every entry it touched.
+func (o *Outbox) Recover(ctx context.Context) ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var open []*OutboxEntry
+	for _, entry := range o.entries {
+		if entry.Status == OutboxPending || entry.Status == OutboxSigned {
+			open = append(open, entry)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		a, b := open[i], open[j]
+		if (a.Status == OutboxSigned) != (b.Status == OutboxSigned) {
+			return a.Status == OutboxSigned
+		}
+		if a.Status == OutboxSigned {
+			return a.Nonce < b.Nonce
+		}
+		return a.Created.Before(b.Created)
+	})
+
+	var errs []error
+	recovered := make([]OutboxEntry, 0, len(open))
+	for _, entry := range open {
+		if _, err := o.process(ctx, entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Key, err))
+		}
+		recovered = append(recovered, *entry)
+	}
+	if len(open) > 0 {
+		o.client.logger.Info("outbox recovered", "entries", len(open), "errors", len(errs))
+	}
+	return recovered, errors.Join(errs...)
+}
+
+// Wait waits until the transaction of key is mined or ctx ends and returns
+// the entry
+func (o *Outbox) Wait(ctx context.Context, key string) (OutboxEntry, error) {
+	o.mu.Lock()
+	entry, ok := o.entries[key]
+	if !ok {
+		o.mu.Unlock()
+		return OutboxEntry{}, fmt.Errorf("unknown idempotency key %s", key)
+	}
+	if entry.final() || entry.Tx == nil {
+		defer o.mu.Unlock()
+		return *entry, nil
+	}
+	tx := entry.Tx
+	o.mu.Unlock()
+
+	receipt, err := bind.WaitMined(ctx, o.client, tx)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if entry.Tx == nil || entry.Tx.Hash() != tx.Hash() {
+		return *entry, nil
+	}
+	err = o.finish(entry, receipt)
+	return *entry, err
+}
+
+// Entry returns the entry recorded under key
+func (o *Outbox) Entry(key string) (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entry, ok := o.entries[key]
+	if !ok {
+		return OutboxEntry{}, false
+	}
+	return *entry, true
+}
+
+// process moves an existing entry forward from its current state
+func (o *Outbox) process(ctx context.Context, entry *OutboxEntry) (*types.Transaction, error) {
+	switch entry.Status {
+	case OutboxPending, OutboxFailed:
+		return o.send(ctx, entry)
+	case OutboxSigned:
+		return entry.Tx, o.resume(ctx, entry)
+	default:
+		return entry.Tx, nil
+	}
+}
+
+// send signs the entry at the pending nonce, saves the signed transaction
+// and broadcasts it
+func (o *Outbox) send(ctx context.Context, entry *OutboxEntry) (*types.Transaction, error) {
+	contract, err := o.client.boundContract(entry.Contract)
+	if err != nil {
+		return nil, err
+	}
+	base, err := o.client.GetTransactOpts()
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status == OutboxFailed && entry.From != (common.Address{}) {
+		// The nonce it was signed with went to another transaction
+		o.client.metrics.Add(MetricNonceResyncs, 1, map[string]string{"source": "outbox"})
+	}
+	nonce, err := o.client.PendingNonceAt(ctx, base.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	opts := *base
+	opts.Context = ctx
+	opts.Nonce = new(big.Int).SetUint64(nonce)
+	opts.NoSend = true
+
+	tx, err := contract.RawTransact(&opts, entry.Data)
+	if err != nil {
+		if saveErr := o.update(entry, func(e *OutboxEntry) { e.Status, e.Error = OutboxFailed, err.Error() }); saveErr != nil {
+			return nil, errors.Join(err, saveErr)
+		}
+		return nil, err
+	}
+	// Saved before broadcasting, so a crash cannot lose a sent transaction
+	if err := o.update(entry, func(e *OutboxEntry) {
+		e.Status, e.From, e.Nonce, e.Tx, e.Error = OutboxSigned, base.From, nonce, tx, ""
+	}); err != nil {
+		return nil, err
+	}
+	return tx, o.broadcast(ctx, entry)
+}
+
+// resume reconciles a signed entry with its receipt, broadcasting it again
+// if the node does not know it
+func (o *Outbox) resume(ctx context.Context, entry *OutboxEntry) error {
+	receipt, err := o.client.TransactionReceipt(ctx, entry.Tx.Hash())
+	if err == nil {
+		return o.finish(entry, receipt)
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("failed to get receipt: %w", err)
+	}
+	return o.broadcast(ctx, entry)
+}
+
+// broadcast sends the signed transaction of the entry. Errors leave the
+// entry signed so it is sent again later, unless its nonce was confirmed for
+// another transaction.
+func (o *Outbox) broadcast(ctx context.Context, entry *OutboxEntry) error {
+	tx := entry.Tx
+	err := o.client.SendTransaction(ctx, tx)
+	switch {
+	case err == nil, isAlreadyKnown(err):
+		return nil
+	case isNonceError(err):
+		// Either this transaction was mined already or another one took
+		// its nonce. Only a confirmed nonce past this one and a node that
+		// answers it has no receipt prove it can never be mined.
+		receipt, receiptErr := o.client.TransactionReceipt(ctx, tx.Hash())
+		switch {
+		case receiptErr == nil:
+			return o.finish(entry, receipt)
+		case !errors.Is(receiptErr, ethereum.NotFound):
+			return errors.Join(err, fmt.Errorf("failed to get receipt: %w", receiptErr))
+		case !isNonceTooLow(err):
+			return fmt.Errorf("nonce %d is not final yet: %w", tx.Nonce(), err)
+		}
+		failure := fmt.Errorf("nonce %d was used by another transaction: %w", tx.Nonce(), err)
+		if saveErr := o.update(entry, func(e *OutboxEntry) { e.Status, e.Tx, e.Error = OutboxFailed, nil, failure.Error() }); saveErr != nil {
+			return errors.Join(failure, saveErr)
+		}
+		return failure
+	default:
+		// A lost response may hide a successful broadcast
+		if _, _, lookupErr := o.client.TransactionByHash(ctx, tx.Hash()); lookupErr == nil {
+			return nil
+		}
+		return err
+	}
+}
+
+// finish records the receipt of a mined entry
+func (o *Outbox) finish(entry *OutboxEntry, receipt *types.Receipt) error {
+	status := OutboxConfirmed
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = OutboxReverted
+	}
+	return o.update(entry, func(e *OutboxEntry) { e.Status, e.Block = status, receipt.BlockNumber.Uint64() })
+}
+
+// update applies change to a copy of the entry, saves it and only then
+// replaces the entry
+func (o *Outbox) update(entry *OutboxEntry, change func(*OutboxEntry)) error {
+	next := *entry
+	change(&next)
+	next.Updated = time.Now().UTC()
+	if err := o.store.Save(&next); err != nil {
+		return fmt.Errorf("failed to save outbox entry %s: %w", entry.Key, err)
+	}
+	*entry = next
+	return nil
+}
+
+// FileOutboxStore saves outbox entries to a JSONL file, appending the new
+// state of an entry on every change
+type FileOutboxStore struct {
+	file *jsonlFile
+}
+
+// NewFileOutboxStore opens or creates a JSONL outbox file
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	file, err := openJSONL(path, "outbox")
+	if err != nil {
+		return nil, err
+	}
+	return &FileOutboxStore{file: file}, nil
+}
+
+// Save writes the entry as a single line and syncs the file
+func (s *FileOutboxStore) Save(entry *OutboxEntry) error {
+	return s.file.append(entry)
+}
+
+// Load returns the last saved state of each entry in the file
+func (s *FileOutboxStore) Load() ([]OutboxEntry, error) {
+	return readLatest(s.file, "outbox entry", func(entry *OutboxEntry) string { return entry.Key })
+}
+
+// Close closes the outbox file
+func (s *FileOutboxStore) Close() error {
+	return s.file.close()
+}
@@ -0,0 +1,240 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// droppingBackend loses every broadcast, like a crash right after signing
+type droppingBackend struct {
+	walletsdk.Backend
+}
+
+func (droppingBackend) SendTransaction(context.Context, *types.Transaction) error {
+	return errors.New("connection reset")
+}
+
+// rejectingBackend refuses every broadcast with err
+type rejectingBackend struct {
+	walletsdk.Backend
+	err error
+}
+
+func (b rejectingBackend) SendTransaction(context.Context, *types.Transaction) error {
+	return b.err
+}
+
+// failingStore fails every save after the first n
+type failingStore struct {
+	walletsdk.OutboxStore
+	n int
+}
+
+func (s *failingStore) Save(entry *walletsdk.OutboxEntry) error {
+	if s.n == 0 {
+		return errors.New("disk full")
+	}
+	s.n--
+	return s.OutboxStore.Save(entry)
+}
+
+func newOutboxStore(t *testing.T, path string) *walletsdk.FileOutboxStore {
+	t.Helper()
+	store, err := walletsdk.NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatalf("NewFileOutboxStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newOutbox(t *testing.T, client *walletsdk.Client, store walletsdk.OutboxStore) *walletsdk.Outbox {
+	t.Helper()
+	outbox, err := walletsdk.NewOutbox(client, store)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	return outbox
+}
+
+func TestFileOutboxStoreTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	store := newOutboxStore(t, path)
+	for _, key := range []string{"a", "b"} {
+		if err := store.Save(&walletsdk.OutboxEntry{Key: key, Status: walletsdk.OutboxPending}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	store.Close()
+
+	// A crash halfway through an append leaves a torn final line
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"key":"a","status":"conf`)
+	file.Close()
+
+	store = newOutboxStore(t, path)
+	if err := store.Save(&walletsdk.OutboxEntry{Key: "c", Status: walletsdk.OutboxPending}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Status != walletsdk.OutboxPending || entries[2].Key != "c" {
+		t.Fatalf("entries = %+v, want a, b and c pending", entries)
+	}
+
+	// A bad line followed by good ones is corruption
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append([]byte("{\n"), data...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Fatal("Load of a corrupt file succeeded")
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(5), "solver": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	outbox := newOutbox(t, owner, newOutboxStore(t, path))
+	ctx := context.Background()
+
+	tx, err := outbox.TransferPayment(ctx, "task-1", "creator", "solver", tokens(1))
+	mined(t, chain, tx, err)
+	again, err := outbox.TransferPayment(ctx, "task-1", "creator", "solver", tokens(1))
+	if err != nil || again.Hash() != tx.Hash() {
+		t.Fatalf("resubmitted key: %v, %v", again, err)
+	}
+	entry, err := outbox.Wait(ctx, "task-1")
+	if err != nil || entry.Status != walletsdk.OutboxConfirmed || entry.Nonce != tx.Nonce() || entry.Intent == nil {
+		t.Fatalf("Wait: %+v, %v", entry, err)
+	}
+	if _, err := outbox.TransferPayment(ctx, "task-1", "creator", "solver", tokens(2)); err == nil {
+		t.Fatal("key reused for another payment")
+	}
+	expectStake(t, owner, "creator", tokens(4))
+
+	// A restarted outbox still knows the key
+	restarted := newOutbox(t, owner, newOutboxStore(t, path))
+	if again, err := restarted.TransferPayment(ctx, "task-1", "creator", "solver", tokens(1)); err != nil || again.Hash() != tx.Hash() {
+		t.Fatalf("key after restart: %v, %v", again, err)
+	}
+	expectStake(t, owner, "creator", tokens(4))
+}
+
+func TestOutboxRecover(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(5), "solver": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	// Signed, saved and lost before reaching the node
+	dropping, err := walletsdk.NewClientWithBackend(droppingBackend{chain.Backend.Client()}, chain.Config(chain.Owner))
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	lost, err := newOutbox(t, dropping, newOutboxStore(t, path)).TransferPayment(ctx, "signed", "creator", "solver", tokens(1))
+	if err == nil || lost == nil {
+		t.Fatalf("dropped broadcast: %v, %v", lost, err)
+	}
+
+	// Recorded, but the signed transaction could not be saved, so it was
+	// never broadcast
+	store := &failingStore{OutboxStore: newOutboxStore(t, path), n: 1}
+	if _, err := newOutbox(t, owner, store).TransferPayment(ctx, "recorded", "creator", "solver", tokens(2)); err == nil {
+		t.Fatal("transaction broadcast without being saved")
+	}
+	expectStake(t, owner, "creator", tokens(5))
+
+	outbox := newOutbox(t, owner, newOutboxStore(t, path))
+	recovered, err := outbox.Recover(ctx)
+	if err != nil || len(recovered) != 2 || recovered[0].Key != "signed" || recovered[1].Key != "recorded" {
+		t.Fatalf("Recover: %+v, %v", recovered, err)
+	}
+	if recovered[0].Tx.Hash() != lost.Hash() {
+		t.Errorf("signed entry sent as a new transaction")
+	}
+	for _, key := range []string{"signed", "recorded"} {
+		if entry, err := outbox.Wait(ctx, key); err != nil || entry.Status != walletsdk.OutboxConfirmed {
+			t.Fatalf("entry %s: %+v, %v", key, entry, err)
+		}
+	}
+	expectStake(t, owner, "creator", tokens(2))
+
+	// Nothing is left to recover or pay again
+	if recovered, err := outbox.Recover(ctx); err != nil || len(recovered) != 0 {
+		t.Fatalf("second Recover: %+v, %v", recovered, err)
+	}
+	expectStake(t, owner, "solver", tokens(4))
+}
+
+func TestOutboxNonceErrors(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(5), "solver": tokens(1)})
+	rec := &recorder{}
+	config := chain.Config(chain.Owner)
+	config.Metrics = rec
+	owner, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	dropping, err := walletsdk.NewClientWithBackend(droppingBackend{chain.Backend.Client()}, chain.Config(chain.Owner))
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	lost, err := newOutbox(t, dropping, newOutboxStore(t, path)).TransferPayment(ctx, "task", "creator", "solver", tokens(1))
+	if err == nil || lost == nil {
+		t.Fatalf("dropped broadcast: %v, %v", lost, err)
+	}
+
+	// A nonce ahead of the account is not final, so the entry stays signed
+	ahead, err := walletsdk.NewClientWithBackend(rejectingBackend{chain.Backend.Client(), errors.New("nonce too high")}, chain.Config(chain.Owner))
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	if _, err := newOutbox(t, ahead, newOutboxStore(t, path)).Recover(ctx); err == nil {
+		t.Fatal("nonce too high not reported")
+	}
+	outbox := newOutbox(t, owner, newOutboxStore(t, path))
+	if entry, _ := outbox.Entry("task"); entry.Status != walletsdk.OutboxSigned || entry.Tx.Hash() != lost.Hash() {
+		t.Fatalf("entry after nonce too high: %+v", entry)
+	}
+
+	// Once another transaction is mined at its nonce, the entry failed and
+	// the key is sent again
+	tx, err := owner.Mint(chain.Owner.Address, tokens(1))
+	mined(t, chain, tx, err)
+	if _, err := outbox.Recover(ctx); err == nil {
+		t.Fatal("taken nonce not reported")
+	}
+	if entry, _ := outbox.Entry("task"); entry.Status != walletsdk.OutboxFailed || entry.Tx != nil {
+		t.Fatalf("entry after nonce too low: %+v", entry)
+	}
+	tx, err = outbox.TransferPayment(ctx, "task", "creator", "solver", tokens(1))
+	mined(t, chain, tx, err)
+	expectStake(t, owner, "creator", tokens(4))
+	if n := rec.count(walletsdk.MetricNonceResyncs, map[string]string{"source": "outbox"}); n != 1 {
+		t.Errorf("%s = %v, want 1", walletsdk.MetricNonceResyncs, n)
+	}
+}
@@ -0,0 +1,465 @@
+package walletsdk
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Policy rule names reported in PolicyViolationError
+const (
+	RuleDecode        = "decode"
+	RuleDenylist      = "denylist"
+	RuleAllowlist     = "allowlist"
+	RuleBusinessHours = "business-hours"
+	RulePerTxLimit    = "per-tx-limit"
+	RuleWindowLimit   = "window-limit"
+	RuleApproval      = "approval"
+)
+
+// PolicyRequest describes a write operation that is about to be signed.
+// Plain transfers and calls to contracts other than the SDK's have a zero
+// Token, their destination as Recipient and the value sent as Amount.
+type PolicyRequest struct {
+	Time            time.Time
+	From            common.Address
+	To              common.Address
+	Intent          *CallIntent
+	Token           common.Address
+	Amount          *big.Int
+	Recipient       common.Address
+	DeviceID        string
+	RecipientDevice string
+	Tx              *types.Transaction
+}
+
+// PolicyViolationError is returned when a policy rule rejects a request
+type PolicyViolationError struct {
+	Rule    string
+	Reason  string
+	Request *PolicyRequest
+}
+
+func (e *PolicyViolationError) Error() string {
+	if e.Request != nil && e.Request.Intent != nil {
+		return fmt.Sprintf("policy violation (%s): %s: %s", e.Rule, e.Reason, e.Request.Intent)
+	}
+	return fmt.Sprintf("policy violation (%s): %s", e.Rule, e.Reason)
+}
+
+// PolicyDecision is reported to the audit hook for every checked request
+type PolicyDecision struct {
+	Request   *PolicyRequest
+	Allowed   bool
+	Violation *PolicyViolationError
+	Err       error
+}
+
+// SpendLimit caps the amount moved per transaction and over a rolling window.
+// A zero Token or empty DeviceID matches every token or device.
+type SpendLimit struct {
+	Token        common.Address
+	DeviceID     string
+	MaxPerTx     *big.Int
+	MaxPerWindow *big.Int
+	Window       time.Duration
+	// EachDevice tracks the window total separately for every device instead
+	// of across all matching devices
+	EachDevice bool
+}
+
+// BusinessHours restricts signing to a daily time window on the given days.
+// A Start after End is a window crossing midnight, which belongs to the day
+// it starts on.
+type BusinessHours struct {
+	Location *time.Location
+	Days     []time.Weekday
+	Start    time.Duration
+	End      time.Duration
+}
+
+// ApprovalFunc asks a second party to approve a request. It returns false to
+// reject the request.
+type ApprovalFunc func(req *PolicyRequest) (bool, error)
+
+// ApprovalRule requires a second approval for amounts above Threshold
+type ApprovalRule struct {
+	Token     common.Address
+	Threshold *big.Int
+	Approve   ApprovalFunc
+}
+
+// Policy is a spending policy checked before any transaction is signed
+type Policy struct {
+	Limits        []SpendLimit
+	Allowlist     []common.Address
+	Denylist      []common.Address
+	BusinessHours *BusinessHours
+	Approvals     []ApprovalRule
+	OnDecision    func(PolicyDecision)
+	Now           func() time.Time
+
+	mu    sync.Mutex
+	spent []*spendRecord
+}
+
+// spendRecord is an amount counted against rolling window limits
+type spendRecord struct {
+	time     time.Time
+	token    common.Address
+	deviceID string
+	amount   *big.Int
+	// tx is the signed transaction the spend belongs to, once known
+	tx common.Hash
+}
+
+// Check evaluates the request against every rule and records the spend when
+// it is allowed. Violations are returned as *PolicyViolationError.
+func (p *Policy) Check(req *PolicyRequest) error {
+	_, err := p.reserve(req)
+	return err
+}
+
+// reserve checks the request and records its spend, which is returned so a
+// failed signature or broadcast can release it. Approvers run without the
+// lock, so they may be slow or call back into the client; the spend is held
+// meanwhile so concurrent requests cannot overrun a window together.
+func (p *Policy) reserve(req *PolicyRequest) (*spendRecord, error) {
+	if req.Time.IsZero() {
+		req.Time = p.now()
+	}
+
+	var record *spendRecord
+	p.mu.Lock()
+	p.prune(req.Time)
+	err := p.evaluate(req)
+	// Approvals are limited per transaction but only the transfers that use
+	// them count against rolling windows
+	if err == nil && req.Amount != nil && !req.isApproval() {
+		record = &spendRecord{
+			time:     req.Time,
+			token:    req.Token,
+			deviceID: req.DeviceID,
+			amount:   new(big.Int).Set(req.Amount),
+		}
+		p.spent = append(p.spent, record)
+	}
+	p.mu.Unlock()
+
+	if err == nil {
+		if err = p.approve(req); err != nil {
+			p.release(record)
+		}
+	}
+	p.report(req, err)
+	return record, err
+}
+
+// release drops a reserved spend that was never used
+func (p *Policy) release(record *spendRecord) {
+	if record == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, spent := range p.spent {
+		if spent == record {
+			p.spent = append(p.spent[:i], p.spent[i+1:]...)
+			return
+		}
+	}
+}
+
+// signed ties a reserved spend to the transaction signed for it
+func (p *Policy) signed(record *spendRecord, tx common.Hash) {
+	if record == nil {
+		return
+	}
+	p.mu.Lock()
+	record.tx = tx
+	p.mu.Unlock()
+}
+
+// releaseTx drops the spend of a signed transaction that failed to broadcast
+func (p *Policy) releaseTx(tx common.Hash) {
+	p.mu.Lock()
+	var record *spendRecord
+	for _, spent := range p.spent {
+		if spent.tx == tx {
+			record = spent
+			break
+		}
+	}
+	p.mu.Unlock()
+	p.release(record)
+}
+
+// report passes the outcome of a check to the audit hook
+func (p *Policy) report(req *PolicyRequest, err error) {
+	if p.OnDecision == nil {
+		return
+	}
+	decision := PolicyDecision{Request: req, Allowed: err == nil, Err: err}
+	if violation, ok := err.(*PolicyViolationError); ok {
+		decision.Violation = violation
+	}
+	p.OnDecision(decision)
+}
+
+func (p *Policy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// violation builds the error for a rule that rejected req
+func (p *Policy) violation(req *PolicyRequest, rule, format string, args ...interface{}) error {
+	return &PolicyViolationError{Rule: rule, Reason: fmt.Sprintf(format, args...), Request: req}
+}
+
+// evaluate checks every rule except approvals against the recorded spends
+func (p *Policy) evaluate(req *PolicyRequest) error {
+	violation := func(rule, format string, args ...interface{}) error {
+		return p.violation(req, rule, format, args...)
+	}
+
+	if req.Recipient != (common.Address{}) {
+		for _, denied := range p.Denylist {
+			if denied == req.Recipient {
+				return violation(RuleDenylist, "recipient %s is denied", req.Recipient.Hex())
+			}
+		}
+		if len(p.Allowlist) > 0 && !containsAddress(p.Allowlist, req.Recipient) {
+			return violation(RuleAllowlist, "recipient %s is not allowed", req.Recipient.Hex())
+		}
+	}
+
+	if hours := p.BusinessHours; hours != nil && !hours.contains(req.Time) {
+		return violation(RuleBusinessHours, "outside business hours at %s", req.Time.Format(time.RFC3339))
+	}
+
+	if req.Amount == nil {
+		return nil
+	}
+
+	for _, limit := range p.Limits {
+		if !limit.matches(req) {
+			continue
+		}
+		if limit.MaxPerTx != nil && req.Amount.Cmp(limit.MaxPerTx) > 0 {
+			return violation(RulePerTxLimit, "amount %s exceeds per-transaction limit %s", req.Amount, limit.MaxPerTx)
+		}
+		// Approvals never count against the window, so only cap them per tx
+		if limit.MaxPerWindow != nil && limit.Window > 0 && !req.isApproval() {
+			total := p.windowTotal(limit, req)
+			total.Add(total, req.Amount)
+			if total.Cmp(limit.MaxPerWindow) > 0 {
+				return violation(RuleWindowLimit, "amount %s over %s exceeds limit %s", total, limit.Window, limit.MaxPerWindow)
+			}
+		}
+	}
+	return nil
+}
+
+// approve asks the approvers of every rule the request is above. It is called
+// without holding the lock.
+func (p *Policy) approve(req *PolicyRequest) error {
+	if req.Amount == nil {
+		return nil
+	}
+	for _, rule := range p.Approvals {
+		if rule.Token != (common.Address{}) && rule.Token != req.Token {
+			continue
+		}
+		if rule.Threshold == nil || req.Amount.Cmp(rule.Threshold) <= 0 {
+			continue
+		}
+		if rule.Approve == nil {
+			return p.violation(req, RuleApproval, "amount %s requires approval but no approver is configured", req.Amount)
+		}
+		approved, err := rule.Approve(req)
+		if err != nil {
+			return fmt.Errorf("approval failed: %w", err)
+		}
+		if !approved {
+			return p.violation(req, RuleApproval, "amount %s above %s was not approved", req.Amount, rule.Threshold)
+		}
+	}
+	return nil
+}
+
+// windowTotal sums recorded spends that count against the limit for req
+func (p *Policy) windowTotal(limit SpendLimit, req *PolicyRequest) *big.Int {
+	since := req.Time.Add(-limit.Window)
+	total := new(big.Int)
+	for _, record := range p.spent {
+		if record.time.Before(since) {
+			continue
+		}
+		if limit.Token != (common.Address{}) && record.token != limit.Token {
+			continue
+		}
+		if limit.DeviceID != "" && record.deviceID != limit.DeviceID {
+			continue
+		}
+		if limit.EachDevice && record.deviceID != req.DeviceID {
+			continue
+		}
+		total.Add(total, record.amount)
+	}
+	return total
+}
+
+// prune drops spend records that no window can still count
+func (p *Policy) prune(now time.Time) {
+	var longest time.Duration
+	for _, limit := range p.Limits {
+		if limit.Window > longest {
+			longest = limit.Window
+		}
+	}
+	keep := p.spent[:0]
+	for _, record := range p.spent {
+		if !record.time.Before(now.Add(-longest)) {
+			keep = append(keep, record)
+		}
+	}
+	p.spent = keep
+}
+
+func (l SpendLimit) matches(req *PolicyRequest) bool {
+	if l.Token != (common.Address{}) && l.Token != req.Token {
+		return false
+	}
+	if l.DeviceID != "" && l.DeviceID != req.DeviceID {
+		return false
+	}
+	return true
+}
+
+func (h *BusinessHours) contains(t time.Time) bool {
+	if h.Location != nil {
+		t = t.In(h.Location)
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	day := t.Weekday()
+	switch {
+	case h.Start <= h.End:
+		if offset < h.Start || offset >= h.End {
+			return false
+		}
+	case offset >= h.Start:
+	case offset < h.End:
+		// The early hours belong to the window opened the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	if len(h.Days) == 0 {
+		return true
+	}
+	for _, d := range h.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PolicyRequest) isApproval() bool {
+	return r.Intent != nil && r.Intent.Method == "approve"
+}
+
+func containsAddress(list []common.Address, addr common.Address) bool {
+	for _, item := range list {
+		if item == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRequest describes a transaction built by the client for policy checks
+func (c *Client) policyRequest(from common.Address, tx *types.Transaction) (*PolicyRequest, error) {
+	req := &PolicyRequest{From: from, Tx: tx}
+	if tx.To() == nil {
+		if tx.Value().Sign() > 0 {
+			req.Amount = tx.Value()
+		}
+		return req, nil
+	}
+	req.To = *tx.To()
+
+	contract := c.contractName(req.To)
+	if contract == "" {
+		// Plain transfers and other contracts are checked as a payment of
+		// the value to the destination
+		req.Recipient = req.To
+		if tx.Value().Sign() > 0 {
+			req.Amount = tx.Value()
+		}
+		return req, nil
+	}
+	method, values, err := decodeCall(contract, tx.Data())
+	if err != nil {
+		return req, &PolicyViolationError{Rule: RuleDecode, Reason: err.Error(), Request: req}
+	}
+	if req.Intent, err = DecodeCallIntent(contract, tx.Data()); err != nil {
+		return nil, err
+	}
+
+	req.Token = c.tokenAddress
+	for i, input := range method.Inputs {
+		switch value := values[i].(type) {
+		case *big.Int:
+			req.Amount = value
+		case common.Address:
+			switch input.Name {
+			case "_tokenAddress":
+				req.Token = value
+			case "to", "spender", "newOwner", "_newWalletAddress":
+				req.Recipient = value
+			}
+		case string:
+			switch input.Name {
+			case "_deviceId", "_creatorDeviceId":
+				req.DeviceID = value
+			case "_solverDeviceId":
+				req.RecipientDevice = value
+			}
+		}
+	}
+	return req, nil
+}
+
+// policySigner wraps a signer so the client policy is checked first
+func (c *Client) policySigner(signer bind.SignerFn) bind.SignerFn {
+	return func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		req, err := c.policyRequest(from, tx)
+		if err != nil {
+			c.policy.report(req, err)
+			c.logger.Warn("policy rejected transaction", "from", from, "nonce", tx.Nonce(), "error", err)
+			return nil, err
+		}
+		record, err := c.policy.reserve(req)
+		if err != nil {
+			c.logger.Warn("policy rejected transaction", "from", from, "nonce", tx.Nonce(), "error", err)
+			return nil, err
+		}
+		c.logger.Debug("policy allowed transaction", "from", from, "nonce", tx.Nonce(), "intent", req.Intent)
+		signed, err := signer(from, tx)
+		if err != nil {
+			c.policy.release(record)
+			return nil, err
+		}
+		c.policy.signed(record, signed.Hash())
+		return signed, nil
+	}
+}
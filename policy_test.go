@@ -0,0 +1,228 @@
+package walletsdk_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	token := common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3")
+	bob := common.HexToAddress("0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB")
+	carol := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	now := time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC) // a Monday
+	policy := &walletsdk.Policy{
+		Limits: []walletsdk.SpendLimit{{
+			MaxPerTx:     big.NewInt(10),
+			MaxPerWindow: big.NewInt(15),
+			Window:       time.Hour,
+		}},
+		Denylist: []common.Address{carol},
+		BusinessHours: &walletsdk.BusinessHours{
+			Location: time.UTC,
+			Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+			Start:    9 * time.Hour,
+			End:      17 * time.Hour,
+		},
+		Now: func() time.Time { return now },
+	}
+	transfer := func(to common.Address, amount int64) func() error {
+		return func() error {
+			return policy.Check(&walletsdk.PolicyRequest{To: token, Token: token, Recipient: to, Amount: big.NewInt(amount)})
+		}
+	}
+
+	if err := transfer(bob, 10)(); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	expectViolation(t, walletsdk.RulePerTxLimit, transfer(bob, 11))
+	expectViolation(t, walletsdk.RuleWindowLimit, transfer(bob, 6))
+	expectViolation(t, walletsdk.RuleDenylist, transfer(carol, 1))
+
+	// The window rolls over
+	now = now.Add(61 * time.Minute)
+	if err := transfer(bob, 6)(); err != nil {
+		t.Fatalf("Check after the window: %v", err)
+	}
+
+	now = time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)
+	expectViolation(t, walletsdk.RuleBusinessHours, transfer(bob, 1))
+	now = time.Date(2026, time.March, 7, 10, 0, 0, 0, time.UTC) // a Saturday
+	expectViolation(t, walletsdk.RuleBusinessHours, transfer(bob, 1))
+
+	// A night shift crosses midnight and belongs to the day it starts on
+	policy.BusinessHours.Start, policy.BusinessHours.End = 22*time.Hour, 6*time.Hour
+	for _, allowed := range []time.Time{
+		time.Date(2026, time.March, 2, 23, 0, 0, 0, time.UTC), // Monday night
+		time.Date(2026, time.March, 7, 5, 0, 0, 0, time.UTC),  // Friday's shift on Saturday
+	} {
+		now = allowed
+		if err := transfer(bob, 1)(); err != nil {
+			t.Fatalf("Check at %s: %v", allowed, err)
+		}
+	}
+	for _, denied := range []time.Time{
+		time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC), // Monday noon
+		time.Date(2026, time.March, 2, 5, 0, 0, 0, time.UTC),  // Sunday's shift on Monday
+		time.Date(2026, time.March, 7, 23, 0, 0, 0, time.UTC), // Saturday night
+	} {
+		now = denied
+		expectViolation(t, walletsdk.RuleBusinessHours, transfer(bob, 1))
+	}
+}
+
+func TestPolicyLimits(t *testing.T) {
+	chain := newChain(t)
+	alice, bob, carol := chain.Accounts[0], chain.Accounts[1], chain.Accounts[2]
+	client := newClient(t, chain, alice)
+
+	var decisions []walletsdk.PolicyDecision
+	client.SetPolicy(&walletsdk.Policy{
+		Limits: []walletsdk.SpendLimit{{
+			MaxPerTx:     tokens(10),
+			MaxPerWindow: tokens(15),
+			Window:       time.Hour,
+		}},
+		Denylist:   []common.Address{carol.Address},
+		OnDecision: func(d walletsdk.PolicyDecision) { decisions = append(decisions, d) },
+	})
+
+	tx, err := client.Transfer(bob.Address, tokens(10))
+	mined(t, chain, tx, err)
+
+	expectViolation(t, walletsdk.RulePerTxLimit, func() error {
+		_, err := client.Transfer(bob.Address, tokens(11))
+		return err
+	})
+	expectViolation(t, walletsdk.RuleWindowLimit, func() error {
+		_, err := client.Transfer(bob.Address, tokens(6))
+		return err
+	})
+	expectViolation(t, walletsdk.RuleDenylist, func() error {
+		_, err := client.Transfer(carol.Address, tokens(1))
+		return err
+	})
+
+	// Approvals are capped per transaction but do not use up the window
+	tx, err = client.Approve(bob.Address, tokens(10))
+	mined(t, chain, tx, err)
+	tx, err = client.Transfer(bob.Address, tokens(5))
+	mined(t, chain, tx, err)
+
+	if len(decisions) != 6 {
+		t.Fatalf("got %d decisions, want 6", len(decisions))
+	}
+	expectBalance(t, client, tokens(1015), bob)
+}
+
+func TestPolicyApproval(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	approved := false
+	policy := &walletsdk.Policy{
+		Limits: []walletsdk.SpendLimit{{MaxPerWindow: tokens(250), Window: time.Hour}},
+	}
+	policy.Approvals = []walletsdk.ApprovalRule{{
+		Threshold: tokens(100),
+		// Approvers run outside the policy lock and may use the policy
+		Approve: func(req *walletsdk.PolicyRequest) (bool, error) {
+			return approved && policy.Check(&walletsdk.PolicyRequest{Amount: tokens(1)}) == nil, nil
+		},
+	}}
+	client.SetPolicy(policy)
+
+	expectViolation(t, walletsdk.RuleApproval, func() error {
+		_, err := client.Transfer(bob.Address, tokens(200))
+		return err
+	})
+	approved = true
+	tx, err := client.Transfer(bob.Address, tokens(200))
+	mined(t, chain, tx, err)
+
+	// The rejected request released its spend: 200 and the approver's 1 are used
+	tx, err = client.Transfer(bob.Address, tokens(49))
+	mined(t, chain, tx, err)
+}
+
+func TestPolicyFailedBroadcast(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	policy := &walletsdk.Policy{
+		Limits: []walletsdk.SpendLimit{{MaxPerWindow: tokens(10), Window: time.Hour}},
+	}
+	config := chain.Config(alice)
+	config.Policy = policy
+	dropping, err := walletsdk.NewClientWithBackend(droppingBackend{chain.Backend.Client()}, config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	if _, err := dropping.Transfer(bob.Address, tokens(10)); err == nil {
+		t.Fatal("dropped broadcast succeeded")
+	}
+
+	// The lost transfer does not use up the window
+	client := newClient(t, chain, alice)
+	client.SetPolicy(policy)
+	tx, err := client.Transfer(bob.Address, tokens(10))
+	mined(t, chain, tx, err)
+	expectViolation(t, walletsdk.RuleWindowLimit, func() error {
+		_, err := client.Transfer(bob.Address, tokens(1))
+		return err
+	})
+}
+
+func TestPolicyPlainTransfer(t *testing.T) {
+	chain := newChain(t)
+	alice, bob, carol := chain.Accounts[0], chain.Accounts[1], chain.Accounts[2]
+	client := newClient(t, chain, alice)
+	client.SetPolicy(&walletsdk.Policy{
+		Limits:    []walletsdk.SpendLimit{{MaxPerTx: tokens(1)}},
+		Allowlist: []common.Address{bob.Address, chain.TokenAddress},
+	})
+	opts, err := client.GetTransactOpts()
+	if err != nil {
+		t.Fatalf("GetTransactOpts: %v", err)
+	}
+	send := func(to common.Address, value *big.Int) func() error {
+		return func() error {
+			tx := types.NewTx(&types.DynamicFeeTx{
+				ChainID:   big.NewInt(simulated.ChainID),
+				To:        &to,
+				Value:     value,
+				Gas:       21000,
+				GasFeeCap: big.NewInt(1),
+			})
+			_, err := opts.Signer(alice.Address, tx)
+			return err
+		}
+	}
+
+	// Ether and calls to other contracts are checked like token transfers
+	if err := send(bob.Address, tokens(1))(); err != nil {
+		t.Fatalf("allowed transfer: %v", err)
+	}
+	expectViolation(t, walletsdk.RulePerTxLimit, send(bob.Address, tokens(2)))
+	expectViolation(t, walletsdk.RuleAllowlist, send(carol.Address, big.NewInt(1)))
+	expectViolation(t, walletsdk.RuleAllowlist, send(carol.Address, new(big.Int)))
+}
+
+func expectViolation(t *testing.T, rule string, send func() error) {
+	t.Helper()
+	err := send()
+	var violation *walletsdk.PolicyViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("expected %s violation, got %v", rule, err)
+	}
+	if violation.Rule != rule {
+		t.Fatalf("expected %s violation, got %s", rule, violation.Rule)
+	}
+}
@@ -0,0 +1,124 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitOptions configures a RateLimitBackend
+type RateLimitOptions struct {
+	// RequestsPerSecond is the sustained rate allowed by the RPC provider
+	RequestsPerSecond float64
+	// Burst is the number of requests that may be sent at once, by default
+	// RequestsPerSecond rounded up
+	Burst int
+	// MethodWeights is the number of requests each JSON-RPC method counts
+	// as, 1 by default. Providers often charge more for eth_getLogs.
+	MethodWeights map[string]int
+}
+
+// RateLimitBackend holds requests back with a token bucket so that the
+// backend never exceeds the provider's request rate
+type RateLimitBackend struct {
+	*middlewareBackend
+	backend Backend
+	limiter *rate.Limiter
+	weights map[string]int
+}
+
+// NewRateLimitBackend wraps backend with a token bucket limiter
+func NewRateLimitBackend(backend Backend, options RateLimitOptions) (*RateLimitBackend, error) {
+	if options.RequestsPerSecond <= 0 {
+		return nil, fmt.Errorf("requests per second must be positive, got %v", options.RequestsPerSecond)
+	}
+	burst := options.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(options.RequestsPerSecond))
+	}
+	r := &RateLimitBackend{
+		backend: backend,
+		limiter: rate.NewLimiter(rate.Limit(options.RequestsPerSecond), burst),
+		weights: options.MethodWeights,
+	}
+	r.middlewareBackend = &middlewareBackend{handle: r.handle, subscriber: r.subscriber}
+	return r, nil
+}
+
+// Close closes the wrapped backend if it supports closing
+func (r *RateLimitBackend) Close() {
+	if closer, ok := r.backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (r *RateLimitBackend) subscriber() Backend {
+	return r.backend
+}
+
+func (r *RateLimitBackend) handle(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error) {
+	weight := 1
+	if w, ok := r.weights[req.Method]; ok && w > 0 {
+		weight = w
+	}
+	// WaitN rejects weights above the burst, which could never be served
+	if burst := r.limiter.Burst(); weight > burst {
+		weight = burst
+	}
+	if err := r.limiter.WaitN(ctx, weight); err != nil {
+		return nil, fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
+	return call(ctx, r.backend)
+}
+
+// CoalescingBackend shares one request between identical concurrent reads,
+// so many goroutines asking for the same balance at the same block cause a
+// single RPC. Transactions are never coalesced.
+type CoalescingBackend struct {
+	*middlewareBackend
+	backend Backend
+	group   singleflight.Group
+}
+
+// NewCoalescingBackend wraps backend with read coalescing
+func NewCoalescingBackend(backend Backend) *CoalescingBackend {
+	c := &CoalescingBackend{backend: backend}
+	c.middlewareBackend = &middlewareBackend{handle: c.handle, subscriber: c.subscriber}
+	return c
+}
+
+// Close closes the wrapped backend if it supports closing
+func (c *CoalescingBackend) Close() {
+	if closer, ok := c.backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (c *CoalescingBackend) subscriber() Backend {
+	return c.backend
+}
+
+func (c *CoalescingBackend) handle(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error) {
+	if req.Write {
+		return call(ctx, c.backend)
+	}
+	key := fmt.Sprintf("%s %v", req.Method, req.Args)
+	results := c.group.DoChan(key, func() (interface{}, error) {
+		return call(ctx, c.backend)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-results:
+		// The shared request runs under the context of the first caller. If
+		// that caller gave up, the others make their own request.
+		if res.Shared && ctx.Err() == nil && (errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, context.DeadlineExceeded)) {
+			return call(ctx, c.backend)
+		}
+		return res.Val, res.Err
+	}
+}
@@ -0,0 +1,150 @@
+package walletsdk_test
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// slowCalls counts contract calls and holds each one long enough for
+// concurrent callers to overlap
+type slowCalls struct {
+	walletsdk.Backend
+	calls atomic.Int32
+}
+
+func (s *slowCalls) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	s.calls.Add(1)
+	time.Sleep(200 * time.Millisecond)
+	return s.Backend.CallContract(ctx, call, blockNumber)
+}
+
+func TestCoalesceConcurrentReads(t *testing.T) {
+	chain := newChain(t)
+	owner := newClient(t, chain, chain.Accounts[0])
+	tx, err := owner.AddFunds(tokens(10), "device-1")
+	mined(t, chain, tx, err)
+
+	backend := &slowCalls{Backend: chain.Backend.Client()}
+	config := chain.Config(chain.Accounts[0])
+	config.CoalesceReads = true
+	client, err := walletsdk.NewClientWithBackend(backend, config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			balance, err := client.GetStakeBalance("device-1")
+			if err != nil {
+				t.Errorf("GetStakeBalance: %v", err)
+				return
+			}
+			if balance.Cmp(tokens(10)) != 0 {
+				t.Errorf("stake balance = %s, want %s", balance, tokens(10))
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Fatalf("50 concurrent reads made %d calls, want 1", calls)
+	}
+}
+
+func TestCoalesceKeepsDistinctReads(t *testing.T) {
+	chain := newChain(t)
+	backend := &slowCalls{Backend: chain.Backend.Client()}
+	coalescing := walletsdk.NewCoalescingBackend(backend)
+
+	var wg sync.WaitGroup
+	for _, account := range chain.Accounts {
+		wg.Add(1)
+		go func(addr common.Address) {
+			defer wg.Done()
+			token, err := walletsdk.NewParityToken(chain.TokenAddress, coalescing)
+			if err != nil {
+				t.Errorf("NewParityToken: %v", err)
+				return
+			}
+			if _, err := token.BalanceOf(nil, addr); err != nil {
+				t.Errorf("BalanceOf: %v", err)
+			}
+		}(account.Address)
+	}
+	wg.Wait()
+
+	if calls := backend.calls.Load(); calls != int32(len(chain.Accounts)) {
+		t.Fatalf("%d distinct reads made %d calls", len(chain.Accounts), calls)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	backend := retryBackend(t, node, fastRetries)
+	limited, err := walletsdk.NewRateLimitBackend(backend, walletsdk.RateLimitOptions{RequestsPerSecond: 20, Burst: 1})
+	if err != nil {
+		t.Fatalf("NewRateLimitBackend: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		expectCode(t, limited, "code")
+	}
+	// The burst covers the first request, the other four wait 50ms each
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("5 requests at 20/s took %s", elapsed)
+	}
+}
+
+func TestRateLimitMethodWeights(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	backend := retryBackend(t, node, fastRetries)
+	limited, err := walletsdk.NewRateLimitBackend(backend, walletsdk.RateLimitOptions{
+		RequestsPerSecond: 40,
+		Burst:             4,
+		MethodWeights:     map[string]int{"eth_getCode": 4},
+	})
+	if err != nil {
+		t.Fatalf("NewRateLimitBackend: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		expectCode(t, limited, "code")
+	}
+	// Each call uses the whole burst, so the second and third wait 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("3 calls of weight 4 at 40/s took %s", elapsed)
+	}
+}
+
+func TestRateLimitHonoursContext(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	backend := retryBackend(t, node, fastRetries)
+	limited, err := walletsdk.NewRateLimitBackend(backend, walletsdk.RateLimitOptions{RequestsPerSecond: 0.1, Burst: 1})
+	if err != nil {
+		t.Fatalf("NewRateLimitBackend: %v", err)
+	}
+	expectCode(t, limited, "code")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limited.CodeAt(ctx, common.Address{}, nil); err == nil {
+		t.Fatalf("expected the rate limit wait to exceed the deadline")
+	}
+}
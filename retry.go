@@ -0,0 +1,213 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RetryPolicy configures the retries of a RetryBackend. Zero values use the
+// defaults noted on each field.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per request including the
+	// first, 4 by default
+	MaxAttempts int
+	// MethodAttempts overrides MaxAttempts per JSON-RPC method, for example
+	// {"eth_sendRawTransaction": 2}. A value of 1 disables retries.
+	MethodAttempts map[string]int
+	// InitialBackoff is the delay before the first retry, 100ms by default
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, 5s by default
+	MaxBackoff time.Duration
+	// MaxElapsed stops retrying once a request has taken this long, which
+	// is unlimited by default
+	MaxElapsed time.Duration
+	// Logger receives a record for every retry
+	Logger *slog.Logger
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 4
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	p.Logger = discardLogger(p.Logger)
+	return p
+}
+
+func (p RetryPolicy) attempts(method string) int {
+	if n, ok := p.MethodAttempts[method]; ok && n > 0 {
+		return n
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before retry n, doubling from InitialBackoff
+// with a random jitter of up to half the delay
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 0; i < n && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// RetryBackend retries requests that failed with a transient error.
+//
+// Transactions reach the backend already signed, so a retry resends the same
+// bytes and can never be signed twice. A resend that reports "already known"
+// is a success, and "nonce too low" is a success when the transaction is
+// found on chain, since both mean an earlier attempt got through.
+type RetryBackend struct {
+	*middlewareBackend
+	backend Backend
+	policy  RetryPolicy
+}
+
+// NewRetryBackend wraps backend with the retry policy
+func NewRetryBackend(backend Backend, policy RetryPolicy) *RetryBackend {
+	r := &RetryBackend{backend: backend, policy: policy.withDefaults()}
+	r.middlewareBackend = &middlewareBackend{handle: r.handle, subscriber: r.subscriber}
+	return r
+}
+
+// Close closes the wrapped backend if it supports closing
+func (r *RetryBackend) Close() {
+	if closer, ok := r.backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (r *RetryBackend) subscriber() Backend {
+	return r.backend
+}
+
+func (r *RetryBackend) handle(ctx context.Context, req *backendRequest, call backendCall) (interface{}, error) {
+	attempts := r.policy.attempts(req.Method)
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		v, err := call(ctx, r.backend)
+		if req.Write && err != nil {
+			err = r.checkResend(ctx, req, err)
+		}
+		if err == nil || !IsRetryable(err) {
+			return v, err
+		}
+		if attempt >= attempts || r.policy.MaxElapsed > 0 && time.Since(start) >= r.policy.MaxElapsed {
+			if attempt == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s failed after %d attempts: %w", req.Method, attempt, err)
+		}
+
+		delay := r.policy.backoff(attempt - 1)
+		r.policy.Logger.Warn("retrying RPC request", "method", req.Method, "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// checkResend turns the rejection of a resent transaction into success when
+// an earlier attempt reached the node
+func (r *RetryBackend) checkResend(ctx context.Context, req *backendRequest, err error) error {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "already known"):
+		r.policy.Logger.Info("node already has transaction, treating as sent", "tx", req.Tx.Hash())
+		return nil
+	case strings.Contains(msg, "nonce too low"):
+		if _, _, lookupErr := r.backend.TransactionByHash(ctx, req.Tx.Hash()); lookupErr == nil {
+			r.policy.Logger.Info("transaction already on chain, treating as sent", "tx", req.Tx.Hash())
+			return nil
+		}
+	}
+	return err
+}
+
+// retryableMessages are error fragments of transient node conditions
+var retryableMessages = []string{
+	"header not found",
+	"unknown block",
+	"timeout",
+	"timed out",
+	"too many requests",
+	"rate limit",
+	"limit exceeded",
+	"capacity",
+	"try again",
+	"temporarily unavailable",
+	"connection reset",
+	"connection refused",
+	"busy",
+}
+
+// IsRetryable reports whether err is a transient RPC or network failure,
+// such as a rate limit, a timeout or a node that has not seen the requested
+// block yet. Reverts, invalid params and other answers from the chain are
+// permanent.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if !isEndpointFailure(err) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case 408, 425, 429:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32005, -32603:
+			// Limit exceeded and internal error
+			return true
+		case -32600, -32601:
+			// Invalid request and method not found
+			return false
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range retryableMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
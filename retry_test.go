@@ -0,0 +1,174 @@
+package walletsdk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+// fastRetries keeps backoff short enough for tests
+var fastRetries = walletsdk.RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func retryBackend(t *testing.T, node *stubNode, policy walletsdk.RetryPolicy) *walletsdk.RetryBackend {
+	t.Helper()
+	client, err := ethclient.Dial(node.URL)
+	if err != nil {
+		t.Fatalf("failed to dial stub node: %v", err)
+	}
+	backend := walletsdk.NewRetryBackend(client, policy)
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	node.codeErrors.Store(2)
+	node.codeErr = errors.New("header not found")
+	backend := retryBackend(t, node, fastRetries)
+
+	expectCode(t, backend, "code")
+	if calls := node.codeCalls.Load(); calls != 3 {
+		t.Fatalf("getCode called %d times, want 3", calls)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	node.throttle.Store(2)
+	backend := retryBackend(t, node, fastRetries)
+
+	expectCode(t, backend, "code")
+}
+
+func TestRetryMethodBudget(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	node.codeErrors.Store(10)
+	node.codeErr = errors.New("header not found")
+	policy := fastRetries
+	policy.MethodAttempts = map[string]int{"eth_getCode": 2}
+	backend := retryBackend(t, node, policy)
+
+	_, err := backend.CodeAt(context.Background(), common.Address{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed after 2 attempts") {
+		t.Fatalf("expected budget to run out, got %v", err)
+	}
+	if calls := node.codeCalls.Load(); calls != 2 {
+		t.Fatalf("getCode called %d times, want 2", calls)
+	}
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	node.reverting.Store(true)
+	backend := retryBackend(t, node, fastRetries)
+
+	_, err := backend.CodeAt(context.Background(), common.Address{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("expected revert, got %v", err)
+	}
+	if calls := node.codeCalls.Load(); calls != 1 {
+		t.Fatalf("revert was retried %d times", calls-1)
+	}
+}
+
+func TestRetryResendsSameTransaction(t *testing.T) {
+	node := newStubNode(t, "code", 100)
+	// The first response is lost after the node accepted the transaction
+	node.sendErrs = []error{errors.New("request timed out"), errors.New("already known")}
+	backend := retryBackend(t, node, fastRetries)
+
+	if err := backend.SendTransaction(context.Background(), signedTx(t)); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if len(node.raw) != 2 || !bytes.Equal(node.raw[0], node.raw[1]) {
+		t.Fatalf("retry did not resend the identical signed transaction")
+	}
+}
+
+func TestRetryNonceTooLowAfterInclusion(t *testing.T) {
+	chain := newChain(t)
+	sender := chain.Accounts[0]
+	client := newClient(t, chain, sender)
+	backend := walletsdk.NewRetryBackend(chain.Backend.Client(), fastRetries)
+
+	tx, err := client.Transfer(chain.Accounts[1].Address, tokens(1))
+	mined(t, chain, tx, err)
+
+	// Resending the mined transaction is reported as a success
+	if err := backend.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("resending a mined transaction: %v", err)
+	}
+
+	// A different transaction reusing the nonce is still rejected
+	conflict, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		To:       &sender.Address,
+		Gas:      21000,
+		GasPrice: big.NewInt(10e9),
+	}), types.LatestSignerForChainID(big.NewInt(simulated.ChainID)), sender.Key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	err = backend.SendTransaction(context.Background(), conflict)
+	if err == nil || !strings.Contains(err.Error(), "nonce too low") {
+		t.Fatalf("expected nonce too low, got %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{"bad gateway", rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}, true},
+		{"bad request", rpc.HTTPError{StatusCode: 400, Status: "400 Bad Request"}, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"header not found", errors.New("header not found"), true},
+		{"revert", stubRevert{}, false},
+		{"not found", ethereum.NotFound, false},
+		{"nonce too low", errors.New("nonce too low: next nonce 5, tx nonce 4"), false},
+		{"unknown", errors.New("invalid argument 0: hex string without 0x prefix"), false},
+	}
+	for _, tt := range tests {
+		if got := walletsdk.IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientWithRetry(t *testing.T) {
+	chain := newChain(t)
+	config := chain.Config(chain.Accounts[0])
+	config.Retry = &fastRetries
+	client, err := walletsdk.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	if _, ok := client.Backend.(*walletsdk.RetryBackend); !ok {
+		t.Fatalf("client backend is %T, want *walletsdk.RetryBackend", client.Backend)
+	}
+	tx, err := client.Transfer(chain.Accounts[1].Address, tokens(1))
+	mined(t, chain, tx, err)
+}
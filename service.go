@@ -0,0 +1,39 @@
+package walletsdk
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TokenService is the token API of Client. Depend on it instead of *Client
+// to swap in a fake during tests.
+type TokenService interface {
+	GetBalance(address common.Address) (*big.Int, error)
+	GetTokenInfo() (name string, symbol string, decimals uint8, err error)
+	GetAllowance(owner, spender common.Address) (*big.Int, error)
+	GetTotalSupply() (*big.Int, error)
+	Transfer(to common.Address, amount *big.Int) (*types.Transaction, error)
+	Approve(spender common.Address, amount *big.Int) (*types.Transaction, error)
+	TransferFrom(from, to common.Address, amount *big.Int) (*types.Transaction, error)
+	Mint(to common.Address, amount *big.Int) (*types.Transaction, error)
+	Burn(amount *big.Int) (*types.Transaction, error)
+	TransferWithData(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error)
+	TransferWithDataAndCallback(to common.Address, amount *big.Int, data []byte) (*types.Transaction, error)
+}
+
+// StakeService is the staking API of Client
+type StakeService interface {
+	GetStakeInfo(deviceID string) (StakeInfo, error)
+	AddFunds(amount *big.Int, deviceID string) (*types.Transaction, error)
+	TransferPayment(creatorDeviceID, solverDeviceID string, amount *big.Int) (*types.Transaction, error)
+	GetStakeBalance(deviceID string) (*big.Int, error)
+	WithdrawFunds(deviceID string, amount *big.Int) (*types.Transaction, error)
+	UpdateWalletAddress(deviceID string, newWalletAddr common.Address) (*types.Transaction, error)
+}
+
+var (
+	_ TokenService = (*Client)(nil)
+	_ StakeService = (*Client)(nil)
+)
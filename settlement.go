@@ -0,0 +1,486 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Payment outcomes reported in PaymentResult
+const (
+	// PaymentConfirmed payments were mined successfully
+	PaymentConfirmed = "confirmed"
+	// PaymentReverted payments failed in the contract, on chain or when
+	// their gas was estimated. No stake moved.
+	PaymentReverted = "reverted"
+	// PaymentNotSent payments were never broadcast
+	PaymentNotSent = "not_sent"
+	// PaymentPending payments were signed but not seen mined, because the
+	// context ended or the broadcast or receipt lookup failed. Settling
+	// them again waits for or rebroadcasts the same transaction.
+	PaymentPending = "pending"
+)
+
+// ErrInsufficientStake is reported for payments the creator's stake balance
+// cannot cover
+var ErrInsufficientStake = errors.New("insufficient stake balance")
+
+// ErrPaymentNotAttempted is reported for payments left unsent because an
+// earlier payment holds a nonce the node has not received, which every later
+// nonce would wait behind
+var ErrPaymentNotAttempted = errors.New("payment not attempted")
+
+// Payment is a single TransferPayment instruction. ID identifies it across
+// retries and must be unique.
+type Payment struct {
+	ID      string
+	Creator string
+	Solver  string
+	Amount  *big.Int
+}
+
+func (p Payment) same(other Payment) bool {
+	return p.Creator == other.Creator && p.Solver == other.Solver && p.Amount.Cmp(other.Amount) == 0
+}
+
+// PaymentResult is the outcome of one payment of a batch
+type PaymentResult struct {
+	Payment Payment
+	Status  string
+	// Tx is the transaction that carried the payment, if one was sent
+	Tx      *types.Transaction
+	Receipt *types.Receipt
+	// Reason is the decoded revert reason of reverted payments
+	Reason string
+	// Err explains payments that were not sent or are still pending
+	Err error
+}
+
+// SettlementOptions configures a Settler
+type SettlementOptions struct {
+	// Concurrency bounds the payments broadcast but not yet confirmed, 16
+	// by default
+	Concurrency int
+	// SkipValidation sends payments without checking creator balances and
+	// solver devices first
+	SkipValidation bool
+	// OnSigned is called with every signed payment transaction before it is
+	// broadcast. Payments it returns an error for are not sent.
+	OnSigned func(Payment, *types.Transaction) error
+	// BroadcastAttempts is how often a signed payment is broadcast before
+	// the batch stops, 3 by default
+	BroadcastAttempts int
+}
+
+// Settler settles batches of payments through TransferPayment. It sends them
+// with consecutive nonces without waiting for each to be mined and remembers
+// every payment by ID, so settling a batch again only resends payments that
+// did not go through.
+type Settler struct {
+	client  *Client
+	options SettlementOptions
+	// retry spaces out the broadcasts of a payment
+	retry RetryPolicy
+
+	// mu serializes batches, which share the account nonce
+	mu      sync.Mutex
+	results map[string]PaymentResult
+}
+
+// NewSettler returns a settler signing with client
+func NewSettler(client *Client, options SettlementOptions) *Settler {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 16
+	}
+	if options.BroadcastAttempts <= 0 {
+		options.BroadcastAttempts = 3
+	}
+	retry := RetryPolicy{MaxAttempts: options.BroadcastAttempts}.withDefaults()
+	return &Settler{client: client, options: options, retry: retry, results: make(map[string]PaymentResult)}
+}
+
+// Result returns the latest outcome of the payment with the given ID
+func (s *Settler) Result(id string) (PaymentResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, ok := s.results[id]
+	return result, ok
+}
+
+// restore seeds the settler with a payment sent before a restart, so the next
+// Settle waits for its transaction instead of paying again
+func (s *Settler) restore(p Payment, tx *types.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[p.ID] = PaymentResult{Payment: p, Status: PaymentPending, Tx: tx}
+}
+
+// Settle sends the payments and waits until each is mined or ctx ends.
+// Results are in the order of payments. Payments confirmed by an earlier
+// call are returned as they were, and pending ones are tracked rather than
+// sent again, so a failed batch can be retried as a whole without paying
+// twice. The error is only set when the batch itself is invalid.
+func (s *Settler) Settle(ctx context.Context, payments []Payment) ([]PaymentResult, error) {
+	if s.client.stakeWallet == nil {
+		return nil, fmt.Errorf("stake wallet not initialized")
+	}
+	seen := make(map[string]bool)
+	for _, p := range payments {
+		switch {
+		case p.ID == "":
+			return nil, fmt.Errorf("payment from %s to %s has no ID", p.Creator, p.Solver)
+		case seen[p.ID]:
+			return nil, fmt.Errorf("duplicate payment ID %s", p.ID)
+		case p.Amount == nil || p.Amount.Sign() <= 0:
+			return nil, fmt.Errorf("payment %s: amount must be positive", p.ID)
+		case p.Creator == "" || p.Solver == "":
+			return nil, fmt.Errorf("payment %s: creator and solver devices are required", p.ID)
+		}
+		seen[p.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]PaymentResult, len(payments))
+	var todo []int
+	var wg sync.WaitGroup
+	// stuck is a pending payment that could not be rebroadcast
+	var stuck *PaymentResult
+	for i, p := range payments {
+		results[i] = PaymentResult{Payment: p, Status: PaymentNotSent}
+		prev, ok := s.results[p.ID]
+		switch {
+		case !ok:
+			todo = append(todo, i)
+		case !prev.Payment.same(p):
+			results[i].Err = fmt.Errorf("payment %s differs from the one first settled under its ID", p.ID)
+		case prev.Status == PaymentConfirmed:
+			results[i] = prev
+		case prev.Status == PaymentPending:
+			if s.resume(ctx, prev.Tx, &results[i]) {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					s.confirm(ctx, prev.Tx, &results[i])
+				}(i)
+			} else if results[i].Status == PaymentNotSent && results[i].Err == nil {
+				todo = append(todo, i)
+			} else if results[i].Status == PaymentPending && stuck == nil {
+				stuck = &results[i]
+			}
+		default:
+			// Reverted and unsent payments moved no stake
+			todo = append(todo, i)
+		}
+	}
+
+	if stuck != nil {
+		// Its nonce may be missing from the node, so new payments would
+		// queue behind it
+		for _, i := range todo {
+			results[i].Err = fmt.Errorf("%w: payment %s with nonce %d is not broadcast", ErrPaymentNotAttempted, stuck.Payment.ID, stuck.Tx.Nonce())
+		}
+		todo = nil
+	}
+	if !s.options.SkipValidation {
+		todo = s.validate(ctx, payments, todo, results)
+	}
+	s.client.logger.Info("settling payments", "batch", len(payments), "sending", len(todo))
+	s.submit(ctx, todo, results, &wg)
+	wg.Wait()
+
+	for _, result := range results {
+		prev, ok := s.results[result.Payment.ID]
+		if ok && !prev.Payment.same(result.Payment) {
+			continue
+		}
+		s.results[result.Payment.ID] = result
+	}
+	return results, nil
+}
+
+// resume checks a payment left pending by an earlier batch. It returns true
+// when the transaction is still waiting to be mined.
+func (s *Settler) resume(ctx context.Context, tx *types.Transaction, result *PaymentResult) bool {
+	result.Tx = tx
+	receipt, err := s.client.TransactionReceipt(ctx, tx.Hash())
+	if err == nil {
+		s.finish(ctx, tx, receipt, result)
+		return false
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		result.Status, result.Err = PaymentPending, err
+		return false
+	}
+
+	// Rebroadcast in case the node dropped it. The same signed transaction
+	// can be mined at most once.
+	err = s.client.SendTransaction(ctx, tx)
+	switch {
+	case err == nil, isAlreadyKnown(err):
+		result.Status = PaymentPending
+		return true
+	case isNonceError(err):
+		// Either this transaction was mined or another one took its
+		// nonce. Only a confirmed nonce past this one and a node that
+		// answers it has no receipt prove the payment was never made.
+		receipt, receiptErr := s.client.TransactionReceipt(ctx, tx.Hash())
+		switch {
+		case receiptErr == nil:
+			s.finish(ctx, tx, receipt, result)
+		case !errors.Is(receiptErr, ethereum.NotFound):
+			result.Status, result.Err = PaymentPending, fmt.Errorf("failed to get receipt: %w", receiptErr)
+		case !isNonceTooLow(err):
+			result.Status, result.Err = PaymentPending, fmt.Errorf("nonce %d is not final yet: %w", tx.Nonce(), err)
+		default:
+			result.Tx, result.Status = nil, PaymentNotSent
+		}
+		return false
+	default:
+		result.Status, result.Err = PaymentPending, err
+		return false
+	}
+}
+
+// validate marks payments that would revert for a missing solver or an
+// insufficient creator balance and returns the rest, covering the payments
+// of each creator in batch order
+func (s *Settler) validate(ctx context.Context, payments []Payment, todo []int, results []PaymentResult) []int {
+	opts := &bind.CallOpts{Context: ctx}
+	balances := make(map[string]*big.Int)
+	solvers := make(map[string]error)
+	var valid []int
+	for _, i := range todo {
+		p := payments[i]
+		if _, ok := solvers[p.Solver]; !ok {
+			info, err := s.client.stakeWallet.stakeInfo(opts, p.Solver)
+			if err == nil && !info.Exists {
+				err = fmt.Errorf("solver device %s not found", p.Solver)
+			}
+			solvers[p.Solver] = err
+		}
+		if err := solvers[p.Solver]; err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		balance, ok := balances[p.Creator]
+		if !ok {
+			b, err := s.client.stakeWallet.contract.GetBalance(opts, p.Creator)
+			if err != nil {
+				results[i].Err = fmt.Errorf("failed to get balance of %s: %w", p.Creator, err)
+				continue
+			}
+			balance = b
+			balances[p.Creator] = balance
+		}
+		if balance.Cmp(p.Amount) < 0 {
+			results[i].Err = fmt.Errorf("%w: %s holds %s, payment needs %s", ErrInsufficientStake, p.Creator, balance, p.Amount)
+			continue
+		}
+		balance.Sub(balance, p.Amount)
+		valid = append(valid, i)
+	}
+	return valid
+}
+
+// submit sends payments with consecutive nonces, keeping at most
+// Concurrency of them unconfirmed
+func (s *Settler) submit(ctx context.Context, todo []int, results []PaymentResult, wg *sync.WaitGroup) {
+	if len(todo) == 0 {
+		return
+	}
+	nonce, err := s.client.PendingNonceAt(ctx, s.client.address)
+	if err != nil {
+		for _, i := range todo {
+			results[i].Err = fmt.Errorf("failed to get nonce: %w", err)
+		}
+		return
+	}
+
+	inflight := make(chan struct{}, s.options.Concurrency)
+	for n, i := range todo {
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+			for _, j := range todo[n:] {
+				results[j].Err = ctx.Err()
+			}
+			return
+		}
+
+		result := &results[i]
+		tx, err := s.send(ctx, result.Payment, nonce)
+		if tx != nil {
+			// A signed payment holds its nonce even if the broadcast
+			// failed, since it may have reached the node. Settling it
+			// again resumes the same transaction.
+			nonce++
+			result.Tx, result.Status, result.Err = tx, PaymentPending, err
+			if err == nil {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-inflight }()
+					s.confirm(ctx, tx, result)
+				}()
+				continue
+			}
+			if !isNonceError(err) {
+				// Later nonces would wait behind this one until it is
+				// broadcast, so stop here
+				<-inflight
+				for _, j := range todo[n+1:] {
+					results[j].Err = fmt.Errorf("%w: payment %s with nonce %d is not broadcast", ErrPaymentNotAttempted, result.Payment.ID, tx.Nonce())
+				}
+				return
+			}
+		} else if reason, ok := revertReason(err); ok {
+			result.Status, result.Reason = PaymentReverted, reason
+		} else {
+			result.Err = err
+		}
+		<-inflight
+		if isNonceError(err) {
+			s.client.metrics.Add(MetricNonceResyncs, 1, map[string]string{"source": "settlement"})
+			if nonce, err = s.client.PendingNonceAt(ctx, s.client.address); err != nil {
+				for _, j := range todo[n+1:] {
+					results[j].Err = fmt.Errorf("failed to get nonce: %w", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// send signs and broadcasts one payment at nonce. A payment that was signed
+// and recorded but could not be broadcast is returned with the error, since
+// the node may have received it anyway.
+func (s *Settler) send(ctx context.Context, p Payment, nonce uint64) (*types.Transaction, error) {
+	base, err := s.client.GetTransactOpts()
+	if err != nil {
+		return nil, err
+	}
+	opts := *base
+	opts.Context = ctx
+	opts.Nonce = new(big.Int).SetUint64(nonce)
+	opts.NoSend = true
+	tx, err := s.client.stakeWallet.contract.TransferPayment(&opts, p.Creator, p.Solver, p.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if s.options.OnSigned != nil {
+		if err := s.options.OnSigned(p, tx); err != nil {
+			return nil, fmt.Errorf("failed to record signed payment: %w", err)
+		}
+	}
+	if err := s.broadcast(ctx, tx); err != nil {
+		return tx, fmt.Errorf("failed to broadcast payment: %w", err)
+	}
+	return tx, nil
+}
+
+// broadcast sends tx, sending the same signed transaction again after
+// failures other than nonce errors, which no resend can fix
+func (s *Settler) broadcast(ctx context.Context, tx *types.Transaction) error {
+	for attempt := 1; ; attempt++ {
+		err := s.client.SendTransaction(ctx, tx)
+		if err == nil {
+			return nil
+		}
+		// A lost response may hide a successful broadcast
+		if _, _, lookupErr := s.client.TransactionByHash(ctx, tx.Hash()); lookupErr == nil {
+			return nil
+		}
+		if isNonceError(err) || attempt >= s.options.BroadcastAttempts {
+			return err
+		}
+
+		delay := s.retry.backoff(attempt - 1)
+		s.client.logger.Warn("retrying payment broadcast", "tx", tx.Hash(), "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// confirm waits for tx to be mined and records the outcome
+func (s *Settler) confirm(ctx context.Context, tx *types.Transaction, result *PaymentResult) {
+	receipt, err := bind.WaitMined(ctx, s.client, tx)
+	if err != nil {
+		result.Status, result.Err = PaymentPending, err
+		return
+	}
+	s.finish(ctx, tx, receipt, result)
+}
+
+func (s *Settler) finish(ctx context.Context, tx *types.Transaction, receipt *types.Receipt, result *PaymentResult) {
+	result.Tx, result.Receipt, result.Err = tx, receipt, nil
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		result.Status = PaymentConfirmed
+		return
+	}
+	result.Status = PaymentReverted
+	result.Reason = s.replay(ctx, tx, receipt)
+}
+
+// replay repeats a reverted transaction as a call on the state before its
+// block to recover the revert reason
+func (s *Settler) replay(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) string {
+	if receipt.GasUsed == tx.Gas() {
+		return "out of gas"
+	}
+	block := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err := s.client.CallContract(ctx, ethereum.CallMsg{
+		From: s.client.address,
+		To:   tx.To(),
+		Gas:  tx.Gas(),
+		Data: tx.Data(),
+	}, block)
+	if err == nil {
+		return ""
+	}
+	reason, _ := revertReason(err)
+	return reason
+}
+
+// revertReason returns the reason of a revert error, decoding Error(string)
+// revert data when the node returns it
+func revertReason(err error) (string, bool) {
+	if !isRevert(err) {
+		return "", false
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if hex, ok := dataErr.ErrorData().(string); ok {
+			if data, decodeErr := hexutil.Decode(hex); decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(data); unpackErr == nil {
+					return reason, true
+				}
+				if len(data) >= 4 {
+					return fmt.Sprintf("custom error %s", hexutil.Encode(data[:4])), true
+				}
+			}
+		}
+	}
+	if _, reason, ok := strings.Cut(err.Error(), "execution reverted: "); ok {
+		return reason, true
+	}
+	return "", true
+}
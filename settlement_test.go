@@ -0,0 +1,297 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/go-wallet-sdk/simulated"
+)
+
+// stakeDevices stakes amount on each device from its own account
+func stakeDevices(t *testing.T, chain *simulated.Chain, amounts map[string]*big.Int) {
+	t.Helper()
+	n := 0
+	for device, amount := range amounts {
+		client := newClient(t, chain, chain.Accounts[n%len(chain.Accounts)])
+		tx, err := client.AddFunds(amount, device)
+		mined(t, chain, tx, err)
+		n++
+	}
+}
+
+func expectStake(t *testing.T, client *walletsdk.Client, device string, want *big.Int) {
+	t.Helper()
+	got, err := client.GetStakeBalance(device)
+	if err != nil {
+		t.Fatalf("GetStakeBalance: %v", err)
+	}
+	if got.Cmp(want) != 0 {
+		t.Fatalf("stake of %s = %s, want %s", device, got, want)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(10), "solver": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	settler := walletsdk.NewSettler(owner, walletsdk.SettlementOptions{Concurrency: 3})
+
+	var payments []walletsdk.Payment
+	for i := 0; i < 6; i++ {
+		payments = append(payments, walletsdk.Payment{ID: fmt.Sprintf("task-%d", i), Creator: "creator", Solver: "solver", Amount: tokens(1)})
+	}
+	payments = append(payments,
+		walletsdk.Payment{ID: "too-much", Creator: "creator", Solver: "solver", Amount: tokens(5)},
+		walletsdk.Payment{ID: "no-solver", Creator: "creator", Solver: "missing", Amount: tokens(1)},
+	)
+
+	results, err := settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	nonces := make(map[uint64]bool)
+	for _, result := range results[:6] {
+		if result.Status != walletsdk.PaymentConfirmed || result.Receipt == nil {
+			t.Fatalf("payment %s: %s (%v)", result.Payment.ID, result.Status, result.Err)
+		}
+		nonces[result.Tx.Nonce()] = true
+	}
+	if len(nonces) != 6 {
+		t.Errorf("payments shared nonces: %v", nonces)
+	}
+	if r := results[6]; r.Status != walletsdk.PaymentNotSent || !errors.Is(r.Err, walletsdk.ErrInsufficientStake) {
+		t.Errorf("over-budget payment: %s (%v)", r.Status, r.Err)
+	}
+	if r := results[7]; r.Status != walletsdk.PaymentNotSent || r.Err == nil {
+		t.Errorf("payment to missing solver: %s (%v)", r.Status, r.Err)
+	}
+	expectStake(t, owner, "creator", tokens(4))
+
+	// Settling the batch again only retries what did not go through
+	payments[6].Amount = tokens(4)
+	payments[7].Solver = "solver"
+	again, err := settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	for i, result := range again[:6] {
+		if result.Tx.Hash() != results[i].Tx.Hash() {
+			t.Errorf("confirmed payment %s sent again", result.Payment.ID)
+		}
+	}
+	if again[6].Err == nil {
+		t.Errorf("changed payment %s accepted under the same ID", again[6].Payment.ID)
+	}
+	if again[7].Err == nil {
+		t.Errorf("changed payment %s accepted under the same ID", again[7].Payment.ID)
+	}
+	expectStake(t, owner, "creator", tokens(4))
+	expectStake(t, owner, "solver", tokens(7))
+
+	if _, err := settler.Settle(context.Background(), payments[:1:1]); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if _, err := settler.Settle(context.Background(), append(payments[:1:1], payments[0])); err == nil {
+		t.Fatal("duplicate IDs accepted")
+	}
+}
+
+// flakyBackend refuses broadcasts with the error set by fail
+type flakyBackend struct {
+	walletsdk.Backend
+	mu  sync.Mutex
+	err error
+	// times is how many more broadcasts fail, or 0 for all of them
+	times int
+}
+
+func (b *flakyBackend) fail(err error) {
+	b.failTimes(err, 0)
+}
+
+func (b *flakyBackend) failTimes(err error, times int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err, b.times = err, times
+}
+
+func (b *flakyBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	err := b.err
+	if b.times > 0 {
+		if b.times--; b.times == 0 {
+			b.err = nil
+		}
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.Backend.SendTransaction(ctx, tx)
+}
+
+func TestSettleLostBroadcast(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(5), "solver": tokens(1)})
+	backend := &flakyBackend{Backend: chain.Backend.Client()}
+	rec := &recorder{}
+	config := chain.Config(chain.Owner)
+	config.Metrics = rec
+	client, err := walletsdk.NewClientWithBackend(backend, config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+	settler := walletsdk.NewSettler(client, walletsdk.SettlementOptions{})
+	payments := []walletsdk.Payment{
+		{ID: "a", Creator: "creator", Solver: "solver", Amount: tokens(1)},
+		{ID: "b", Creator: "creator", Solver: "solver", Amount: tokens(1)},
+	}
+
+	// A broadcast failing once is sent again
+	backend.failTimes(errors.New("connection reset"), 1)
+	results, err := settler.Settle(context.Background(), payments[:1])
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if r := results[0]; r.Status != walletsdk.PaymentConfirmed {
+		t.Fatalf("payment after one failed broadcast: %s (%v)", r.Status, r.Err)
+	}
+	payments = append(payments[1:], walletsdk.Payment{ID: "c", Creator: "creator", Solver: "solver", Amount: tokens(1)})
+
+	// A payment whose broadcasts keep failing keeps its transaction and
+	// nonce, and the payments after it are not sent, since their nonces
+	// would wait behind it
+	backend.fail(errors.New("connection reset"))
+	lost, err := settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if r := lost[0]; r.Status != walletsdk.PaymentPending || r.Tx == nil || r.Err == nil {
+		t.Fatalf("lost payment: %s %v (%v)", r.Status, r.Tx, r.Err)
+	}
+	if r := lost[1]; r.Status != walletsdk.PaymentNotSent || r.Tx != nil || !errors.Is(r.Err, walletsdk.ErrPaymentNotAttempted) {
+		t.Fatalf("payment after the lost one: %s %v (%v)", r.Status, r.Tx, r.Err)
+	}
+
+	// A nonce ahead of the account is not final, so the payment stays
+	// pending and still holds back the next one
+	backend.fail(errors.New("nonce too high"))
+	results, err = settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if r := results[0]; r.Status != walletsdk.PaymentPending || r.Tx.Hash() != lost[0].Tx.Hash() {
+		t.Fatalf("payment after nonce too high: %s (%v)", r.Status, r.Err)
+	}
+	if r := results[1]; r.Status != walletsdk.PaymentNotSent || !errors.Is(r.Err, walletsdk.ErrPaymentNotAttempted) {
+		t.Fatalf("payment behind a pending one: %s (%v)", r.Status, r.Err)
+	}
+
+	// The retry sends the same transaction rather than a new one, then the
+	// next payment
+	backend.fail(nil)
+	results, err = settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	for _, r := range results {
+		if r.Status != walletsdk.PaymentConfirmed {
+			t.Errorf("retried payment %s: %s (%v)", r.Payment.ID, r.Status, r.Err)
+		}
+	}
+	if results[0].Tx.Hash() != lost[0].Tx.Hash() || results[1].Tx.Nonce() != lost[0].Tx.Nonce()+1 {
+		t.Errorf("payments sent as %s and nonce %d", results[0].Tx.Hash(), results[1].Tx.Nonce())
+	}
+	expectStake(t, client, "creator", tokens(2))
+
+	// A nonce error makes the next payment fetch the nonce again
+	backend.failTimes(errors.New("nonce too low"), 1)
+	if _, err := settler.Settle(context.Background(), []walletsdk.Payment{{ID: "d", Creator: "creator", Solver: "solver", Amount: tokens(1)}}); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if n := rec.count(walletsdk.MetricNonceResyncs, map[string]string{"source": "settlement"}); n != 1 {
+		t.Errorf("%s = %v, want 1", walletsdk.MetricNonceResyncs, n)
+	}
+}
+
+func TestSettleReverted(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(1), "solver": tokens(1)})
+	owner := newClient(t, chain, chain.Owner)
+	settler := walletsdk.NewSettler(owner, walletsdk.SettlementOptions{SkipValidation: true})
+
+	payments := []walletsdk.Payment{
+		{ID: "a", Creator: "creator", Solver: "solver", Amount: tokens(5)},
+		{ID: "b", Creator: "creator", Solver: "solver", Amount: tokens(1)},
+	}
+	results, err := settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if r := results[0]; r.Status != walletsdk.PaymentReverted || r.Reason != "Insufficient balance" || r.Tx != nil {
+		t.Errorf("payment a: %s %q (%v)", r.Status, r.Reason, r.Err)
+	}
+	// The nonce of the reverted estimate is reused
+	if r := results[1]; r.Status != walletsdk.PaymentConfirmed {
+		t.Errorf("payment b: %s (%v)", r.Status, r.Err)
+	}
+}
+
+func TestSettlePending(t *testing.T) {
+	opts := simulated.DefaultOptions()
+	opts.ManualCommit = true
+	chain, err := simulated.New(opts)
+	if err != nil {
+		t.Fatalf("failed to start simulated chain: %v", err)
+	}
+	t.Cleanup(func() { chain.Close() })
+
+	// Mine in the background while staking
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				chain.Commit()
+			}
+		}
+	}()
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(2), "solver": tokens(1)})
+	close(stop)
+
+	owner := newClient(t, chain, chain.Owner)
+	settler := walletsdk.NewSettler(owner, walletsdk.SettlementOptions{})
+	payments := []walletsdk.Payment{{ID: "a", Creator: "creator", Solver: "solver", Amount: tokens(1)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	results, err := settler.Settle(ctx, payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	pending := results[0]
+	if pending.Status != walletsdk.PaymentPending || pending.Tx == nil {
+		t.Fatalf("unmined payment: %s (%v)", pending.Status, pending.Err)
+	}
+
+	// The retry waits for the same transaction
+	chain.Commit()
+	results, err = settler.Settle(context.Background(), payments)
+	if err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if results[0].Status != walletsdk.PaymentConfirmed || results[0].Tx.Hash() != pending.Tx.Hash() {
+		t.Fatalf("retried payment: %s (%v)", results[0].Status, results[0].Err)
+	}
+	expectStake(t, owner, "creator", tokens(1))
+}
@@ -0,0 +1,166 @@
+package walletsdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EIP1271MagicValue is returned by isValidSignature for valid signatures
+var EIP1271MagicValue = [4]byte{0x16, 0x26, 0xba, 0x7e}
+
+// ErrInvalidSignature is returned for signatures that cannot be parsed
+var ErrInvalidSignature = errors.New("invalid signature")
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// eip1271ABI is the isValidSignature method of EIP-1271 contract wallets
+var eip1271ABI = func() abi.ABI {
+	bytes32, _ := abi.NewType("bytes32", "", nil)
+	bytesType, _ := abi.NewType("bytes", "", nil)
+	bytes4, _ := abi.NewType("bytes4", "", nil)
+	method := abi.NewMethod("isValidSignature", "isValidSignature", abi.Function, "view", false, false,
+		abi.Arguments{{Name: "hash", Type: bytes32}, {Name: "signature", Type: bytesType}},
+		abi.Arguments{{Name: "magicValue", Type: bytes4}})
+	return abi.ABI{Methods: map[string]abi.Method{method.Name: method}}
+}()
+
+// PersonalMessageHash returns the EIP-191 version 0x45 hash of msg, the hash
+// signed by personal_sign:
+// keccak256("\x19Ethereum Signed Message:\n" + len(msg) + msg)
+func PersonalMessageHash(msg []byte) common.Hash {
+	return common.BytesToHash(accounts.TextHash(msg))
+}
+
+// ValidatorMessageHash returns the EIP-191 version 0x00 hash of data
+// intended for the validator contract:
+// keccak256("\x19\x00" + validator + data)
+func ValidatorMessageHash(validator common.Address, data []byte) common.Hash {
+	return crypto.Keccak256Hash([]byte{0x19, 0x00}, validator.Bytes(), data)
+}
+
+// NormalizeSignature returns a copy of a 65-byte signature with v as 27 or
+// 28 and s in the lower half of the curve order. A high s is replaced by
+// n - s and v flipped, which signs the same hash by the same key.
+func NormalizeSignature(sig []byte) ([]byte, error) {
+	if len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("%w: length %d", ErrInvalidSignature, len(sig))
+	}
+	normalized := bytes.Clone(sig)
+	v := normalized[crypto.RecoveryIDOffset]
+	switch v {
+	case 0, 1:
+	case 27, 28:
+		v -= 27
+	default:
+		return nil, fmt.Errorf("%w: v = %d", ErrInvalidSignature, v)
+	}
+
+	s := new(big.Int).SetBytes(normalized[32:64])
+	if s.Sign() == 0 || s.Cmp(secp256k1N) >= 0 {
+		return nil, fmt.Errorf("%w: s out of range", ErrInvalidSignature)
+	}
+	if s.Cmp(secp256k1HalfN) > 0 {
+		s.Sub(secp256k1N, s)
+		s.FillBytes(normalized[32:64])
+		v ^= 1
+	}
+	normalized[crypto.RecoveryIDOffset] = v + 27
+	return normalized, nil
+}
+
+// SignHash signs a 32-byte hash with the client key. The 65-byte signature
+// has a low s and ends with v as 27 or 28.
+func (c *Client) SignHash(hash common.Hash) ([]byte, error) {
+	if c.privateKey == nil {
+		return nil, fmt.Errorf("wallet not authenticated")
+	}
+	sig, err := crypto.Sign(hash.Bytes(), c.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign hash: %w", err)
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// SignMessage signs msg as an EIP-191 personal message, the equivalent of
+// personal_sign
+func (c *Client) SignMessage(msg []byte) ([]byte, error) {
+	return c.SignHash(PersonalMessageHash(msg))
+}
+
+// RecoverHash returns the address that signed hash. Signatures with v as 0,
+// 1, 27 or 28 and with high s values are accepted.
+func RecoverHash(hash common.Hash, sig []byte) (common.Address, error) {
+	normalized, err := NormalizeSignature(sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	normalized[crypto.RecoveryIDOffset] -= 27
+	pub, err := crypto.SigToPub(hash.Bytes(), normalized)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// RecoverAddress returns the address that signed msg as an EIP-191 personal
+// message
+func RecoverAddress(msg, sig []byte) (common.Address, error) {
+	return RecoverHash(PersonalMessageHash(msg), sig)
+}
+
+// VerifyMessage reports whether sig is a valid signature of msg as an EIP-191
+// personal message by addr. Signatures for contract wallets are checked with
+// EIP-1271 isValidSignature.
+func (c *Client) VerifyMessage(addr common.Address, msg, sig []byte) (bool, error) {
+	return c.VerifyHash(context.Background(), addr, PersonalMessageHash(msg), sig)
+}
+
+// VerifyHash reports whether sig is a valid signature of hash by addr. When
+// addr has code the contract wallet decides through EIP-1271
+// isValidSignature; otherwise the signer is recovered from sig. The error is
+// only set when the check itself failed.
+func (c *Client) VerifyHash(ctx context.Context, addr common.Address, hash common.Hash, sig []byte) (bool, error) {
+	code, err := c.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get code of %s: %w", addr.Hex(), err)
+	}
+	if len(code) > 0 {
+		return c.IsValidSignature(ctx, addr, hash, sig)
+	}
+
+	signer, err := RecoverHash(hash, sig)
+	if err != nil {
+		return false, nil
+	}
+	return signer == addr, nil
+}
+
+// IsValidSignature asks the EIP-1271 contract wallet at addr whether sig is
+// a valid signature of hash. A revert counts as invalid.
+func (c *Client) IsValidSignature(ctx context.Context, addr common.Address, hash common.Hash, sig []byte) (bool, error) {
+	data, err := eip1271ABI.Pack("isValidSignature", [32]byte(hash), sig)
+	if err != nil {
+		return false, fmt.Errorf("failed to pack isValidSignature: %w", err)
+	}
+	out, err := c.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: data}, nil)
+	if err != nil {
+		if isRevert(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to call isValidSignature: %w", err)
+	}
+	return len(out) >= 4 && bytes.Equal(out[:4], EIP1271MagicValue[:]), nil
+}
@@ -0,0 +1,120 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// highS returns the equivalent signature with s above half the curve order
+func highS(sig []byte) []byte {
+	n := crypto.S256().Params().N
+	flipped := append([]byte(nil), sig...)
+	s := new(big.Int).SetBytes(sig[32:64])
+	new(big.Int).Sub(n, s).FillBytes(flipped[32:64])
+	flipped[64] = 27 + 28 - flipped[64]
+	return flipped
+}
+
+func TestSignMessage(t *testing.T) {
+	chain := newChain(t)
+	client := newClient(t, chain, chain.Accounts[0])
+	msg := []byte("I control this wallet")
+
+	sig, err := client.SignMessage(msg)
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+	if v := sig[64]; v != 27 && v != 28 {
+		t.Fatalf("v = %d", v)
+	}
+	// Matches the personal_sign hash of the key
+	key, _ := crypto.HexToECDSA(chain.Accounts[0].PrivateKeyHex()[2:])
+	want, _ := crypto.Sign(walletsdk.PersonalMessageHash(msg).Bytes(), key)
+	want[64] += 27
+	if string(sig) != string(want) {
+		t.Fatalf("signature differs from personal_sign")
+	}
+
+	high := highS(sig)
+	normalized, err := walletsdk.NormalizeSignature(high)
+	if err != nil || string(normalized) != string(sig) {
+		t.Fatalf("NormalizeSignature: %x, %v", normalized, err)
+	}
+
+	zeroOne := append([]byte(nil), sig...)
+	zeroOne[64] -= 27
+	for name, variant := range map[string][]byte{"27/28": sig, "0/1": zeroOne, "high s": high} {
+		signer, err := walletsdk.RecoverAddress(msg, variant)
+		if err != nil || signer != client.Address() {
+			t.Errorf("%s: RecoverAddress = %s, %v", name, signer.Hex(), err)
+		}
+		if ok, err := client.VerifyMessage(client.Address(), msg, variant); !ok || err != nil {
+			t.Errorf("%s: VerifyMessage = %v, %v", name, ok, err)
+		}
+	}
+
+	if ok, _ := client.VerifyMessage(chain.Accounts[1].Address, msg, sig); ok {
+		t.Error("signature verified for another address")
+	}
+	if ok, _ := client.VerifyMessage(client.Address(), []byte("something else"), sig); ok {
+		t.Error("signature verified for another message")
+	}
+	bad := append([]byte(nil), sig...)
+	bad[64] = 35
+	if _, err := walletsdk.RecoverAddress(msg, bad); !errors.Is(err, walletsdk.ErrInvalidSignature) {
+		t.Errorf("v = 35 accepted: %v", err)
+	}
+	if _, err := walletsdk.RecoverAddress(msg, sig[:64]); !errors.Is(err, walletsdk.ErrInvalidSignature) {
+		t.Errorf("short signature accepted: %v", err)
+	}
+}
+
+// contractWallet returns the init code of a contract whose isValidSignature
+// returns the EIP-1271 magic value for hash only
+func contractWallet(hash common.Hash) []byte {
+	runtime := []byte{0x60, 0x04, 0x35, 0x7f} // PUSH1 4 CALLDATALOAD PUSH32
+	runtime = append(runtime, hash.Bytes()...)
+	runtime = append(runtime,
+		0x14, 0x60, 0x2d, 0x57, // EQ PUSH1 valid JUMPI
+		0x60, 0x20, 0x60, 0x00, 0xf3, // RETURN 32 zero bytes
+		0x5b, 0x63, 0x16, 0x26, 0xba, 0x7e, // valid: JUMPDEST PUSH4 magic
+		0x60, 0xe0, 0x1b, 0x60, 0x00, 0x52, // SHL 224 MSTORE 0
+		0x60, 0x20, 0x60, 0x00, 0xf3, // RETURN 32 bytes
+	)
+	init := []byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+	return append(init, runtime...)
+}
+
+func TestVerifyContractWallet(t *testing.T) {
+	chain := newChain(t)
+	client := newClient(t, chain, chain.Accounts[0])
+	msg := []byte("signed by a contract wallet")
+
+	opts, err := client.GetTransactOpts()
+	if err != nil {
+		t.Fatalf("GetTransactOpts: %v", err)
+	}
+	wallet, tx, _, err := bind.DeployContract(opts, abi.ABI{}, contractWallet(walletsdk.PersonalMessageHash(msg)), client)
+	mined(t, chain, tx, err)
+
+	// The contract decides, whatever the signature
+	if ok, err := client.VerifyMessage(wallet, msg, []byte("opaque")); !ok || err != nil {
+		t.Errorf("VerifyMessage = %v, %v", ok, err)
+	}
+	if ok, err := client.VerifyMessage(wallet, []byte("other"), []byte("opaque")); ok || err != nil {
+		t.Errorf("VerifyMessage of another message = %v, %v", ok, err)
+	}
+	// Contracts without isValidSignature revert or return nothing useful
+	if ok, err := client.IsValidSignature(context.Background(), chain.StakeAddress, walletsdk.PersonalMessageHash(msg), nil); ok || err != nil {
+		t.Errorf("IsValidSignature on the stake contract = %v, %v", ok, err)
+	}
+}
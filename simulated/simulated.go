@@ -0,0 +1,324 @@
+// Package simulated runs the Parity token and stake contracts on an in-memory
+// go-ethereum chain so SDK users can test without a live node
+package simulated
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	gethsim "github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// ChainID is the chain ID of every simulated chain
+const ChainID = 1337
+
+// Account is a funded test account
+type Account struct {
+	Key     *ecdsa.PrivateKey
+	Address common.Address
+}
+
+// PrivateKeyHex returns the account key in the format ClientConfig expects
+func (a Account) PrivateKeyHex() string {
+	return hexutil.Encode(crypto.FromECDSA(a.Key))
+}
+
+// Options configures a simulated chain
+type Options struct {
+	// Accounts is the number of funded accounts besides the owner
+	Accounts int
+	// InitialSupply is minted to the owner when the token is deployed
+	InitialSupply *big.Int
+	// TokenFunding is transferred from the owner to every account
+	TokenFunding *big.Int
+	// EtherFunding is the genesis ether balance of every account
+	EtherFunding *big.Int
+	// ManualCommit disables automatic mining of pending transactions
+	ManualCommit bool
+}
+
+// DefaultOptions returns options with three accounts holding 1000 tokens each
+func DefaultOptions() Options {
+	token := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	return Options{
+		Accounts:      3,
+		InitialSupply: new(big.Int).Mul(big.NewInt(1_000_000), token),
+		TokenFunding:  new(big.Int).Mul(big.NewInt(1_000), token),
+		EtherFunding:  new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18)),
+	}
+}
+
+// Chain is a simulated chain with the token and stake contracts deployed
+type Chain struct {
+	Backend      *gethsim.Backend
+	Owner        Account
+	Accounts     []Account
+	TokenAddress common.Address
+	StakeAddress common.Address
+
+	dir  string
+	ipc  string
+	rpc  *rpc.Client
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New starts a simulated chain, deploys the contracts and funds the accounts
+func New(opts Options) (*Chain, error) {
+	owner, err := newAccount()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, opts.Accounts)
+	alloc := types.GenesisAlloc{owner.Address: {Balance: opts.EtherFunding}}
+	for i := range accounts {
+		if accounts[i], err = newAccount(); err != nil {
+			return nil, err
+		}
+		alloc[accounts[i].Address] = types.Account{Balance: opts.EtherFunding}
+	}
+
+	// Expose the node over IPC so clients can dial it like a real node
+	dir, err := os.MkdirTemp("", "walletsdk-sim")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IPC directory: %w", err)
+	}
+	ipc := filepath.Join(dir, "sim.ipc")
+	backend := gethsim.NewBackend(alloc, func(nodeConf *node.Config, _ *ethconfig.Config) {
+		nodeConf.IPCPath = ipc
+	})
+
+	rpcClient, err := rpc.DialIPC(context.Background(), ipc)
+	if err != nil {
+		backend.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to dial simulated node: %w", err)
+	}
+
+	chain := &Chain{
+		Backend:  backend,
+		Owner:    owner,
+		Accounts: accounts,
+		dir:      dir,
+		ipc:      ipc,
+		rpc:      rpcClient,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if opts.ManualCommit {
+		close(chain.done)
+	} else {
+		go chain.autoCommit()
+	}
+
+	if err := chain.deploy(opts); err != nil {
+		chain.Close()
+		return nil, err
+	}
+	return chain, nil
+}
+
+func newAccount() (Account, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return Account{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return Account{Key: key, Address: crypto.PubkeyToAddress(key.PublicKey)}, nil
+}
+
+// deploy deploys both contracts from the owner and funds the accounts
+func (c *Chain) deploy(opts Options) error {
+	client := c.Backend.Client()
+	auth, err := c.TransactOpts(c.Owner)
+	if err != nil {
+		return err
+	}
+
+	c.TokenAddress, err = c.deployContract(auth, walletsdk.ParityTokenABI, walletsdk.ParityTokenBin, opts.InitialSupply)
+	if err != nil {
+		return fmt.Errorf("failed to deploy token: %w", err)
+	}
+	c.StakeAddress, err = c.deployContract(auth, walletsdk.StakeWalletContractABI, walletsdk.StakeWalletContractBin, c.TokenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to deploy stake wallet: %w", err)
+	}
+
+	if opts.TokenFunding == nil || opts.TokenFunding.Sign() == 0 {
+		return nil
+	}
+	token, err := walletsdk.NewParityToken(c.TokenAddress, client)
+	if err != nil {
+		return err
+	}
+	for _, account := range c.Accounts {
+		tx, err := token.Transfer(auth, account.Address, opts.TokenFunding)
+		if err != nil {
+			return fmt.Errorf("failed to fund %s: %w", account.Address.Hex(), err)
+		}
+		if err := c.waitSuccess(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Chain) deployContract(auth *bind.TransactOpts, abiJSON, bin string, params ...interface{}) (common.Address, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return common.Address{}, err
+	}
+	addr, tx, _, err := bind.DeployContract(auth, parsed, common.FromHex(bin), c.Backend.Client(), params...)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return addr, c.waitSuccess(tx)
+}
+
+// waitSuccess mines tx if needed and checks that it succeeded
+func (c *Chain) waitSuccess(tx *types.Transaction) error {
+	receipt, err := c.WaitMined(tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %s reverted", tx.Hash().Hex())
+	}
+	return nil
+}
+
+// WaitMined commits a block if the chain is not mining automatically and
+// returns the receipt of tx
+func (c *Chain) WaitMined(tx *types.Transaction) (*types.Receipt, error) {
+	select {
+	case <-c.stop:
+		return nil, fmt.Errorf("simulated chain closed")
+	default:
+	}
+	if c.manual() {
+		c.Commit()
+	}
+	// Poll like bind.WaitMined, which waits a second between attempts and
+	// would dominate test run time. Lookups fail while the chain indexes.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		receipt, err := c.Backend.Client().TransactionReceipt(ctx, tx.Hash())
+		if err == nil {
+			return receipt, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for %s: %w", tx.Hash().Hex(), errors.Join(ctx.Err(), err))
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Chain) manual() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Commit seals pending transactions into a new block
+func (c *Chain) Commit() common.Hash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Backend.Commit()
+}
+
+// autoCommit mines a block whenever transactions are pending
+func (c *Chain) autoCommit() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			// PendingTransactionCount reads a pending block the miner caches
+			// for seconds, so ask the pool directly
+			var status map[string]hexutil.Uint
+			err := c.rpc.Call(&status, "txpool_status")
+			if err == nil && status["pending"] > 0 {
+				c.Commit()
+			}
+		}
+	}
+}
+
+// RPCURL returns the IPC endpoint of the simulated node
+func (c *Chain) RPCURL() string {
+	return c.ipc
+}
+
+// Config returns a client configuration for the account on this chain
+func (c *Chain) Config(account Account) walletsdk.ClientConfig {
+	return walletsdk.ClientConfig{
+		RPCURL:       c.ipc,
+		ChainID:      ChainID,
+		TokenAddress: c.TokenAddress,
+		StakeAddress: c.StakeAddress,
+		PrivateKey:   account.PrivateKeyHex(),
+	}
+}
+
+// Client returns a ready SDK client that signs with account. It uses the
+// in-process backend; dial RPCURL with walletsdk.NewClient to go over IPC.
+func (c *Chain) Client(account Account) (*walletsdk.Client, error) {
+	return walletsdk.NewClientWithBackend(sharedClient{c.Backend.Client()}, c.Config(account))
+}
+
+// sharedClient hides the Close method of the backend client, which every SDK
+// client of the chain shares
+type sharedClient struct {
+	gethsim.Client
+}
+
+// TransactOpts returns transaction options signing with account
+func (c *Chain) TransactOpts(account Account) (*bind.TransactOpts, error) {
+	return bind.NewKeyedTransactorWithChainID(account.Key, big.NewInt(ChainID))
+}
+
+// Close stops mining and shuts the chain down
+func (c *Chain) Close() error {
+	select {
+	case <-c.stop:
+		return nil
+	default:
+	}
+	close(c.stop)
+	<-c.done
+
+	c.rpc.Close()
+	err := c.Backend.Close()
+	os.RemoveAll(c.dir)
+	return err
+}
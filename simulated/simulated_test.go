@@ -0,0 +1,93 @@
+package simulated
+
+import (
+	"context"
+	"testing"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestNewDeploysAndFunds(t *testing.T) {
+	opts := DefaultOptions()
+	chain, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer chain.Close()
+
+	client, err := chain.Client(chain.Accounts[0])
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	defer client.Close()
+
+	name, symbol, decimals, err := client.GetTokenInfo()
+	if err != nil {
+		t.Fatalf("GetTokenInfo: %v", err)
+	}
+	if name != "Parity Token" || symbol != "PRTY" || decimals != 18 {
+		t.Fatalf("unexpected token info %q %q %d", name, symbol, decimals)
+	}
+
+	balance, err := client.GetBalance(chain.Accounts[0].Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance.Cmp(opts.TokenFunding) != 0 {
+		t.Fatalf("balance = %s, want %s", balance, opts.TokenFunding)
+	}
+}
+
+func TestManualCommit(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Accounts = 1
+	opts.ManualCommit = true
+	chain, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer chain.Close()
+
+	client, err := chain.Client(chain.Owner)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	defer client.Close()
+
+	tx, err := client.Transfer(chain.Accounts[0].Address, opts.TokenFunding)
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if _, pending, _ := client.TransactionByHash(context.Background(), tx.Hash()); !pending {
+		t.Fatal("transaction mined without a commit")
+	}
+	if _, err := chain.WaitMined(tx); err != nil {
+		t.Fatalf("WaitMined: %v", err)
+	}
+}
+
+func TestClientOverIPC(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Accounts = 1
+	chain, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer chain.Close()
+
+	config := chain.Config(chain.Accounts[0])
+	config.ChainID = 0
+	client, err := walletsdk.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	balance, err := client.GetBalance(chain.Accounts[0].Address)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance.Cmp(opts.TokenFunding) != 0 {
+		t.Fatalf("balance = %s, want %s", balance, opts.TokenFunding)
+	}
+}
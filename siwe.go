@@ -0,0 +1,409 @@
+package walletsdk
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Sign-In with Ethereum errors
+var (
+	ErrSIWEInvalidNonce     = errors.New("unknown or used sign-in nonce")
+	ErrSIWEExpired          = errors.New("sign-in message expired")
+	ErrSIWENotYetValid      = errors.New("sign-in message not yet valid")
+	ErrSIWEMismatch         = errors.New("sign-in message does not match")
+	ErrSIWEInvalidSignature = errors.New("invalid sign-in signature")
+	ErrSIWENotDeviceOwner   = errors.New("signer is not the device's wallet")
+)
+
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// SIWEMessage is an EIP-4361 Sign-In with Ethereum message
+type SIWEMessage struct {
+	// Scheme is the optional URI scheme of the requesting origin
+	Scheme    string
+	Domain    string
+	Address   common.Address
+	Statement string
+	URI       string
+	Version   string
+	ChainID   int64
+	Nonce     string
+	IssuedAt  time.Time
+	// ExpirationTime and NotBefore are left out when zero
+	ExpirationTime time.Time
+	NotBefore      time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// String returns the message text that is signed
+func (m *SIWEMessage) String() string {
+	var b strings.Builder
+	if m.Scheme != "" {
+		b.WriteString(m.Scheme + "://")
+	}
+	b.WriteString(m.Domain + siweHeader + "\n")
+	b.WriteString(m.Address.Hex() + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "URI: %s\nVersion: %s\nChain ID: %d\nNonce: %s\nIssued At: %s",
+		m.URI, m.Version, m.ChainID, m.Nonce, m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		b.WriteString("\nRequest ID: " + m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, resource := range m.Resources {
+			b.WriteString("\n- " + resource)
+		}
+	}
+	return b.String()
+}
+
+// Validate checks the fields against EIP-4361
+func (m *SIWEMessage) Validate() error {
+	switch {
+	case m.Domain == "" || strings.ContainsAny(m.Domain, " \n/"):
+		return fmt.Errorf("invalid domain %q", m.Domain)
+	case strings.Contains(m.Statement, "\n"):
+		return fmt.Errorf("statement must be a single line")
+	case m.Version != "1":
+		return fmt.Errorf("unsupported version %q", m.Version)
+	case m.ChainID <= 0:
+		return fmt.Errorf("invalid chain ID %d", m.ChainID)
+	case len(m.Nonce) < 8 || !alphanumeric(m.Nonce):
+		return fmt.Errorf("nonce must be at least 8 alphanumeric characters")
+	case m.IssuedAt.IsZero():
+		return fmt.Errorf("issued at is required")
+	}
+	if uri, err := url.Parse(m.URI); err != nil || uri.Scheme == "" {
+		return fmt.Errorf("invalid URI %q", m.URI)
+	}
+	for _, resource := range m.Resources {
+		if uri, err := url.Parse(resource); err != nil || uri.Scheme == "" {
+			return fmt.Errorf("invalid resource %q", resource)
+		}
+	}
+	return nil
+}
+
+func alphanumeric(s string) bool {
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSIWEMessage parses and validates the text of an EIP-4361 message. The
+// address must be EIP-55 checksummed.
+func ParseSIWEMessage(text string) (*SIWEMessage, error) {
+	lines := strings.Split(text, "\n")
+	next := func() (string, bool) {
+		if len(lines) == 0 {
+			return "", false
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return line, true
+	}
+
+	m := &SIWEMessage{}
+	header, _ := next()
+	origin, ok := strings.CutSuffix(header, siweHeader)
+	if !ok {
+		return nil, fmt.Errorf("invalid sign-in message header %q", header)
+	}
+	if scheme, domain, ok := strings.Cut(origin, "://"); ok {
+		m.Scheme, m.Domain = scheme, domain
+	} else {
+		m.Domain = origin
+	}
+
+	address, _ := next()
+	if !common.IsHexAddress(address) || common.HexToAddress(address).Hex() != address {
+		return nil, fmt.Errorf("invalid or unchecksummed address %q", address)
+	}
+	m.Address = common.HexToAddress(address)
+
+	if line, _ := next(); line != "" {
+		return nil, fmt.Errorf("expected an empty line after the address")
+	}
+	if line, _ := next(); line != "" {
+		m.Statement = line
+		if line, _ := next(); line != "" {
+			return nil, fmt.Errorf("expected an empty line after the statement")
+		}
+	}
+
+	field := func(name string, required bool) (string, error) {
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], name+": ") {
+			if required {
+				return "", fmt.Errorf("missing %s", name)
+			}
+			return "", nil
+		}
+		line, _ := next()
+		return strings.TrimPrefix(line, name+": "), nil
+	}
+	timestamp := func(name string, required bool) (time.Time, error) {
+		value, err := field(name, required)
+		if err != nil || value == "" {
+			return time.Time{}, err
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return t, nil
+	}
+
+	var err error
+	if m.URI, err = field("URI", true); err != nil {
+		return nil, err
+	}
+	if m.Version, err = field("Version", true); err != nil {
+		return nil, err
+	}
+	chainID, err := field("Chain ID", true)
+	if err != nil {
+		return nil, err
+	}
+	if m.ChainID, err = strconv.ParseInt(chainID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid Chain ID %q", chainID)
+	}
+	if m.Nonce, err = field("Nonce", true); err != nil {
+		return nil, err
+	}
+	if m.IssuedAt, err = timestamp("Issued At", true); err != nil {
+		return nil, err
+	}
+	if m.ExpirationTime, err = timestamp("Expiration Time", false); err != nil {
+		return nil, err
+	}
+	if m.NotBefore, err = timestamp("Not Before", false); err != nil {
+		return nil, err
+	}
+	if m.RequestID, err = field("Request ID", false); err != nil {
+		return nil, err
+	}
+	if len(lines) > 0 && lines[0] == "Resources:" {
+		next()
+		for len(lines) > 0 && strings.HasPrefix(lines[0], "- ") {
+			line, _ := next()
+			m.Resources = append(m.Resources, strings.TrimPrefix(line, "- "))
+		}
+	}
+	if len(lines) > 0 {
+		return nil, fmt.Errorf("unexpected line %q", lines[0])
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SIWENonceStore keeps issued sign-in nonces until they are used or expire.
+// Share one store between instances serving the same portal.
+type SIWENonceStore interface {
+	// Put stores a new nonce valid until expires
+	Put(nonce string, expires time.Time) error
+	// Take removes the nonce and reports whether it was stored and
+	// unexpired
+	Take(nonce string) (bool, error)
+}
+
+// memoryNonceStore is the default in-process SIWENonceStore
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func (s *memoryNonceStore) Put(nonce string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for n, e := range s.nonces {
+		if now.After(e) {
+			delete(s.nonces, n)
+		}
+	}
+	s.nonces[nonce] = expires
+	return nil
+}
+
+func (s *memoryNonceStore) Take(nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.nonces[nonce]
+	delete(s.nonces, nonce)
+	return ok && !time.Now().After(expires), nil
+}
+
+// SIWEOptions configures a SIWE authenticator
+type SIWEOptions struct {
+	// Domain is the domain messages must be issued for
+	Domain string
+	// URI, when set, must match the URI of messages
+	URI string
+	// Statement is put in messages built by NewMessage
+	Statement string
+	// TTL is how long nonces and messages built by NewMessage stay valid,
+	// 10 minutes by default
+	TTL time.Duration
+	// Nonces stores issued nonces, in memory by default
+	Nonces SIWENonceStore
+}
+
+// siweClockSkew is how far in the future a message may be issued, to allow
+// for the signer's clock running ahead
+const siweClockSkew = time.Minute
+
+// SIWE issues and verifies Sign-In with Ethereum messages for the client's
+// chain. Nonces are single use, so a signed message logs in once.
+type SIWE struct {
+	client  *Client
+	options SIWEOptions
+}
+
+// NewSIWE returns a sign-in authenticator verifying signatures through client
+func NewSIWE(client *Client, options SIWEOptions) (*SIWE, error) {
+	if options.Domain == "" {
+		return nil, fmt.Errorf("sign-in domain is required")
+	}
+	if options.TTL <= 0 {
+		options.TTL = 10 * time.Minute
+	}
+	if options.Nonces == nil {
+		options.Nonces = &memoryNonceStore{nonces: make(map[string]time.Time)}
+	}
+	return &SIWE{client: client, options: options}, nil
+}
+
+// Nonce issues a new random nonce valid for the TTL
+func (s *SIWE) Nonce() (string, error) {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	nonce := make([]byte, 16)
+	for i := range nonce {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		nonce[i] = alphabet[n.Int64()]
+	}
+	if err := s.options.Nonces.Put(string(nonce), time.Now().Add(s.options.TTL)); err != nil {
+		return "", fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return string(nonce), nil
+}
+
+// NewMessage builds a message for addr to sign with a fresh nonce, expiring
+// after the TTL
+func (s *SIWE) NewMessage(addr common.Address) (*SIWEMessage, error) {
+	nonce, err := s.Nonce()
+	if err != nil {
+		return nil, err
+	}
+	uri := s.options.URI
+	if uri == "" {
+		uri = "https://" + s.options.Domain
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	return &SIWEMessage{
+		Domain:         s.options.Domain,
+		Address:        addr,
+		Statement:      s.options.Statement,
+		URI:            uri,
+		Version:        "1",
+		ChainID:        s.client.chainID.Int64(),
+		Nonce:          nonce,
+		IssuedAt:       now,
+		ExpirationTime: now.Add(s.options.TTL),
+	}, nil
+}
+
+// Verify parses a signed message and checks its domain, URI, chain, time
+// window, signature and nonce. Contract wallets are verified through
+// EIP-1271. The nonce is only used up by a message passing every other
+// check.
+func (s *SIWE) Verify(ctx context.Context, text string, sig []byte) (*SIWEMessage, error) {
+	m, err := ParseSIWEMessage(text)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case m.Domain != s.options.Domain:
+		return nil, fmt.Errorf("%w: domain %s, expected %s", ErrSIWEMismatch, m.Domain, s.options.Domain)
+	case s.options.URI != "" && m.URI != s.options.URI:
+		return nil, fmt.Errorf("%w: URI %s, expected %s", ErrSIWEMismatch, m.URI, s.options.URI)
+	case m.ChainID != s.client.chainID.Int64():
+		return nil, fmt.Errorf("%w: chain %d, expected %s", ErrSIWEMismatch, m.ChainID, s.client.chainID)
+	}
+	now := time.Now()
+	if m.IssuedAt.After(now.Add(siweClockSkew)) {
+		return nil, fmt.Errorf("%w: issued at %s", ErrSIWENotYetValid, m.IssuedAt.Format(time.RFC3339))
+	}
+	if !m.ExpirationTime.IsZero() && now.After(m.ExpirationTime) {
+		return nil, fmt.Errorf("%w at %s", ErrSIWEExpired, m.ExpirationTime.Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() && now.Before(m.NotBefore) {
+		return nil, fmt.Errorf("%w before %s", ErrSIWENotYetValid, m.NotBefore.Format(time.RFC3339))
+	}
+
+	valid, err := s.client.VerifyHash(ctx, m.Address, PersonalMessageHash([]byte(text)), sig)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w for %s", ErrSIWEInvalidSignature, m.Address.Hex())
+	}
+
+	// Taken last, so a forged or stale message cannot burn the nonce of a
+	// login in progress
+	ok, err := s.options.Nonces.Take(m.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check nonce: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSIWEInvalidNonce, m.Nonce)
+	}
+	return m, nil
+}
+
+// VerifyDeviceOwner verifies a signed message like Verify and also requires
+// the signer to be the wallet address registered for the device
+func (s *SIWE) VerifyDeviceOwner(ctx context.Context, text string, sig []byte, deviceID string) (*SIWEMessage, error) {
+	m, err := s.Verify(ctx, text, sig)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.client.GetStakeInfo(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stake info of %s: %w", deviceID, err)
+	}
+	if !info.Exists || info.WalletAddress != m.Address {
+		return nil, fmt.Errorf("%w: %s does not own device %s", ErrSIWENotDeviceOwner, m.Address.Hex(), deviceID)
+	}
+	return m, nil
+}
@@ -0,0 +1,146 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+const siweExample = `service.invalid wants you to sign in with your Ethereum account:
+0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2
+
+I accept the ServiceOrg Terms of Service: https://service.invalid/tos
+
+URI: https://service.invalid/login
+Version: 1
+Chain ID: 1
+Nonce: 32891756
+Issued At: 2021-09-30T16:25:24Z
+Resources:
+- ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq/
+- https://example.com/my-web2-claim.json`
+
+func TestParseSIWEMessage(t *testing.T) {
+	m, err := walletsdk.ParseSIWEMessage(siweExample)
+	if err != nil {
+		t.Fatalf("ParseSIWEMessage: %v", err)
+	}
+	if m.Domain != "service.invalid" || m.Nonce != "32891756" || m.ChainID != 1 || len(m.Resources) != 2 ||
+		m.IssuedAt != time.Date(2021, 9, 30, 16, 25, 24, 0, time.UTC) {
+		t.Errorf("parsed %+v", m)
+	}
+	if m.String() != siweExample {
+		t.Errorf("message does not round trip:\n%s", m)
+	}
+
+	m.Statement, m.Resources, m.Scheme = "", nil, "https"
+	m.ExpirationTime = m.IssuedAt.Add(time.Hour)
+	again, err := walletsdk.ParseSIWEMessage(m.String())
+	if err != nil || again.String() != m.String() || again.Scheme != "https" {
+		t.Errorf("message without statement: %+v, %v", again, err)
+	}
+
+	for name, text := range map[string]string{
+		"lowercase address": strings.Replace(siweExample, "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", 1),
+		"missing nonce":     strings.Replace(siweExample, "Nonce: 32891756\n", "", 1),
+		"short nonce":       strings.Replace(siweExample, "32891756", "1234", 1),
+		"trailing line":     siweExample + "\nExtra: field",
+		"bad version":       strings.Replace(siweExample, "Version: 1", "Version: 2", 1),
+	} {
+		if _, err := walletsdk.ParseSIWEMessage(text); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+func TestSIWE(t *testing.T) {
+	chain := newChain(t)
+	device := newClient(t, chain, chain.Accounts[0])
+	tx, err := device.AddFunds(tokens(1), "device")
+	mined(t, chain, tx, err)
+	portal := newClient(t, chain, chain.Owner)
+	siwe, err := walletsdk.NewSIWE(portal, walletsdk.SIWEOptions{Domain: "portal.example", Statement: "Log in to the portal"})
+	if err != nil {
+		t.Fatalf("NewSIWE: %v", err)
+	}
+	ctx := context.Background()
+
+	signIn := func(client *walletsdk.Client) (string, []byte) {
+		t.Helper()
+		m, err := siwe.NewMessage(client.Address())
+		if err != nil {
+			t.Fatalf("NewMessage: %v", err)
+		}
+		sig, err := client.SignMessage([]byte(m.String()))
+		if err != nil {
+			t.Fatalf("SignMessage: %v", err)
+		}
+		return m.String(), sig
+	}
+
+	text, sig := signIn(device)
+	m, err := siwe.VerifyDeviceOwner(ctx, text, sig, "device")
+	if err != nil || m.Address != device.Address() {
+		t.Fatalf("VerifyDeviceOwner: %+v, %v", m, err)
+	}
+	if _, err := siwe.Verify(ctx, text, sig); !errors.Is(err, walletsdk.ErrSIWEInvalidNonce) {
+		t.Errorf("replayed sign-in: %v", err)
+	}
+
+	other := newClient(t, chain, chain.Accounts[1])
+	text, sig = signIn(other)
+	if _, err := siwe.VerifyDeviceOwner(ctx, text, sig, "device"); !errors.Is(err, walletsdk.ErrSIWENotDeviceOwner) {
+		t.Errorf("sign-in by another wallet: %v", err)
+	}
+
+	// A forged signature does not use up the nonce of the real sign-in
+	text, textSig := signIn(device)
+	if _, err := siwe.Verify(ctx, text, sig); !errors.Is(err, walletsdk.ErrSIWEInvalidSignature) {
+		t.Errorf("signature of another message: %v", err)
+	}
+	if _, err := siwe.Verify(ctx, text, textSig); err != nil {
+		t.Errorf("sign-in after a forged attempt: %v", err)
+	}
+
+	m, _ = siwe.NewMessage(device.Address())
+	m.ExpirationTime = m.IssuedAt.Add(-time.Minute)
+	sig, _ = device.SignMessage([]byte(m.String()))
+	if _, err := siwe.Verify(ctx, m.String(), sig); !errors.Is(err, walletsdk.ErrSIWEExpired) {
+		t.Errorf("expired sign-in: %v", err)
+	}
+
+	m, _ = siwe.NewMessage(device.Address())
+	m.IssuedAt = m.IssuedAt.Add(time.Hour)
+	sig, _ = device.SignMessage([]byte(m.String()))
+	if _, err := siwe.Verify(ctx, m.String(), sig); !errors.Is(err, walletsdk.ErrSIWENotYetValid) {
+		t.Errorf("sign-in issued in the future: %v", err)
+	}
+
+	m, _ = siwe.NewMessage(device.Address())
+	m.Domain = "phishing.example"
+	sig, _ = device.SignMessage([]byte(m.String()))
+	if _, err := siwe.Verify(ctx, m.String(), sig); !errors.Is(err, walletsdk.ErrSIWEMismatch) {
+		t.Errorf("sign-in for another domain: %v", err)
+	}
+
+	// Smart-contract wallets sign in through EIP-1271
+	nonce, err := device.PendingNonceAt(ctx, device.Address())
+	if err != nil {
+		t.Fatalf("PendingNonceAt: %v", err)
+	}
+	m, _ = siwe.NewMessage(crypto.CreateAddress(device.Address(), nonce))
+	opts, _ := device.GetTransactOpts()
+	_, tx, _, err = bind.DeployContract(opts, abi.ABI{}, contractWallet(walletsdk.PersonalMessageHash([]byte(m.String()))), device)
+	mined(t, chain, tx, err)
+	if _, err := siwe.Verify(ctx, m.String(), []byte("contract signature")); err != nil {
+		t.Errorf("contract wallet sign-in: %v", err)
+	}
+}
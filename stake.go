@@ -2,6 +2,8 @@ package walletsdk
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -19,28 +21,36 @@ type StakeInfo struct {
 
 // StakeWallet manages staking operations
 type StakeWallet struct {
-	client    *Client
-	contract  *StakeWalletContract
-	tokenAddr common.Address
+	backend    Backend
+	transactor Transactor
+	contract   *StakeWalletContract
+	tokenAddr  common.Address
+	logger     *slog.Logger
 }
 
-// NewStakeWallet creates a new stake wallet instance
-func NewStakeWallet(client *Client, contractAddr, tokenAddr common.Address) (*StakeWallet, error) {
-	contract, err := NewStakeWalletContract(contractAddr, client)
+// NewStakeWallet creates a new stake wallet instance that signs with
+// transactor. A *Client serves as both backend and transactor.
+func NewStakeWallet(backend Backend, transactor Transactor, contractAddr, tokenAddr common.Address) (*StakeWallet, error) {
+	contract, err := NewStakeWalletContract(contractAddr, backend)
 	if err != nil {
 		return nil, err
 	}
 
 	return &StakeWallet{
-		client:    client,
-		contract:  contract,
-		tokenAddr: tokenAddr,
+		backend:    backend,
+		transactor: transactor,
+		contract:   contract,
+		tokenAddr:  tokenAddr,
 	}, nil
 }
 
 // GetStakeInfo retrieves stake information for a device ID
 func (s *StakeWallet) GetStakeInfo(deviceID string) (StakeInfo, error) {
-	info, err := s.contract.GetWalletInfo(&bind.CallOpts{}, deviceID)
+	return s.stakeInfo(&bind.CallOpts{}, deviceID)
+}
+
+func (s *StakeWallet) stakeInfo(opts *bind.CallOpts, deviceID string) (StakeInfo, error) {
+	info, err := s.contract.GetWalletInfo(opts, deviceID)
 	if err != nil {
 		return StakeInfo{}, err
 	}
@@ -55,12 +65,12 @@ func (s *StakeWallet) GetStakeInfo(deviceID string) (StakeInfo, error) {
 // Stake tokens with device ID
 func (s *StakeWallet) Stake(amount *big.Int, deviceID string) (*types.Transaction, error) {
 	// First approve the contract to spend tokens
-	tokenClient, err := NewParityToken(s.tokenAddr, s.client)
+	tokenClient, err := NewParityToken(s.tokenAddr, s.backend)
 	if err != nil {
 		return nil, err
 	}
 
-	opts, err := s.client.GetTransactOpts()
+	opts, err := s.transactor.GetTransactOpts()
 	if err != nil {
 		return nil, err
 	}
@@ -72,18 +82,22 @@ func (s *StakeWallet) Stake(amount *big.Int, deviceID string) (*types.Transactio
 	}
 
 	// Wait for approval to be mined
-	_, err = bind.WaitMined(context.Background(), s.client, tx)
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, err = waitMined(ctx, s.backend, discardLogger(s.logger), tx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Now add the funds
-	return s.contract.AddFunds(opts, amount, deviceID, s.client.Address())
+	return s.contract.AddFunds(opts, amount, deviceID, opts.From)
 }
 
 // TransferPayment transfers stake between devices
 func (s *StakeWallet) TransferPayment(creatorDeviceID, solverDeviceID string, amount *big.Int) (*types.Transaction, error) {
-	opts, err := s.client.GetTransactOpts()
+	opts, err := s.transactor.GetTransactOpts()
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +112,7 @@ func (s *StakeWallet) GetBalance(deviceID string) (*big.Int, error) {
 
 // WithdrawStake withdraws staked tokens
 func (s *StakeWallet) WithdrawStake(deviceID string, amount *big.Int) (*types.Transaction, error) {
-	opts, err := s.client.GetTransactOpts()
+	opts, err := s.transactor.GetTransactOpts()
 	if err != nil {
 		return nil, err
 	}
@@ -106,9 +120,27 @@ func (s *StakeWallet) WithdrawStake(deviceID string, amount *big.Int) (*types.Tr
 	return s.contract.WithdrawFunds(opts, deviceID, amount)
 }
 
+// WithdrawAll withdraws the whole stake of a device as of the pending block
+// and returns the amount withdrawn. It fails with ErrEmptyStake when there
+// is nothing to withdraw.
+func (s *StakeWallet) WithdrawAll(deviceID string) (*types.Transaction, *big.Int, error) {
+	balance, err := s.contract.GetBalance(&bind.CallOpts{Pending: true}, deviceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pending balance of %s: %w", deviceID, err)
+	}
+	if balance.Sign() == 0 {
+		return nil, balance, fmt.Errorf("%w: %s", ErrEmptyStake, deviceID)
+	}
+	tx, err := s.WithdrawStake(deviceID, balance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, balance, nil
+}
+
 // UpdateWalletAddress updates the wallet address for a device ID
 func (s *StakeWallet) UpdateWalletAddress(deviceID string, newWalletAddr common.Address) (*types.Transaction, error) {
-	opts, err := s.client.GetTransactOpts()
+	opts, err := s.transactor.GetTransactOpts()
 	if err != nil {
 		return nil, err
 	}
@@ -591,14 +591,11 @@ func (f *StakeWalletContractFilterer) FilterFundsAdded(opts *bind.FilterOpts, de
 	if err != nil {
 		return nil, err
 	}
-	defer sub.Unsubscribe()
-
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-
-	return &StakeWalletContractFundsAddedIterator{contract: f.contract, event: "FundsAdded", logs: logs}, nil
+	return &StakeWalletContractFundsAddedIterator{logIterator{contract: f.contract, event: "FundsAdded", logs: logs}}, nil
 }
 
 // WatchFundsAdded subscribes to FundsAdded events
@@ -658,14 +655,11 @@ func (f *StakeWalletContractFilterer) FilterFundsWithdrawn(opts *bind.FilterOpts
 	if err != nil {
 		return nil, err
 	}
-	defer sub.Unsubscribe()
-
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-
-	return &StakeWalletContractFundsWithdrawnIterator{contract: f.contract, event: "FundsWithdrawn", logs: logs}, nil
+	return &StakeWalletContractFundsWithdrawnIterator{logIterator{contract: f.contract, event: "FundsWithdrawn", logs: logs}}, nil
 }
 
 // WatchFundsWithdrawn subscribes to FundsWithdrawn events
@@ -725,14 +719,11 @@ func (f *StakeWalletContractFilterer) FilterOwnershipTransferred(opts *bind.Filt
 	if err != nil {
 		return nil, err
 	}
-	defer sub.Unsubscribe()
-
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-
-	return &StakeWalletContractOwnershipTransferredIterator{contract: f.contract, event: "OwnershipTransferred", logs: logs}, nil
+	return &StakeWalletContractOwnershipTransferredIterator{logIterator{contract: f.contract, event: "OwnershipTransferred", logs: logs}}, nil
 }
 
 // WatchOwnershipTransferred subscribes to OwnershipTransferred events
@@ -792,14 +783,11 @@ func (f *StakeWalletContractFilterer) FilterTaskPayment(opts *bind.FilterOpts, c
 	if err != nil {
 		return nil, err
 	}
-	defer sub.Unsubscribe()
-
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-
-	return &StakeWalletContractTaskPaymentIterator{contract: f.contract, event: "TaskPayment", logs: logs}, nil
+	return &StakeWalletContractTaskPaymentIterator{logIterator{contract: f.contract, event: "TaskPayment", logs: logs}}, nil
 }
 
 // WatchTaskPayment subscribes to TaskPayment events
@@ -855,14 +843,11 @@ func (f *StakeWalletContractFilterer) FilterTokenRecovered(opts *bind.FilterOpts
 	if err != nil {
 		return nil, err
 	}
-	defer sub.Unsubscribe()
-
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-
-	return &StakeWalletContractTokenRecoveredIterator{contract: f.contract, event: "TokenRecovered", logs: logs}, nil
+	return &StakeWalletContractTokenRecoveredIterator{logIterator{contract: f.contract, event: "TokenRecovered", logs: logs}}, nil
 }
 
 // WatchTokenRecovered subscribes to TokenRecovered events
@@ -905,74 +890,27 @@ func (f *StakeWalletContractFilterer) WatchTokenRecovered(opts *bind.WatchOpts,
 
 // StakeWalletContractFundsAddedIterator is returned from FilterFundsAdded and is used to iterate over the raw logs and unpacked data
 type StakeWalletContractFundsAddedIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // StakeWalletContractFundsWithdrawnIterator is returned from FilterFundsWithdrawn and is used to iterate over the raw logs and unpacked data
 type StakeWalletContractFundsWithdrawnIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // StakeWalletContractOwnershipTransferredIterator is returned from FilterOwnershipTransferred and is used to iterate over the raw logs and unpacked data
 type StakeWalletContractOwnershipTransferredIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // StakeWalletContractTaskPaymentIterator is returned from FilterTaskPayment and is used to iterate over the raw logs and unpacked data
 type StakeWalletContractTaskPaymentIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // StakeWalletContractTokenRecoveredIterator is returned from FilterTokenRecovered and is used to iterate over the raw logs and unpacked data
 type StakeWalletContractTokenRecoveredIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
-}
-
-// Next advances the iterator to the subsequent event
-func (it *StakeWalletContractFundsAddedIterator) Next() bool {
-	if it.fail != nil {
-		return false
-	}
-	if it.done {
-		return false
-	}
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering
-func (it *StakeWalletContractFundsAddedIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process
-func (it *StakeWalletContractFundsAddedIterator) Close() error {
-	it.done = true
-	return nil
+	logIterator
 }
 
 // Event returns the parsed event data for the current log
@@ -988,33 +926,6 @@ func (it *StakeWalletContractFundsAddedIterator) Event() (*StakeWalletContractFu
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event
-func (it *StakeWalletContractFundsWithdrawnIterator) Next() bool {
-	if it.fail != nil {
-		return false
-	}
-	if it.done {
-		return false
-	}
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering
-func (it *StakeWalletContractFundsWithdrawnIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process
-func (it *StakeWalletContractFundsWithdrawnIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *StakeWalletContractFundsWithdrawnIterator) Event() (*StakeWalletContractFundsWithdrawn, error) {
 	if len(it.logs) == 0 {
@@ -1028,33 +939,6 @@ func (it *StakeWalletContractFundsWithdrawnIterator) Event() (*StakeWalletContra
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event
-func (it *StakeWalletContractOwnershipTransferredIterator) Next() bool {
-	if it.fail != nil {
-		return false
-	}
-	if it.done {
-		return false
-	}
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering
-func (it *StakeWalletContractOwnershipTransferredIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process
-func (it *StakeWalletContractOwnershipTransferredIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *StakeWalletContractOwnershipTransferredIterator) Event() (*StakeWalletContractOwnershipTransferred, error) {
 	if len(it.logs) == 0 {
@@ -1068,33 +952,6 @@ func (it *StakeWalletContractOwnershipTransferredIterator) Event() (*StakeWallet
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event
-func (it *StakeWalletContractTaskPaymentIterator) Next() bool {
-	if it.fail != nil {
-		return false
-	}
-	if it.done {
-		return false
-	}
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering
-func (it *StakeWalletContractTaskPaymentIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process
-func (it *StakeWalletContractTaskPaymentIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *StakeWalletContractTaskPaymentIterator) Event() (*StakeWalletContractTaskPayment, error) {
 	if len(it.logs) == 0 {
@@ -1108,33 +965,6 @@ func (it *StakeWalletContractTaskPaymentIterator) Event() (*StakeWalletContractT
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event
-func (it *StakeWalletContractTokenRecoveredIterator) Next() bool {
-	if it.fail != nil {
-		return false
-	}
-	if it.done {
-		return false
-	}
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering
-func (it *StakeWalletContractTokenRecoveredIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process
-func (it *StakeWalletContractTokenRecoveredIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *StakeWalletContractTokenRecoveredIterator) Event() (*StakeWalletContractTokenRecovered, error) {
 	if len(it.logs) == 0 {
@@ -0,0 +1,87 @@
+package walletsdk_test
+
+import (
+	"testing"
+)
+
+func TestStakeLifecycle(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	owner := newClient(t, chain, chain.Owner)
+	aliceClient := newClient(t, chain, alice)
+	bobClient := newClient(t, chain, bob)
+
+	info, err := aliceClient.GetStakeInfo("creator")
+	if err != nil {
+		t.Fatalf("GetStakeInfo: %v", err)
+	}
+	if info.Exists {
+		t.Fatal("unknown device reported as existing")
+	}
+
+	tx, err := aliceClient.AddFunds(tokens(100), "creator")
+	mined(t, chain, tx, err)
+	tx, err = bobClient.AddFunds(tokens(10), "solver")
+	mined(t, chain, tx, err)
+	expectBalance(t, aliceClient, tokens(900), alice)
+
+	info, err = aliceClient.GetStakeInfo("creator")
+	if err != nil {
+		t.Fatalf("GetStakeInfo: %v", err)
+	}
+	if !info.Exists || info.DeviceID != "creator" || info.WalletAddress != alice.Address || info.Amount.Cmp(tokens(100)) != 0 {
+		t.Fatalf("GetStakeInfo = %+v", info)
+	}
+
+	// Only the owner settles payments between devices
+	_, err = aliceClient.TransferPayment("creator", "solver", tokens(30))
+	expectRevert(t, err, "execution reverted")
+	_, err = owner.TransferPayment("creator", "missing", tokens(30))
+	expectRevert(t, err, "Solver device not found")
+	_, err = owner.TransferPayment("creator", "solver", tokens(300))
+	expectRevert(t, err, "Insufficient balance")
+
+	tx, err = owner.TransferPayment("creator", "solver", tokens(30))
+	mined(t, chain, tx, err)
+
+	balance, err := bobClient.GetStakeBalance("solver")
+	if err != nil {
+		t.Fatalf("GetStakeBalance: %v", err)
+	}
+	if balance.Cmp(tokens(40)) != 0 {
+		t.Fatalf("GetStakeBalance = %s, want %s", balance, tokens(40))
+	}
+
+	_, err = aliceClient.WithdrawFunds("solver", tokens(40))
+	expectRevert(t, err, "Not authorized")
+
+	tx, err = bobClient.WithdrawFunds("solver", tokens(40))
+	mined(t, chain, tx, err)
+	expectBalance(t, bobClient, tokens(1030), bob)
+}
+
+func TestUpdateWalletAddress(t *testing.T) {
+	chain := newChain(t)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	client := newClient(t, chain, alice)
+
+	tx, err := client.AddFunds(tokens(50), "device")
+	mined(t, chain, tx, err)
+
+	tx, err = client.UpdateWalletAddress("device", bob.Address)
+	mined(t, chain, tx, err)
+
+	info, err := client.GetStakeInfo("device")
+	if err != nil {
+		t.Fatalf("GetStakeInfo: %v", err)
+	}
+	if info.WalletAddress != bob.Address {
+		t.Fatalf("WalletAddress = %s, want %s", info.WalletAddress.Hex(), bob.Address.Hex())
+	}
+
+	// Withdrawals now pay out to the new wallet
+	bobClient := newClient(t, chain, bob)
+	tx, err = bobClient.WithdrawFunds("device", tokens(50))
+	mined(t, chain, tx, err)
+	expectBalance(t, bobClient, tokens(1050), bob)
+}
@@ -0,0 +1,146 @@
+package walletsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrEmptyStake is returned when withdrawing from a device without stake
+var ErrEmptyStake = errors.New("device has no stake to withdraw")
+
+// Device sweep outcomes
+const (
+	// SweepWithdrawn devices had their stake withdrawn
+	SweepWithdrawn = "withdrawn"
+	// SweepSkipped devices held no stake or only dust
+	SweepSkipped = "skipped"
+	// SweepFailed devices could not be withdrawn from
+	SweepFailed = "failed"
+)
+
+// SweepOptions configures SweepDevices
+type SweepOptions struct {
+	// DeviceDust skips devices whose stake is below it
+	DeviceDust *big.Int
+	// TransferDust leaves the withdrawn tokens in the wallet when their
+	// total is below it
+	TransferDust *big.Int
+	// Timeout bounds the wait for the withdrawals and the transfer to be
+	// mined, 10 minutes by default
+	Timeout time.Duration
+}
+
+// DeviceSweep is the outcome of sweeping one device
+type DeviceSweep struct {
+	DeviceID string
+	Status   string
+	// Amount is the stake withdrawn, or the stake left behind otherwise
+	Amount *big.Int
+	Tx     *types.Transaction
+	Err    error
+}
+
+// SweepReport is the outcome of SweepDevices
+type SweepReport struct {
+	Devices []DeviceSweep
+	// Withdrawn is the total withdrawn from all devices
+	Withdrawn *big.Int
+	// Transfer moved Withdrawn to the destination. It is nil when the
+	// total was below TransferDust.
+	Transfer *types.Transaction
+}
+
+// SweepDevices withdraws the stake of each device, which must pay out to the
+// client's wallet, and transfers the total withdrawn to destination. Devices
+// are reported in the order given. The error is only set when the final
+// transfer fails or is not mined within the timeout.
+func (c *Client) SweepDevices(deviceIDs []string, destination common.Address, options SweepOptions) (*SweepReport, error) {
+	if c.stakeWallet == nil {
+		return nil, fmt.Errorf("stake wallet not initialized")
+	}
+	if destination == (common.Address{}) {
+		return nil, fmt.Errorf("sweep destination is required")
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+	defer cancel()
+
+	report := &SweepReport{Devices: make([]DeviceSweep, len(deviceIDs)), Withdrawn: new(big.Int)}
+	for i, deviceID := range deviceIDs {
+		sweep := &report.Devices[i]
+		sweep.DeviceID, sweep.Status = deviceID, SweepFailed
+		sweep.Amount, sweep.Tx, sweep.Err = c.withdrawDevice(deviceID, options.DeviceDust)
+		switch {
+		case sweep.Tx != nil:
+			sweep.Status = SweepWithdrawn
+		case sweep.Err == nil:
+			sweep.Status = SweepSkipped
+		}
+	}
+
+	// Withdrawals were sent back to back; only mined ones are consolidated
+	for i := range report.Devices {
+		sweep := &report.Devices[i]
+		if sweep.Status != SweepWithdrawn {
+			continue
+		}
+		receipt, err := waitMined(ctx, c, c.logger, sweep.Tx)
+		switch {
+		case err != nil:
+			sweep.Status, sweep.Err = SweepFailed, err
+		case receipt.Status != types.ReceiptStatusSuccessful:
+			sweep.Status, sweep.Err = SweepFailed, fmt.Errorf("withdrawal %s reverted", sweep.Tx.Hash().Hex())
+		default:
+			report.Withdrawn.Add(report.Withdrawn, sweep.Amount)
+		}
+	}
+
+	if report.Withdrawn.Sign() == 0 || options.TransferDust != nil && report.Withdrawn.Cmp(options.TransferDust) < 0 {
+		c.logger.Info("sweep left tokens in wallet", "withdrawn", report.Withdrawn)
+		return report, nil
+	}
+	tx, err := c.Transfer(destination, report.Withdrawn)
+	if err != nil {
+		return report, fmt.Errorf("failed to transfer %s to %s: %w", report.Withdrawn, destination.Hex(), err)
+	}
+	report.Transfer = tx
+	receipt, err := waitMined(ctx, c, c.logger, tx)
+	if err != nil {
+		return report, fmt.Errorf("failed to wait for transfer: %w", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return report, fmt.Errorf("transfer %s reverted", tx.Hash().Hex())
+	}
+	c.logger.Info("devices swept", "devices", len(deviceIDs), "withdrawn", report.Withdrawn, "destination", destination)
+	return report, nil
+}
+
+// withdrawDevice sends the withdrawal of a device's whole stake unless it is
+// below dust. It returns no transaction and no error for skipped devices.
+func (c *Client) withdrawDevice(deviceID string, dust *big.Int) (*big.Int, *types.Transaction, error) {
+	info, err := c.stakeWallet.stakeInfo(&bind.CallOpts{Pending: true}, deviceID)
+	switch {
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to get stake info of %s: %w", deviceID, err)
+	case !info.Exists:
+		return nil, nil, fmt.Errorf("device %s not found", deviceID)
+	case info.WalletAddress != c.address:
+		return info.Amount, nil, fmt.Errorf("device %s pays out to %s, not %s", deviceID, info.WalletAddress.Hex(), c.address.Hex())
+	case info.Amount.Sign() == 0, dust != nil && info.Amount.Cmp(dust) < 0:
+		return info.Amount, nil, nil
+	}
+	tx, err := c.stakeWallet.WithdrawStake(deviceID, info.Amount)
+	if err != nil {
+		return info.Amount, nil, err
+	}
+	return info.Amount, tx, nil
+}
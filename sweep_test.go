@@ -0,0 +1,110 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethsim "github.com/ethereum/go-ethereum/ethclient/simulated"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestWithdrawAll(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"creator": tokens(5)})
+	alice := newClient(t, chain, chain.Accounts[0])
+	tx, err := alice.AddFunds(tokens(2), "device")
+	mined(t, chain, tx, err)
+
+	tx, err = newClient(t, chain, chain.Owner).TransferPayment("creator", "device", tokens(3))
+	mined(t, chain, tx, err)
+
+	// Payments received since funding are withdrawn too
+	tx, amount, err := alice.WithdrawAll("device")
+	if err != nil || amount.Cmp(tokens(5)) != 0 {
+		t.Fatalf("WithdrawAll = %s, %v", amount, err)
+	}
+	mined(t, chain, tx, nil)
+	expectStake(t, alice, "device", new(big.Int))
+
+	if _, _, err := alice.WithdrawAll("device"); !errors.Is(err, walletsdk.ErrEmptyStake) {
+		t.Fatalf("empty stake: %v", err)
+	}
+}
+
+func TestSweepDevices(t *testing.T) {
+	chain := newChain(t)
+	alice := newClient(t, chain, chain.Accounts[0])
+	for device, amount := range map[string]*big.Int{"big": tokens(10), "dust": big.NewInt(1000), "small": tokens(5)} {
+		tx, err := alice.AddFunds(amount, device)
+		mined(t, chain, tx, err)
+	}
+	// Withdrawals of other wallets' devices would revert
+	tx, err := newClient(t, chain, chain.Accounts[1]).AddFunds(tokens(1), "bobs")
+	mined(t, chain, tx, err)
+	cold := common.HexToAddress("0x000000000000000000000000000000000000c01d")
+
+	report, err := alice.SweepDevices([]string{"big", "dust", "small", "bobs", "missing"}, cold,
+		walletsdk.SweepOptions{DeviceDust: tokens(1)})
+	if err != nil {
+		t.Fatalf("SweepDevices: %v", err)
+	}
+	want := []string{walletsdk.SweepWithdrawn, walletsdk.SweepSkipped, walletsdk.SweepWithdrawn, walletsdk.SweepFailed, walletsdk.SweepFailed}
+	for i, device := range report.Devices {
+		if device.Status != want[i] {
+			t.Errorf("device %s: %s (%v)", device.DeviceID, device.Status, device.Err)
+		}
+	}
+	if report.Withdrawn.Cmp(tokens(15)) != 0 || report.Transfer == nil {
+		t.Fatalf("report = %+v", report)
+	}
+	balance, err := alice.GetBalance(cold)
+	if err != nil || balance.Cmp(tokens(15)) != 0 {
+		t.Fatalf("destination balance = %s, %v", balance, err)
+	}
+	expectStake(t, alice, "dust", big.NewInt(1000))
+
+	// Below the transfer threshold the tokens stay in the wallet
+	report, err = alice.SweepDevices([]string{"dust"}, cold, walletsdk.SweepOptions{TransferDust: tokens(1)})
+	if err != nil || report.Devices[0].Status != walletsdk.SweepWithdrawn || report.Transfer != nil {
+		t.Fatalf("dust sweep: %+v, %v", report, err)
+	}
+}
+
+// silentBackend accepts broadcasts without sending them, so nothing is mined
+type silentBackend struct {
+	gethsim.Client
+}
+
+func (silentBackend) SendTransaction(context.Context, *types.Transaction) error {
+	return nil
+}
+
+func TestSweepDevicesTimeout(t *testing.T) {
+	chain := newChain(t)
+	stakeDevices(t, chain, map[string]*big.Int{"device": tokens(1)})
+	config := chain.Config(chain.Accounts[0])
+	silent, err := walletsdk.NewClientWithBackend(silentBackend{chain.Backend.Client()}, config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend: %v", err)
+	}
+
+	// A withdrawal that is never mined fails once the timeout passes
+	start := time.Now()
+	report, err := silent.SweepDevices([]string{"device"}, common.HexToAddress("0x000000000000000000000000000000000000c01d"),
+		walletsdk.SweepOptions{Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("SweepDevices: %v", err)
+	}
+	if sweep := report.Devices[0]; sweep.Status != walletsdk.SweepFailed || !errors.Is(sweep.Err, context.DeadlineExceeded) {
+		t.Fatalf("unmined withdrawal: %s (%v)", sweep.Status, sweep.Err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sweep took %s", elapsed)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 )
 
+//go:generate go run ./internal/contractgen
+
 // ParityTokenABI is the input ABI used to generate the binding from.
 const ParityTokenABI = `[
     {
@@ -588,15 +590,15 @@ func (f *ParityTokenFilterer) FilterTransfer(opts *bind.FilterOpts, from []commo
 		toRule = append(toRule, toItem)
 	}
 
-	logsChan, _, err := f.contract.FilterLogs(opts, "Transfer", fromRule, toRule)
+	logsChan, sub, err := f.contract.FilterLogs(opts, "Transfer", fromRule, toRule)
 	if err != nil {
 		return nil, err
 	}
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-	return &ParityTokenTransferIterator{contract: f.contract, event: "Transfer", logs: logs}, nil
+	return &ParityTokenTransferIterator{logIterator{contract: f.contract, event: "Transfer", logs: logs}}, nil
 }
 
 // FilterApproval is a free log retrieval operation binding the contract Approval event
@@ -610,15 +612,15 @@ func (f *ParityTokenFilterer) FilterApproval(opts *bind.FilterOpts, owner []comm
 		spenderRule = append(spenderRule, spenderItem)
 	}
 
-	logsChan, _, err := f.contract.FilterLogs(opts, "Approval", ownerRule, spenderRule)
+	logsChan, sub, err := f.contract.FilterLogs(opts, "Approval", ownerRule, spenderRule)
 	if err != nil {
 		return nil, err
 	}
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-	return &ParityTokenApprovalIterator{contract: f.contract, event: "Approval", logs: logs}, nil
+	return &ParityTokenApprovalIterator{logIterator{contract: f.contract, event: "Approval", logs: logs}}, nil
 }
 
 // FilterOwnershipTransferred is a free log retrieval operation binding the contract OwnershipTransferred event
@@ -632,15 +634,15 @@ func (f *ParityTokenFilterer) FilterOwnershipTransferred(opts *bind.FilterOpts,
 		newOwnerRule = append(newOwnerRule, newOwnerItem)
 	}
 
-	logsChan, _, err := f.contract.FilterLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	logsChan, sub, err := f.contract.FilterLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
 	if err != nil {
 		return nil, err
 	}
-	logs := make([]types.Log, 0)
-	for log := range logsChan {
-		logs = append(logs, log)
+	logs, err := collectLogs(logsChan, sub)
+	if err != nil {
+		return nil, err
 	}
-	return &ParityTokenOwnershipTransferredIterator{contract: f.contract, event: "OwnershipTransferred", logs: logs}, nil
+	return &ParityTokenOwnershipTransferredIterator{logIterator{contract: f.contract, event: "OwnershipTransferred", logs: logs}}, nil
 }
 
 // WatchTransfer is a free log subscription operation binding the contract Transfer event
@@ -771,29 +773,17 @@ func (f *ParityTokenFilterer) WatchOwnershipTransferred(opts *bind.WatchOpts, si
 
 // ParityTokenTransferIterator is returned from FilterTransfer and is used to iterate over the raw logs and unpacked data for Transfer events raised by the ParityToken contract.
 type ParityTokenTransferIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // ParityTokenApprovalIterator is returned from FilterApproval and is used to iterate over the raw logs and unpacked data for Approval events raised by the ParityToken contract.
 type ParityTokenApprovalIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // ParityTokenOwnershipTransferredIterator is returned from FilterOwnershipTransferred and is used to iterate over the raw logs and unpacked data for OwnershipTransferred events raised by the ParityToken contract.
 type ParityTokenOwnershipTransferredIterator struct {
-	event    string
-	contract *bind.BoundContract
-	logs     []types.Log
-	done     bool
-	fail     error
+	logIterator
 }
 
 // ParityTokenTransfer represents a Transfer event raised by the ParityToken contract.
@@ -819,39 +809,6 @@ type ParityTokenOwnershipTransferred struct {
 	Raw           types.Log // Blockchain specific contextual infos
 }
 
-// Next advances the iterator to the subsequent event, returning whether there
-// are any more events found. In case of a retrieval or parsing error, false is
-// returned and Error() can be queried for the exact failure.
-func (it *ParityTokenTransferIterator) Next() bool {
-	// If the iterator failed, stop iterating
-	if it.fail != nil {
-		return false
-	}
-	// If the iterator completed, deliver directly whatever's available
-	if it.done {
-		return false
-	}
-	// Iterator still has logs, shift after the current value
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering.
-func (it *ParityTokenTransferIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process, releasing any pending underlying
-// resources.
-func (it *ParityTokenTransferIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *ParityTokenTransferIterator) Event() (*ParityTokenTransfer, error) {
 	if len(it.logs) == 0 {
@@ -865,39 +822,6 @@ func (it *ParityTokenTransferIterator) Event() (*ParityTokenTransfer, error) {
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event, returning whether there
-// are any more events found. In case of a retrieval or parsing error, false is
-// returned and Error() can be queried for the exact failure.
-func (it *ParityTokenApprovalIterator) Next() bool {
-	// If the iterator failed, stop iterating
-	if it.fail != nil {
-		return false
-	}
-	// If the iterator completed, deliver directly whatever's available
-	if it.done {
-		return false
-	}
-	// Iterator still has logs, shift after the current value
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering.
-func (it *ParityTokenApprovalIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process, releasing any pending underlying
-// resources.
-func (it *ParityTokenApprovalIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *ParityTokenApprovalIterator) Event() (*ParityTokenApproval, error) {
 	if len(it.logs) == 0 {
@@ -911,39 +835,6 @@ func (it *ParityTokenApprovalIterator) Event() (*ParityTokenApproval, error) {
 	return event, nil
 }
 
-// Next advances the iterator to the subsequent event, returning whether there
-// are any more events found. In case of a retrieval or parsing error, false is
-// returned and Error() can be queried for the exact failure.
-func (it *ParityTokenOwnershipTransferredIterator) Next() bool {
-	// If the iterator failed, stop iterating
-	if it.fail != nil {
-		return false
-	}
-	// If the iterator completed, deliver directly whatever's available
-	if it.done {
-		return false
-	}
-	// Iterator still has logs, shift after the current value
-	if len(it.logs) == 0 {
-		it.done = true
-		return false
-	}
-	it.logs = it.logs[1:]
-	return true
-}
-
-// Error returns any retrieval or parsing error occurred during filtering.
-func (it *ParityTokenOwnershipTransferredIterator) Error() error {
-	return it.fail
-}
-
-// Close terminates the iteration process, releasing any pending underlying
-// resources.
-func (it *ParityTokenOwnershipTransferredIterator) Close() error {
-	it.done = true
-	return nil
-}
-
 // Event returns the parsed event data for the current log
 func (it *ParityTokenOwnershipTransferredIterator) Event() (*ParityTokenOwnershipTransferred, error) {
 	if len(it.logs) == 0 {
@@ -0,0 +1,564 @@
+package walletsdk
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// EIP712Domain separates the typed-data signatures of one application,
+// chain and contract from all others. Zero fields are left out of the
+// domain type.
+type EIP712Domain struct {
+	Name              string
+	Version           string
+	ChainID           *big.Int
+	VerifyingContract common.Address
+	Salt              common.Hash
+}
+
+// typedDomain returns the domain in apitypes form along with its type
+func (d EIP712Domain) typedDomain() (apitypes.TypedDataDomain, []apitypes.Type) {
+	var domain apitypes.TypedDataDomain
+	var fields []apitypes.Type
+	if d.Name != "" {
+		domain.Name = d.Name
+		fields = append(fields, apitypes.Type{Name: "name", Type: "string"})
+	}
+	if d.Version != "" {
+		domain.Version = d.Version
+		fields = append(fields, apitypes.Type{Name: "version", Type: "string"})
+	}
+	if d.ChainID != nil {
+		domain.ChainId = (*math.HexOrDecimal256)(d.ChainID)
+		fields = append(fields, apitypes.Type{Name: "chainId", Type: "uint256"})
+	}
+	if d.VerifyingContract != (common.Address{}) {
+		domain.VerifyingContract = d.VerifyingContract.Hex()
+		fields = append(fields, apitypes.Type{Name: "verifyingContract", Type: "address"})
+	}
+	if d.Salt != (common.Hash{}) {
+		domain.Salt = d.Salt.Hex()
+		fields = append(fields, apitypes.Type{Name: "salt", Type: "bytes32"})
+	}
+	return domain, fields
+}
+
+// Separator returns the domain separator, the hash of the domain struct
+func (d EIP712Domain) Separator() (common.Hash, error) {
+	domain, fields := d.typedDomain()
+	typed := apitypes.TypedData{Types: apitypes.Types{"EIP712Domain": fields}, Domain: domain}
+	hash, err := typed.HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to hash domain: %w", err)
+	}
+	return common.BytesToHash(hash), nil
+}
+
+// TypedData builds the EIP-712 typed data of message, a struct or pointer
+// to struct. The primary type is named after the Go type. Fields are named
+// by their eip712 tag, or after the field with its first letter lowered,
+// and a tag such as `eip712:"amount,uint128"` overrides the inferred type.
+// Fields tagged `eip712:"-"` are skipped.
+//
+// Go types map to string, bool, address (common.Address), bytes ([]byte),
+// bytesN ([N]byte and common.Hash), uintN and intN (sized integers, with
+// *big.Int as uint256), structs and arrays of them.
+//
+// The result marshals to the JSON expected by eth_signTypedData_v4.
+func TypedData(domain EIP712Domain, message interface{}) (apitypes.TypedData, error) {
+	value := reflect.ValueOf(message)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return apitypes.TypedData{}, fmt.Errorf("typed data message must be a struct, got %T", message)
+	}
+
+	typedDomain, domainFields := domain.typedDomain()
+	encoder := &typedEncoder{types: apitypes.Types{"EIP712Domain": domainFields}}
+	primary, err := encoder.structType(value.Type())
+	if err != nil {
+		return apitypes.TypedData{}, err
+	}
+	data, err := encoder.value(value, primary)
+	if err != nil {
+		return apitypes.TypedData{}, err
+	}
+	return apitypes.TypedData{
+		Types:       encoder.types,
+		PrimaryType: primary,
+		Domain:      typedDomain,
+		Message:     data.(map[string]interface{}),
+	}, nil
+}
+
+// HashTypedData returns the EIP-712 digest of message in domain, the hash
+// that is signed
+func HashTypedData(domain EIP712Domain, message interface{}) (common.Hash, error) {
+	typed, err := TypedData(domain, message)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	digest, _, err := apitypes.TypedDataAndHash(typed)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to hash typed data: %w", err)
+	}
+	return common.BytesToHash(digest), nil
+}
+
+// SignTypedData signs the EIP-712 digest of message with the client key. The
+// 65-byte signature ends with v as 27 or 28.
+func (c *Client) SignTypedData(domain EIP712Domain, message interface{}) ([]byte, error) {
+	digest, err := HashTypedData(domain, message)
+	if err != nil {
+		return nil, err
+	}
+	return c.SignHash(digest)
+}
+
+// RecoverTypedDataSigner returns the address that signed message in domain
+func RecoverTypedDataSigner(domain EIP712Domain, message interface{}, sig []byte) (common.Address, error) {
+	digest, err := HashTypedData(domain, message)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return RecoverHash(digest, sig)
+}
+
+var (
+	addressType = reflect.TypeOf(common.Address{})
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+)
+
+// typedEncoder collects the struct types of a message and converts its
+// values to the forms apitypes hashes
+type typedEncoder struct {
+	types apitypes.Types
+}
+
+// typedField is a struct field with its EIP-712 name and type
+type typedField struct {
+	index int
+	name  string
+	typ   string
+}
+
+// typedFields returns the EIP-712 fields of a struct type
+func typedFields(t reflect.Type) []typedField {
+	var fields []typedField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("eip712")
+		if tag == "-" {
+			continue
+		}
+		name, typ, _ := strings.Cut(tag, ",")
+		if name == "" {
+			runes := []rune(field.Name)
+			runes[0] = unicode.ToLower(runes[0])
+			name = string(runes)
+		}
+		fields = append(fields, typedField{index: i, name: name, typ: typ})
+	}
+	return fields
+}
+
+// structType registers a struct type and the types it depends on
+func (e *typedEncoder) structType(t reflect.Type) (string, error) {
+	name := t.Name()
+	if name == "" {
+		return "", fmt.Errorf("typed data structs must be named types")
+	}
+	if _, ok := e.types[name]; ok {
+		return name, nil
+	}
+	// Registered before its fields so recursive types terminate
+	e.types[name] = nil
+
+	var fields []apitypes.Type
+	for _, field := range typedFields(t) {
+		typ := field.typ
+		if typ == "" {
+			inferred, err := e.fieldType(t.Field(field.index).Type)
+			if err != nil {
+				return "", fmt.Errorf("%s.%s: %w", name, t.Field(field.index).Name, err)
+			}
+			typ = inferred
+		}
+		fields = append(fields, apitypes.Type{Name: field.name, Type: typ})
+	}
+	e.types[name] = fields
+	return name, nil
+}
+
+// fieldType infers the EIP-712 type of a Go type
+func (e *typedEncoder) fieldType(t reflect.Type) (string, error) {
+	switch {
+	case t == addressType:
+		return "address", nil
+	case t == bigIntType:
+		return "uint256", nil
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		return e.structType(t.Elem())
+	case t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		if t.Len() == 0 || t.Len() > 32 {
+			return "", fmt.Errorf("unsupported byte array length %d", t.Len())
+		}
+		return fmt.Sprintf("bytes%d", t.Len()), nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return "bytes", nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "bool", nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("uint%d", t.Bits()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("int%d", t.Bits()), nil
+	case reflect.Uint:
+		return "uint256", nil
+	case reflect.Int:
+		return "int256", nil
+	case reflect.Struct:
+		return e.structType(t)
+	case reflect.Slice:
+		elem, err := e.fieldType(t.Elem())
+		return elem + "[]", err
+	case reflect.Array:
+		elem, err := e.fieldType(t.Elem())
+		return fmt.Sprintf("%s[%d]", elem, t.Len()), err
+	}
+	return "", fmt.Errorf("unsupported type %s", t)
+}
+
+// value converts a Go value of the given EIP-712 type for hashing
+func (e *typedEncoder) value(v reflect.Value, typ string) (interface{}, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil value for %s", typ)
+		}
+		if v.Type() == bigIntType {
+			return new(big.Int).Set(v.Interface().(*big.Int)), nil
+		}
+		v = v.Elem()
+	}
+
+	if i := strings.LastIndexByte(typ, '['); i > 0 && strings.HasSuffix(typ, "]") {
+		items := make([]interface{}, v.Len())
+		for n := range items {
+			item, err := e.value(v.Index(n), typ[:i])
+			if err != nil {
+				return nil, err
+			}
+			items[n] = item
+		}
+		return items, nil
+	}
+
+	if fields, ok := e.types[typ]; ok {
+		data := make(map[string]interface{}, len(fields))
+		for n, field := range typedFields(v.Type()) {
+			item, err := e.value(v.Field(field.index), fields[n].Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", typ, field.name, err)
+			}
+			data[field.name] = item
+		}
+		return data, nil
+	}
+
+	switch {
+	case v.Type() == addressType:
+		return v.Interface().(common.Address).Hex(), nil
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		return data, nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Bytes(), nil
+	case v.CanUint():
+		return new(big.Int).SetUint64(v.Uint()), nil
+	case v.CanInt():
+		return big.NewInt(v.Int()), nil
+	}
+	return v.Interface(), nil
+}
+
+// PaymentAuthorizationType is the EIP-712 primary type of PaymentAuthorization
+const PaymentAuthorizationType = "PaymentAuthorization"
+
+// PaymentAuthorization lets the wallet of a creator device authorize the
+// operator to pay a solver device from its stake, signed as EIP-712 typed
+// data in the stake contract's PaymentDomain
+type PaymentAuthorization struct {
+	CreatorDeviceID string   `eip712:"creatorDeviceID"`
+	SolverDeviceID  string   `eip712:"solverDeviceID"`
+	Amount          *big.Int `eip712:"amount"`
+	TaskID          string   `eip712:"taskID"`
+	Nonce           *big.Int `eip712:"nonce"`
+	// Deadline is the Unix time after which the authorization is void
+	Deadline *big.Int `eip712:"deadline"`
+}
+
+// Payment returns the payment the authorization allows, identified by its
+// task ID. Settling it through a Settler pays each task at most once.
+func (a *PaymentAuthorization) Payment() Payment {
+	return Payment{ID: a.TaskID, Creator: a.CreatorDeviceID, Solver: a.SolverDeviceID, Amount: a.Amount}
+}
+
+// Payment authorization errors
+var (
+	ErrAuthorizationExpired = errors.New("payment authorization expired")
+	ErrUnauthorizedSigner   = errors.New("payment authorization not signed by the creator's wallet")
+	ErrAuthorizationUsed    = errors.New("payment authorization already used")
+)
+
+// PaymentDomain returns the EIP-712 domain of payment authorizations for the
+// client's chain and stake contract
+func (c *Client) PaymentDomain() (EIP712Domain, error) {
+	if c.stakeWallet == nil {
+		return EIP712Domain{}, fmt.Errorf("stake wallet not initialized")
+	}
+	return EIP712Domain{
+		Name:              "StakeWallet",
+		Version:           "1",
+		ChainID:           c.chainID,
+		VerifyingContract: c.stakeWallet.contract.address,
+	}, nil
+}
+
+// SignPaymentAuthorization signs auth with the client key
+func (c *Client) SignPaymentAuthorization(auth *PaymentAuthorization) ([]byte, error) {
+	domain, err := c.PaymentDomain()
+	if err != nil {
+		return nil, err
+	}
+	return c.SignTypedData(domain, auth)
+}
+
+// VerifyPaymentAuthorization checks that auth is complete, has not passed
+// its deadline and was signed by the wallet address registered for the
+// creator device
+func (c *Client) VerifyPaymentAuthorization(auth *PaymentAuthorization, sig []byte) error {
+	switch {
+	case auth.CreatorDeviceID == "" || auth.SolverDeviceID == "":
+		return fmt.Errorf("creator and solver devices are required")
+	case auth.Amount == nil || auth.Amount.Sign() <= 0:
+		return fmt.Errorf("amount must be positive")
+	case auth.TaskID == "":
+		return fmt.Errorf("task ID is required")
+	case auth.Nonce == nil || auth.Deadline == nil:
+		return fmt.Errorf("nonce and deadline are required")
+	case auth.Deadline.Cmp(big.NewInt(time.Now().Unix())) < 0:
+		return fmt.Errorf("%w at %s", ErrAuthorizationExpired, time.Unix(auth.Deadline.Int64(), 0).UTC().Format(time.RFC3339))
+	}
+
+	domain, err := c.PaymentDomain()
+	if err != nil {
+		return err
+	}
+	signer, err := RecoverTypedDataSigner(domain, auth, sig)
+	if err != nil {
+		return err
+	}
+	info, err := c.GetStakeInfo(auth.CreatorDeviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get stake info of %s: %w", auth.CreatorDeviceID, err)
+	}
+	if !info.Exists {
+		return fmt.Errorf("creator device %s not found", auth.CreatorDeviceID)
+	}
+	if signer != info.WalletAddress {
+		return fmt.Errorf("%w: signed by %s, %s is registered to %s", ErrUnauthorizedSigner, signer.Hex(), auth.CreatorDeviceID, info.WalletAddress.Hex())
+	}
+	return nil
+}
+
+// TransferAuthorizedPayment verifies auth and pays the solver through
+// TransferPayment. Each creator nonce is accepted once: an authorization
+// paid by this client is refused with ErrAuthorizationUsed until its
+// deadline passes. The nonce is claimed before the payment is signed, and
+// is kept in memory unless SetAuthorizationStore gave the client a store
+// that outlives the process.
+func (c *Client) TransferAuthorizedPayment(auth *PaymentAuthorization, sig []byte) (*types.Transaction, error) {
+	if err := c.VerifyPaymentAuthorization(auth, sig); err != nil {
+		return nil, err
+	}
+	if err := c.authorizations.claim(auth); err != nil {
+		return nil, err
+	}
+	tx, err := c.TransferPayment(auth.CreatorDeviceID, auth.SolverDeviceID, auth.Amount)
+	if err != nil && isRevert(err) {
+		// Rejected when the gas was estimated, so nothing was sent
+		if releaseErr := c.authorizations.release(auth); releaseErr != nil {
+			return tx, errors.Join(err, releaseErr)
+		}
+	}
+	return tx, err
+}
+
+// SetAuthorizationStore makes the client save the payment authorizations it
+// pays in store and loads those saved before, so a restarted process still
+// refuses their replays
+func (c *Client) SetAuthorizationStore(store AuthorizationStore) error {
+	return c.authorizations.load(store)
+}
+
+// AuthorizationRecord is the saved state of a payment authorization nonce
+type AuthorizationRecord struct {
+	Creator string   `json:"creator"`
+	Nonce   *big.Int `json:"nonce"`
+	TaskID  string   `json:"taskID"`
+	// Deadline is the Unix time after which the record can be forgotten
+	Deadline int64 `json:"deadline"`
+	// Released records are nonces whose payment was rejected before it was
+	// sent, so they may be used again
+	Released bool      `json:"released,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// AuthorizationStore persists the payment authorization nonces a client paid
+type AuthorizationStore interface {
+	// Save durably stores the latest state of the record
+	Save(record *AuthorizationRecord) error
+	// Load returns the latest state of every saved record
+	Load() ([]AuthorizationRecord, error)
+}
+
+// authorizationKey identifies a payment authorization by its creator device
+// and nonce
+type authorizationKey struct {
+	creator string
+	nonce   string
+}
+
+// usedAuthorizations remembers paid authorizations until their deadlines,
+// after which VerifyPaymentAuthorization refuses them anyway
+type usedAuthorizations struct {
+	mu    sync.Mutex
+	used  map[authorizationKey]int64
+	store AuthorizationStore
+}
+
+// load replaces the remembered authorizations with those saved in store
+func (u *usedAuthorizations) load(store AuthorizationStore) error {
+	records, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load payment authorizations: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now().Unix()
+	u.used = make(map[authorizationKey]int64, len(records))
+	for _, record := range records {
+		if !record.Released && record.Deadline >= now {
+			u.used[authorizationKey{record.Creator, record.Nonce.String()}] = record.Deadline
+		}
+	}
+	u.store = store
+	return nil
+}
+
+func (u *usedAuthorizations) claim(auth *PaymentAuthorization) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now().Unix()
+	for key, deadline := range u.used {
+		if deadline < now {
+			delete(u.used, key)
+		}
+	}
+	key := authorizationKey{auth.CreatorDeviceID, auth.Nonce.String()}
+	if _, ok := u.used[key]; ok {
+		return fmt.Errorf("%w: nonce %s of %s", ErrAuthorizationUsed, auth.Nonce, auth.CreatorDeviceID)
+	}
+	deadline := int64(1<<63 - 1)
+	if auth.Deadline.IsInt64() {
+		deadline = auth.Deadline.Int64()
+	}
+	if err := u.save(auth, deadline, false); err != nil {
+		return err
+	}
+	u.used[key] = deadline
+	return nil
+}
+
+func (u *usedAuthorizations) release(auth *PaymentAuthorization) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := authorizationKey{auth.CreatorDeviceID, auth.Nonce.String()}
+	if err := u.save(auth, u.used[key], true); err != nil {
+		return err
+	}
+	delete(u.used, key)
+	return nil
+}
+
+// save records the state of auth in the store, if there is one
+func (u *usedAuthorizations) save(auth *PaymentAuthorization, deadline int64, released bool) error {
+	if u.store == nil {
+		return nil
+	}
+	record := &AuthorizationRecord{
+		Creator:  auth.CreatorDeviceID,
+		Nonce:    auth.Nonce,
+		TaskID:   auth.TaskID,
+		Deadline: deadline,
+		Released: released,
+		Updated:  time.Now().UTC(),
+	}
+	if err := u.store.Save(record); err != nil {
+		return fmt.Errorf("failed to save nonce %s of %s: %w", auth.Nonce, auth.CreatorDeviceID, err)
+	}
+	return nil
+}
+
+// FileAuthorizationStore saves payment authorization records to a JSONL
+// file, appending the new state of a record on every change
+type FileAuthorizationStore struct {
+	file *jsonlFile
+}
+
+// NewFileAuthorizationStore opens or creates a JSONL authorization file
+func NewFileAuthorizationStore(path string) (*FileAuthorizationStore, error) {
+	file, err := openJSONL(path, "authorization")
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuthorizationStore{file: file}, nil
+}
+
+// Save writes the record as a single line and syncs the file
+func (s *FileAuthorizationStore) Save(record *AuthorizationRecord) error {
+	return s.file.append(record)
+}
+
+// Load returns the last saved state of each record in the file
+func (s *FileAuthorizationStore) Load() ([]AuthorizationRecord, error) {
+	return readLatest(s.file, "authorization record", func(record *AuthorizationRecord) string {
+		return record.Creator + "\x00" + record.Nonce.String()
+	})
+}
+
+// Close closes the authorization file
+func (s *FileAuthorizationStore) Close() error {
+	return s.file.close()
+}
@@ -0,0 +1,182 @@
+package walletsdk_test
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+// Person and Mail are the example types of EIP-712
+type Person struct {
+	Name   string
+	Wallet common.Address
+}
+
+type Mail struct {
+	From     Person
+	To       Person
+	Contents string
+}
+
+func TestTypedData(t *testing.T) {
+	domain := walletsdk.EIP712Domain{
+		Name:              "Ether Mail",
+		Version:           "1",
+		ChainID:           big.NewInt(1),
+		VerifyingContract: common.HexToAddress("0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"),
+	}
+	mail := Mail{
+		From:     Person{Name: "Cow", Wallet: common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")},
+		To:       Person{Name: "Bob", Wallet: common.HexToAddress("0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB")},
+		Contents: "Hello, Bob!",
+	}
+
+	// Expected values from the specification's example
+	separator, err := domain.Separator()
+	if err != nil || separator != common.HexToHash("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f") {
+		t.Fatalf("Separator = %s, %v", separator.Hex(), err)
+	}
+	digest, err := walletsdk.HashTypedData(domain, &mail)
+	if err != nil || digest != common.HexToHash("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2") {
+		t.Fatalf("HashTypedData = %s, %v", digest.Hex(), err)
+	}
+	typed, err := walletsdk.TypedData(domain, mail)
+	if err != nil {
+		t.Fatalf("TypedData: %v", err)
+	}
+	if typed.PrimaryType != "Mail" || string(typed.EncodeType("Mail")) != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Errorf("encoded type = %s", typed.EncodeType("Mail"))
+	}
+
+	sig := hexutil.MustDecode("0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c")
+	signer, err := walletsdk.RecoverTypedDataSigner(domain, mail, sig)
+	if err != nil || signer != mail.From.Wallet {
+		t.Fatalf("RecoverTypedDataSigner = %s, %v", signer.Hex(), err)
+	}
+	sig[64] -= 27
+	if signer, _ := walletsdk.RecoverTypedDataSigner(domain, mail, sig); signer != mail.From.Wallet {
+		t.Errorf("v as recovery ID recovered %s", signer.Hex())
+	}
+
+	if _, err := walletsdk.TypedData(domain, struct{ Channel chan int }{}); err == nil {
+		t.Error("unsupported type accepted")
+	}
+}
+
+func TestPaymentAuthorization(t *testing.T) {
+	chain := newChain(t)
+	creator := newClient(t, chain, chain.Accounts[0])
+	tx, err := creator.AddFunds(tokens(5), "creator")
+	mined(t, chain, tx, err)
+	tx, err = newClient(t, chain, chain.Accounts[1]).AddFunds(tokens(1), "solver")
+	mined(t, chain, tx, err)
+	operator := newClient(t, chain, chain.Owner)
+	path := filepath.Join(t.TempDir(), "authorizations.jsonl")
+	newAuthorizationStore := func(client *walletsdk.Client) {
+		t.Helper()
+		store, err := walletsdk.NewFileAuthorizationStore(path)
+		if err != nil {
+			t.Fatalf("NewFileAuthorizationStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		if err := client.SetAuthorizationStore(store); err != nil {
+			t.Fatalf("SetAuthorizationStore: %v", err)
+		}
+	}
+	newAuthorizationStore(operator)
+
+	deadline := big.NewInt(time.Now().Add(time.Hour).Unix())
+	auth := &walletsdk.PaymentAuthorization{
+		CreatorDeviceID: "creator",
+		SolverDeviceID:  "solver",
+		Amount:          tokens(2),
+		TaskID:          "task-1",
+		Nonce:           big.NewInt(1),
+		Deadline:        deadline,
+	}
+	sig, err := creator.SignPaymentAuthorization(auth)
+	if err != nil {
+		t.Fatalf("SignPaymentAuthorization: %v", err)
+	}
+
+	tx, err = operator.TransferAuthorizedPayment(auth, sig)
+	mined(t, chain, tx, err)
+	expectStake(t, operator, "solver", tokens(3))
+
+	// Each nonce pays once, whatever the task
+	if _, err := operator.TransferAuthorizedPayment(auth, sig); !errors.Is(err, walletsdk.ErrAuthorizationUsed) {
+		t.Errorf("replayed authorization: %v", err)
+	}
+	again := *auth
+	again.TaskID = "task-2"
+	againSig, _ := creator.SignPaymentAuthorization(&again)
+	if _, err := operator.TransferAuthorizedPayment(&again, againSig); !errors.Is(err, walletsdk.ErrAuthorizationUsed) {
+		t.Errorf("reused nonce: %v", err)
+	}
+	again.Nonce = big.NewInt(2)
+	againSig, _ = creator.SignPaymentAuthorization(&again)
+	tx, err = operator.TransferAuthorizedPayment(&again, againSig)
+	mined(t, chain, tx, err)
+	expectStake(t, operator, "solver", tokens(5))
+
+	// A payment rejected before sending leaves its nonce unused
+	broke := *auth
+	broke.Nonce, broke.Amount = big.NewInt(3), tokens(2)
+	brokeSig, _ := creator.SignPaymentAuthorization(&broke)
+	if _, err := operator.TransferAuthorizedPayment(&broke, brokeSig); err == nil || errors.Is(err, walletsdk.ErrAuthorizationUsed) {
+		t.Errorf("payment above the stake: %v", err)
+	}
+	tx, err = creator.AddFunds(tokens(1), "creator")
+	mined(t, chain, tx, err)
+	tx, err = operator.TransferAuthorizedPayment(&broke, brokeSig)
+	mined(t, chain, tx, err)
+	expectStake(t, operator, "solver", tokens(7))
+
+	// A restarted operator still refuses paid nonces
+	restarted := newClient(t, chain, chain.Owner)
+	newAuthorizationStore(restarted)
+	for _, replay := range []struct {
+		auth *walletsdk.PaymentAuthorization
+		sig  []byte
+	}{{auth, sig}, {&again, againSig}, {&broke, brokeSig}} {
+		if _, err := restarted.TransferAuthorizedPayment(replay.auth, replay.sig); !errors.Is(err, walletsdk.ErrAuthorizationUsed) {
+			t.Errorf("nonce %s replayed after restart: %v", replay.auth.Nonce, err)
+		}
+	}
+
+	tampered := *auth
+	tampered.Amount = tokens(3)
+	if err := operator.VerifyPaymentAuthorization(&tampered, sig); !errors.Is(err, walletsdk.ErrUnauthorizedSigner) {
+		t.Errorf("tampered authorization: %v", err)
+	}
+
+	other, err := newClient(t, chain, chain.Accounts[1]).SignPaymentAuthorization(auth)
+	if err != nil {
+		t.Fatalf("SignPaymentAuthorization: %v", err)
+	}
+	if err := operator.VerifyPaymentAuthorization(auth, other); !errors.Is(err, walletsdk.ErrUnauthorizedSigner) {
+		t.Errorf("authorization signed by another wallet: %v", err)
+	}
+
+	expired := *auth
+	expired.Deadline = big.NewInt(time.Now().Add(-time.Minute).Unix())
+	sig, _ = creator.SignPaymentAuthorization(&expired)
+	if err := operator.VerifyPaymentAuthorization(&expired, sig); !errors.Is(err, walletsdk.ErrAuthorizationExpired) {
+		t.Errorf("expired authorization: %v", err)
+	}
+
+	// Signatures are bound to the chain and contract
+	domain, _ := operator.PaymentDomain()
+	domain.ChainID = big.NewInt(1)
+	sig, _ = creator.SignTypedData(domain, auth)
+	if err := operator.VerifyPaymentAuthorization(auth, sig); !errors.Is(err, walletsdk.ErrUnauthorizedSigner) {
+		t.Errorf("authorization for another chain: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package walletsdk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// VerifyOptions configures the contract verification run by Verify. Zero
+// code hashes skip the bytecode comparison.
+type VerifyOptions struct {
+	// TokenCodeHash is the keccak256 of the expected token runtime code
+	TokenCodeHash common.Hash
+	// StakeCodeHash is the keccak256 of the expected stake runtime code
+	StakeCodeHash common.Hash
+}
+
+// VerificationCheck is the outcome of a single verification check
+type VerificationCheck struct {
+	Name     string
+	OK       bool
+	Expected string
+	Actual   string
+}
+
+// VerificationReport lists every check run against the configured contracts
+type VerificationReport struct {
+	ChainID      string
+	TokenAddress common.Address
+	StakeAddress common.Address
+	Checks       []VerificationCheck
+}
+
+// OK reports whether every check passed
+func (r *VerificationReport) OK() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the report with one line per check
+func (r *VerificationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "chain %s, token %s, stake %s\n", r.ChainID, r.TokenAddress.Hex(), r.StakeAddress.Hex())
+	for _, check := range r.Checks {
+		status := "ok"
+		if !check.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "  [%s] %s: expected %s, got %s\n", status, check.Name, check.Expected, check.Actual)
+	}
+	return b.String()
+}
+
+func (r *VerificationReport) add(name string, ok bool, expected, actual string) bool {
+	r.Checks = append(r.Checks, VerificationCheck{Name: name, OK: ok, Expected: expected, Actual: actual})
+	return ok
+}
+
+// VerificationError is returned when the configured contracts do not match
+// the chain
+type VerificationError struct {
+	Report *VerificationReport
+}
+
+func (e *VerificationError) Error() string {
+	var failed []string
+	for _, check := range e.Report.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+	return fmt.Sprintf("contract verification failed (%s):\n%s", strings.Join(failed, ", "), e.Report)
+}
+
+// Verify checks that the node serves the configured chain, that code exists
+// at the token and stake addresses, that the stake contract uses the
+// configured token and that the code matches the optional hashes. Mismatches
+// are returned as *VerificationError with the full report; RPC failures are
+// returned as plain errors.
+func (c *Client) Verify(ctx context.Context, options VerifyOptions) (*VerificationReport, error) {
+	report := &VerificationReport{ChainID: c.chainID.String(), TokenAddress: c.tokenAddress}
+	if c.stakeWallet != nil {
+		report.StakeAddress = c.stakeWallet.contract.address
+	}
+
+	chainID, err := c.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	report.add("chain ID", chainID.Cmp(c.chainID) == 0, c.chainID.String(), chainID.String())
+
+	if err := c.verifyCode(ctx, report, ContractParityToken, c.tokenAddress, options.TokenCodeHash); err != nil {
+		return nil, err
+	}
+
+	if c.stakeWallet != nil {
+		if err := c.verifyCode(ctx, report, ContractStakeWallet, report.StakeAddress, options.StakeCodeHash); err != nil {
+			return nil, err
+		}
+		token, err := c.stakeWallet.contract.Token(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			report.add("stake token()", false, c.tokenAddress.Hex(), "call failed: "+err.Error())
+		} else {
+			report.add("stake token()", token == c.tokenAddress, c.tokenAddress.Hex(), token.Hex())
+		}
+	}
+
+	if !report.OK() {
+		return report, &VerificationError{Report: report}
+	}
+	return report, nil
+}
+
+// verifyCode checks that code exists at addr and matches hash when set
+func (c *Client) verifyCode(ctx context.Context, report *VerificationReport, contract string, addr common.Address, hash common.Hash) error {
+	code, err := c.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s code: %w", contract, err)
+	}
+	if !report.add(contract+" code", len(code) > 0, "contract code", fmt.Sprintf("%d bytes", len(code))) {
+		return nil
+	}
+	if hash != (common.Hash{}) {
+		actual := crypto.Keccak256Hash(code)
+		report.add(contract+" code hash", actual == hash, hash.Hex(), actual.Hex())
+	}
+	return nil
+}
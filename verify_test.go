@@ -0,0 +1,64 @@
+package walletsdk_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+)
+
+func TestVerify(t *testing.T) {
+	chain := newChain(t)
+	ctx := context.Background()
+
+	tokenCode, err := chain.Backend.Client().CodeAt(ctx, chain.TokenAddress, nil)
+	if err != nil {
+		t.Fatalf("CodeAt: %v", err)
+	}
+	config := chain.Config(chain.Accounts[0])
+	config.Verify = &walletsdk.VerifyOptions{TokenCodeHash: crypto.Keccak256Hash(tokenCode)}
+	client, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+	if err != nil {
+		t.Fatalf("NewClientWithBackend with valid contracts: %v", err)
+	}
+	report, err := client.Verify(ctx, *config.Verify)
+	if err != nil || !report.OK() || len(report.Checks) != 5 {
+		t.Fatalf("Verify = %v, %v", report, err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*walletsdk.ClientConfig)
+		failed []string
+	}{
+		{"wrong chain ID", func(c *walletsdk.ClientConfig) { c.ChainID = 1 }, []string{"chain ID"}},
+		{"token address is an account", func(c *walletsdk.ClientConfig) { c.TokenAddress = chain.Accounts[1].Address }, []string{"ParityToken code", "stake token()"}},
+		{"wrong code hash", func(c *walletsdk.ClientConfig) { c.Verify.StakeCodeHash = crypto.Keccak256Hash(tokenCode) }, []string{"StakeWallet code hash"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain.Config(chain.Accounts[0])
+			config.Verify = &walletsdk.VerifyOptions{}
+			tt.modify(&config)
+
+			_, err := walletsdk.NewClientWithBackend(chain.Backend.Client(), config)
+			var verifyErr *walletsdk.VerificationError
+			if !errors.As(err, &verifyErr) {
+				t.Fatalf("NewClientWithBackend = %v, want VerificationError", err)
+			}
+			var failed []string
+			for _, check := range verifyErr.Report.Checks {
+				if !check.OK {
+					failed = append(failed, check.Name)
+				}
+			}
+			if strings.Join(failed, ",") != strings.Join(tt.failed, ",") {
+				t.Fatalf("failed checks = %v, want %v\n%s", failed, tt.failed, verifyErr.Report)
+			}
+		})
+	}
+}